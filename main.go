@@ -6,12 +6,17 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 
 	_ "net/http/pprof"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/siggy/gographs/pkg/auth"
 	"github.com/siggy/gographs/pkg/cache"
 	"github.com/siggy/gographs/pkg/graph"
+	"github.com/siggy/gographs/pkg/render"
+	"github.com/siggy/gographs/pkg/warm"
 	"github.com/siggy/gographs/pkg/web"
 	log "github.com/sirupsen/logrus"
 )
@@ -29,6 +34,39 @@ func main() {
 	logLevel := flag.String("log-level", log.DebugLevel.String(), "log level, must be one of: panic, fatal, error, warn, info, debug, trace")
 	metricsAddr := flag.String("metrics-addr", "localhost:8080", "address to listen on for metrics requests")
 	valkeyAddr := flag.String("valkey-addr", "localhost:6379", "address to connect to valkey")
+	cacheBackend := flag.String("cache", cache.Valkey, fmt.Sprintf("cache backend, must be one of: %s, %s, %s", cache.Valkey, cache.Memory, cache.Filesystem))
+	cacheLocalBytes := flag.Int("cache-local-bytes", cache.DefaultLocalBytes, "bytes of Valkey graphs also cached in process, 0 to disable")
+	cacheEntries := flag.Int("cache-entries", cache.DefaultMemoryEntries, "maximum graphs held by the memory cache")
+	cacheDir := flag.String("cache-dir", filepath.Join(os.TempDir(), "gographs"), "directory for the fs cache")
+	cacheTTL := flag.Duration("cache-ttl", cache.DefaultTTL, "how long cached graphs are fresh")
+	cacheStaleTTL := flag.Duration("cache-stale-ttl", cache.DefaultStaleTTL, "how long stale graphs are served while they are rebuilt")
+	warmInterval := flag.Duration("warm-interval", warm.DefaultInterval, "how often to rebuild popular repos whose commit changed, 0 to disable")
+	warmRepos := flag.Int("warm-repos", warm.DefaultRepos, "how many of the most popular repos to keep warm")
+	warmDelay := flag.Duration("warm-delay", warm.DefaultDelay, "minimum time between warmer rebuilds")
+	linksFile := flag.String("link-templates", "", "JSON file of node and edge URL templates, by source host")
+	webhookSecretsFile := flag.String("webhook-secrets", "", "JSON file of push webhook secrets, by git host: github, gitlab or gitea")
+	readRate := flag.String("rate-reads", web.DefaultLimits.Reads.String(), "graph reads allowed per client, as N/DURATION, 0 for no limit")
+	clientRefreshRate := flag.String("rate-client-refreshes", web.DefaultLimits.ClientRefreshes.String(), "graph refreshes allowed per client, as N/DURATION, 0 for no limit")
+	repoRefreshRate := flag.String("rate-repo-refreshes", web.DefaultLimits.RepoRefreshes.String(), "graph refreshes allowed per repo, as N/DURATION, 0 for no limit")
+	trustedProxies := flag.String("trusted-proxies", "", "comma-separated CIDRs of reverse proxies whose X-Forwarded-For headers identify clients, e.g. 10.0.0.0/8")
+	graphURLs := flag.String("graph-url", "", "comma-separated graph server base URLs for the web server, e.g. http://graph.internal:8889, defaults to graph-addr over https with TLS flags, else http")
+	graphTimeout := flag.Duration("graph-timeout", graph.DefaultTimeout, "timeout for each request to the graph server")
+	graphIdleConns := flag.Int("graph-idle-conns", graph.DefaultIdleConns, "idle connections to keep open to each graph server")
+	graphRetries := flag.Int("graph-retries", graph.DefaultRetries, "retries of graph requests after transient failures, 0 to disable")
+	graphHedgeDelay := flag.Duration("graph-hedge-delay", graph.DefaultHedgeDelay, "how long to wait for one graph server before also asking the next, 0 to disable")
+	graphBreakerFailures := flag.Int("graph-breaker-failures", graph.DefaultBreakerFailures, "consecutive failures that stop requests to a graph server, 0 to disable")
+	graphBreakerCooldown := flag.Duration("graph-breaker-cooldown", graph.DefaultBreakerCooldown, "how long to stop requests to a failing graph server")
+	graphHealthInterval := flag.Duration("graph-health-interval", graph.DefaultHealthInterval, "how often to health check graph servers, ejecting failing ones, 0 to disable")
+	graphDiscover := flag.Bool("graph-discover", false, "resolve each graph-url host to all its addresses, e.g. a headless service, and balance across them")
+	graphGRPC := flag.Bool("graph-grpc", false, "send graph requests over the graph servers' gRPC API rather than HTTP")
+	graphCert := flag.String("graph-cert", "", "TLS certificate for the graph server, or the web server's client certificate for mutual TLS")
+	graphKey := flag.String("graph-key", "", "TLS key for graph-cert")
+	graphCA := flag.String("graph-ca", "", "CA bundle to verify the other side of graph connections with; the graph server then requires client certificates")
+	graphTokenFile := flag.String("graph-token-file", "", "file holding a token shared by the web and graph servers, required by the graph server")
+	apiKeys := flag.String("api-keys", "", "API key store, valkey or a JSON file, empty to leave the API open")
+	adminKeyFile := flag.String("admin-key-file", "", "file holding a bootstrap admin API key, for creating the first keys")
+	privateRepos := flag.String("private-repos", "", "comma-separated repo prefixes that require the private-repos scope, e.g. git.example.com/")
+	rendererName := flag.String("renderer", render.Graphviz, fmt.Sprintf("svg renderer, must be one of: %s, %s", render.Graphviz, render.Layered))
 	flag.Parse()
 
 	level, err := log.ParseLevel(*logLevel)
@@ -46,9 +84,25 @@ func main() {
 		}
 	}()
 
+	graphToken, err := graph.LoadToken(*graphTokenFile)
+	if err != nil {
+		log.Fatalf("invalid graph-token-file: %s", err)
+	}
+	graphSecurity := graph.Security{
+		CertFile: *graphCert,
+		KeyFile:  *graphKey,
+		CAFile:   *graphCA,
+		Token:    graphToken,
+	}
+
 	if *target == targetAll || *target == targetGraph {
+		links, err := graph.LoadLinks(*linksFile)
+		if err != nil {
+			log.Fatalf("invalid link-templates: %s", err)
+		}
+
 		go func() {
-			err := graph.Start(*graphAddr)
+			err := graph.Start(*graphAddr, links, graphSecurity)
 			if err != nil {
 				log.Fatalf("failed to start graph server [%s]: %s", *webAddr, err)
 			}
@@ -56,14 +110,90 @@ func main() {
 	}
 
 	if *target == targetAll || *target == targetWeb {
+		renderer, err := render.NewRenderer(*rendererName)
+		if err != nil {
+			log.Fatalf("invalid renderer: %s", err)
+		}
+		webhooks, err := web.LoadWebhookSecrets(*webhookSecretsFile)
+		if err != nil {
+			log.Fatalf("failed to load webhook secrets: %s", err)
+		}
+		var limits web.Limits
+		for _, rate := range []struct {
+			flag string
+			dst  *web.Rate
+		}{
+			{*readRate, &limits.Reads},
+			{*clientRefreshRate, &limits.ClientRefreshes},
+			{*repoRefreshRate, &limits.RepoRefreshes},
+		} {
+			*rate.dst, err = web.ParseRate(rate.flag)
+			if err != nil {
+				log.Fatalf("invalid rate limit: %s", err)
+			}
+		}
+
+		proxies, err := web.ParseTrustedProxies(*trustedProxies)
+		if err != nil {
+			log.Fatalf("invalid trusted-proxies: %s", err)
+		}
+
+		var access web.Access
+		if *privateRepos != "" {
+			access.PrivateRepos = strings.Split(*privateRepos, ",")
+		}
+		if *apiKeys != "" {
+			access.Keys, err = openKeys(*apiKeys, *valkeyAddr, *adminKeyFile)
+			if err != nil {
+				log.Fatalf("failed to open API keys: %s", err)
+			}
+		} else if *privateRepos != "" || *adminKeyFile != "" {
+			log.Fatalf("private-repos and admin-key-file require api-keys")
+		}
+
 		go func() {
-			c, err := cache.New(*valkeyAddr)
+			store, err := cache.Open(cache.Config{
+				Backend:       *cacheBackend,
+				ValkeyAddr:    *valkeyAddr,
+				LocalBytes:    *cacheLocalBytes,
+				MemoryEntries: *cacheEntries,
+				Dir:           *cacheDir,
+			})
+			if err != nil {
+				log.Fatalf("failed to open cache: %s", err)
+			}
+			c, err := cache.New(store, *cacheTTL, *cacheStaleTTL)
 			if err != nil {
 				log.Fatalf("failed to initialize cache: %s", err)
 			}
 
-			graph := graph.NewClient(*graphAddr)
-			err = web.Start(c, *webAddr, graph)
+			urls := []string{graph.GraphURL(*graphAddr, graphSecurity)}
+			if *graphURLs != "" {
+				urls = strings.Split(*graphURLs, ",")
+			}
+			graph, err := graph.NewClient(graph.ClientConfig{
+				URLs:            urls,
+				Security:        graphSecurity,
+				Timeout:         *graphTimeout,
+				IdleConns:       *graphIdleConns,
+				Retries:         *graphRetries,
+				HedgeDelay:      *graphHedgeDelay,
+				BreakerFailures: *graphBreakerFailures,
+				BreakerCooldown: *graphBreakerCooldown,
+				HealthInterval:  *graphHealthInterval,
+				Discover:        *graphDiscover,
+				GRPC:            *graphGRPC,
+			})
+			if err != nil {
+				log.Fatalf("failed to initialize graph client: %s", err)
+			}
+			go warm.Start(c, graph, renderer, warm.Config{
+				Interval: *warmInterval,
+				Repos:    *warmRepos,
+				Delay:    *warmDelay,
+			})
+
+			err = web.Start(c, *webAddr, graph, renderer, webhooks, limits, access, proxies)
 			if err != nil {
 				log.Fatalf("failed to start web server [%s]: %s", *webAddr, err)
 			}
@@ -74,3 +204,32 @@ func main() {
 	signal.Notify(signalChan, os.Interrupt)
 	<-signalChan
 }
+
+// openKeys opens the API key store named by keys, valkey or a JSON file, and
+// the bootstrap admin key in adminKeyFile, if any.
+func openKeys(keys, valkeyAddr, adminKeyFile string) (*auth.Authenticator, error) {
+	var store auth.Store
+	var err error
+	if keys == cache.Valkey {
+		store, err = auth.NewValkey(valkeyAddr)
+	} else {
+		store, err = auth.NewFile(keys)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var adminToken string
+	if adminKeyFile != "" {
+		b, err := os.ReadFile(adminKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		adminToken = strings.TrimSpace(string(b))
+		if adminToken == "" {
+			return nil, fmt.Errorf("admin key file %s is empty", adminKeyFile)
+		}
+	}
+
+	return auth.New(store, adminToken), nil
+}
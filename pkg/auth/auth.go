@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scope grants access to a tier of requests.
+type Scope string
+
+const (
+	// Read allows building graphs that are not yet cached. Cached graphs of
+	// public repos are open to all.
+	Read Scope = "read"
+	// Refresh allows clearing and rebuilding a repo's graphs.
+	Refresh Scope = "refresh"
+	// PrivateRepos allows graphing private repos.
+	PrivateRepos Scope = "private-repos"
+	// Admin allows managing keys, and implies every other scope.
+	Admin Scope = "admin"
+)
+
+// Scopes lists every scope.
+var Scopes = []Scope{Read, Refresh, PrivateRepos, Admin}
+
+// Key is an API key. Only a hash of its token is stored.
+type Key struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scopes  []Scope   `json:"scopes"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+}
+
+// Has reports whether the key grants a scope.
+func (k *Key) Has(scope Scope) bool {
+	return k != nil && (slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, Admin))
+}
+
+// tokenPrefix marks gographs API keys, e.g. in secret scanners.
+const tokenPrefix = "gg_"
+
+var (
+	// ErrInvalidKey is returned for tokens that are malformed, unknown or
+	// revoked.
+	ErrInvalidKey = errors.New("invalid API key")
+	// ErrNotFound is returned by Stores for unknown key IDs.
+	ErrNotFound = errors.New("API key not found")
+)
+
+// NewKey returns a new key with the given name and scopes, and its token. The
+// token is not stored, so it must be handed to the key's holder now.
+func NewKey(name string, scopes []Scope) (*Key, string, error) {
+	for _, s := range scopes {
+		if !slices.Contains(Scopes, s) {
+			return nil, "", fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, "", errors.New("at least one scope required")
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+	token := tokenPrefix + id + "_" + secret
+
+	return &Key{
+		ID:      id,
+		Name:    name,
+		Scopes:  slices.Clone(scopes),
+		Hash:    hash(token),
+		Created: time.Now().UTC(),
+	}, token, nil
+}
+
+// Authenticator resolves API tokens to keys.
+type Authenticator struct {
+	store Store
+	// bootstrap is an admin key configured outside the store, to create the
+	// first keys with.
+	bootstrap *Key
+}
+
+// bootstrapID identifies the bootstrap admin key.
+const bootstrapID = "bootstrap"
+
+// New returns an Authenticator for the keys in store. A non-empty adminToken
+// is also accepted as an admin key.
+func New(store Store, adminToken string) *Authenticator {
+	a := &Authenticator{store: store}
+	if adminToken != "" {
+		a.bootstrap = &Key{
+			ID:     bootstrapID,
+			Name:   bootstrapID,
+			Scopes: []Scope{Admin},
+			Hash:   hash(adminToken),
+		}
+	}
+	return a
+}
+
+// Store returns the store of keys.
+func (a *Authenticator) Store() Store {
+	return a.store
+}
+
+// Authenticate returns the key for a token.
+func (a *Authenticator) Authenticate(token string) (*Key, error) {
+	if a.bootstrap != nil && subtle.ConstantTimeCompare([]byte(a.bootstrap.Hash), []byte(hash(token))) == 1 {
+		return a.bootstrap, nil
+	}
+
+	rest, ok := strings.CutPrefix(token, tokenPrefix)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	id, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	key, err := a.store.Get(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash(token))) != 1 {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type contextKey struct{}
+
+// FromContext returns the key that authenticated a request, or nil for
+// anonymous requests.
+func FromContext(ctx context.Context) *Key {
+	key, _ := ctx.Value(contextKey{}).(*Key)
+	return key
+}
+
+// WithKey returns a copy of ctx carrying the key that authenticated a request.
+func WithKey(ctx context.Context, key *Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newTestStore(t *testing.T) (Store, string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "keys.json")
+	store, err := NewFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, file
+}
+
+func TestAuthenticate(t *testing.T) {
+	store, _ := newTestStore(t)
+	key, token, err := NewKey("ci", []Scope{Read, Refresh})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(key); err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedToken, err := NewKey("old", []Scope{Read})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(revoked); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(token, tokenPrefix+key.ID+"_") {
+		t.Errorf("token %q, want %s<id>_<secret>", token, tokenPrefix)
+	}
+	if strings.Contains(key.Hash, token) {
+		t.Error("the key stores its token")
+	}
+
+	_, secret, _ := strings.Cut(strings.TrimPrefix(token, tokenPrefix), "_")
+	a := New(store, "bootstrap-secret")
+	testCases := []struct {
+		name  string
+		token string
+		id    string
+	}{
+		{"valid", token, key.ID},
+		{"bootstrap", "bootstrap-secret", bootstrapID},
+		{"revoked", revokedToken, ""},
+		{"wrong secret", tokenPrefix + key.ID + "_" + strings.Repeat("0", len(secret)), ""},
+		{"other key's secret", tokenPrefix + key.ID + "_" + strings.SplitN(revokedToken, "_", 3)[2], ""},
+		{"unknown id", tokenPrefix + "0000000000000000_" + secret, ""},
+		{"missing prefix", strings.TrimPrefix(token, tokenPrefix), ""},
+		{"missing secret", tokenPrefix + key.ID, ""},
+		{"empty", "", ""},
+		{"hash", key.Hash, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := a.Authenticate(tc.token)
+			if tc.id == "" {
+				if !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("Authenticate = %v, %v, want ErrInvalidKey", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != tc.id {
+				t.Errorf("Authenticate = key %s, want %s", got.ID, tc.id)
+			}
+		})
+	}
+
+	if _, err := New(store, "").Authenticate(""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("empty token without a bootstrap key: %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestBootstrapKey(t *testing.T) {
+	store, _ := newTestStore(t)
+	key, err := New(store, "bootstrap-secret").Authenticate("bootstrap-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range Scopes {
+		if !key.Has(s) {
+			t.Errorf("bootstrap key lacks %s", s)
+		}
+	}
+	if keys, _ := store.List(); len(keys) != 0 {
+		t.Errorf("bootstrap key was stored: %v", keys)
+	}
+}
+
+func TestHas(t *testing.T) {
+	testCases := []struct {
+		scopes []Scope
+		want   []Scope
+	}{
+		{[]Scope{Read}, []Scope{Read}},
+		{[]Scope{Read, Refresh}, []Scope{Read, Refresh}},
+		{[]Scope{PrivateRepos}, []Scope{PrivateRepos}},
+		{[]Scope{Admin}, Scopes},
+	}
+	for _, tc := range testCases {
+		key := &Key{Scopes: tc.scopes}
+		for _, s := range Scopes {
+			if got, want := key.Has(s), slices.Contains(tc.want, s); got != want {
+				t.Errorf("key with %v: Has(%s) = %t, want %t", tc.scopes, s, got, want)
+			}
+		}
+	}
+
+	var anonymous *Key
+	if anonymous.Has(Read) {
+		t.Error("a nil key has scopes")
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	if _, _, err := NewKey("none", nil); err == nil {
+		t.Error("NewKey without scopes succeeded")
+	}
+	if _, _, err := NewKey("bad", []Scope{Read, "write"}); err == nil {
+		t.Error("NewKey with an unknown scope succeeded")
+	}
+
+	a, ta, err := NewKey("a", []Scope{Read})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, tb, err := NewKey("b", []Scope{Read})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID == b.ID || ta == tb {
+		t.Error("keys are not random")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	store, file := newTestStore(t)
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("empty store created %s", file)
+	}
+
+	a, token, err := NewKey("a", []Scope{Read})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := NewKey("b", []Scope{Admin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Created = a.Created.Add(1)
+	for _, key := range []*Key{b, a} {
+		if err := store.Put(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Delete("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete(missing) = %v, want ErrNotFound", err)
+	}
+
+	// a new instance sees the keys on disk
+	reopened, err := NewFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := reopened.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !reflect.DeepEqual(*keys[0], *a) || !reflect.DeepEqual(*keys[1], *b) {
+		t.Errorf("List = %v, want [%v %v] oldest first", keys, a, b)
+	}
+	if key, err := New(reopened, "").Authenticate(token); err != nil || key.ID != a.ID {
+		t.Errorf("Authenticate after reopening = %v, %v", key, err)
+	}
+
+	if err := reopened.Delete(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err = NewFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Get(a.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(revoked) = %v, want ErrNotFound", err)
+	}
+	if _, err := New(reopened, "").Authenticate(token); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Authenticate(revoked) = %v, want ErrInvalidKey", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+
+	if err := os.WriteFile(file, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFile(file); err == nil {
+		t.Error("NewFile accepted invalid JSON")
+	}
+}
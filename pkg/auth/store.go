@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Store holds API keys. Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns a key by ID, or ErrNotFound.
+	Get(id string) (*Key, error)
+	// List returns every key, oldest first.
+	List() ([]*Key, error)
+	// Put adds or replaces a key.
+	Put(key *Key) error
+	// Delete revokes a key by ID, or returns ErrNotFound.
+	Delete(id string) error
+}
+
+// fileStore implements Store with a JSON file of keys, by ID. Each instance
+// reads the file once at startup, so it suits single-node deployments, or
+// read-only keys shared between replicas.
+type fileStore struct {
+	file string
+
+	mu   sync.Mutex
+	keys map[string]*Key
+}
+
+// NewFile returns a store of keys in a JSON file, creating it when the first
+// key is added.
+func NewFile(file string) (Store, error) {
+	s := &fileStore{file: file, keys: map[string]*Key{}}
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.keys); err != nil {
+		return nil, fmt.Errorf("invalid API keys %s: %w", file, err)
+	}
+	return s, nil
+}
+
+func (s *fileStore) Get(id string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return key, nil
+}
+
+func (s *fileStore) List() ([]*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+func (s *fileStore) Put(key *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.ID] = key
+	return s.save()
+}
+
+func (s *fileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.keys, id)
+	return s.save()
+}
+
+// save writes the keys via a temp file and rename, so a crash never leaves a
+// partial file.
+func (s *fileStore) save() error {
+	b, err := json.MarshalIndent(s.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.file), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.file)
+}
+
+func sortKeys(keys []*Key) {
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].Created.Equal(keys[j].Created) {
+			return keys[i].Created.Before(keys[j].Created)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+}
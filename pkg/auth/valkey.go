@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valkey-io/valkey-go"
+)
+
+// valkeyStore implements Store with a Valkey hash, so keys are shared across
+// replicas.
+type valkeyStore struct {
+	client valkey.Client
+}
+
+// apikeys[id] => [JSON Key]
+const apiKeys = "apikeys"
+
+// NewValkey returns a store of keys in a Valkey server.
+func NewValkey(addr string) (Store, error) {
+	client, err := valkey.NewClient(valkey.ClientOption{
+		InitAddress:  []string{addr},
+		DisableCache: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Do(context.Background(), client.B().Ping().Build()).Error()
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"valkey": addr}).Infof("Valkey API key store initialized")
+
+	return &valkeyStore{client: client}, nil
+}
+
+func (s *valkeyStore) Get(id string) (*Key, error) {
+	b, err := s.client.Do(
+		context.Background(),
+		s.client.B().Hget().Key(apiKeys).Field(id).Build(),
+	).AsBytes()
+	if valkey.IsValkeyNil(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var key Key
+	if err := json.Unmarshal(b, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *valkeyStore) List() ([]*Key, error) {
+	values, err := s.client.Do(
+		context.Background(),
+		s.client.B().Hvals().Key(apiKeys).Build(),
+	).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*Key, 0, len(values))
+	for _, v := range values {
+		var key Key
+		if err := json.Unmarshal([]byte(v), &key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+func (s *valkeyStore) Put(key *Key) error {
+	b, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return s.client.Do(
+		context.Background(),
+		s.client.B().Hset().Key(apiKeys).FieldValue().FieldValue(key.ID, string(b)).Build(),
+	).Error()
+}
+
+func (s *valkeyStore) Delete(id string) error {
+	n, err := s.client.Do(
+		context.Background(),
+		s.client.B().Hdel().Key(apiKeys).Field(id).Build(),
+	).AsInt64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
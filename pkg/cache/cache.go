@@ -1,159 +1,317 @@
 package cache
 
 import (
-	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
-	"github.com/valkey-io/valkey-go"
 )
 
-// Cache holds Valkey client and log state.
+// Cache stores rendered graphs and repo popularity scores in a Store, and
+// tracks how fresh each graph is.
 type Cache struct {
-	client valkey.Client
-	log    *log.Entry
+	store Store
+	log   *log.Entry
+
+	ttl      time.Duration
+	staleTTL time.Duration
+
+	// revalidating holds the keys of entries being rebuilt in the background.
+	revalidating   map[Key]bool
+	revalidatingMu sync.Mutex
+}
+
+// Store is a cache backend. Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns a cached graph and when it was created, or ErrMiss.
+	Get(key Key) (value string, created time.Time, err error)
+	// Set caches a graph. The store may evict it after expiry.
+	Set(key Key, value string, created time.Time, expiry time.Duration) error
+	// Clear deletes every graph cached for a repo.
+	Clear(repo string) error
+
+	// IncrScore counts a view of a repo by a client at now. Each client counts
+	// once per repo per hour.
+	IncrScore(repo, client string, now time.Time) error
+	// Scores returns up to limit repos, most viewed over the window before now
+	// first. A zero window ranks repos over all time.
+	Scores(window time.Duration, limit int, now time.Time) ([]string, error)
+
+	// Lock takes a named lock for ttl, unless it is already held. Locks are
+	// not released early; they expire.
+	Lock(name string, ttl time.Duration) (bool, error)
+
+	// Count increments a named counter that resets every window, returning
+	// its count and how long until it resets.
+	Count(name string, window time.Duration) (int64, time.Duration, error)
+
+	// SetJob saves a background job's state, replacing any earlier state, and
+	// keeps it for expiry. Jobs are kept apart from graphs, so they are never
+	// evicted to make room for graphs, nor cleared with them.
+	SetJob(id, value string, expiry time.Duration) error
+	// GetJob returns a job's state, or ErrMiss.
+	GetJob(id string) (string, error)
+}
+
+// Key identifies a cached graph: its format, repo, and a variant that
+// distinguishes render options within a format.
+type Key struct {
+	Format  string
+	Repo    string
+	Variant string
 }
 
+// ErrMiss is returned by Stores for graphs that are not cached.
+var ErrMiss = errors.New("cache miss")
+
+// Backends that Open accepts.
 const (
-	// dot[repo+cluster]
-	// github.com/siggy/gographs+false
-	// =>
-	// [dot file]
-	dotHash = "dot"
-
-	// svg[repo+cluster]
-	// github.com/siggy/gographs+false
-	// =>
-	// [svg file]
-	svgHash = "svg"
-
-	// repo-scores[repo]
-	// github.com/siggy/gographs
-	// =>
-	// [numeric popularity score]
-	repoScores = "reposcores"
+	Valkey     = "valkey"
+	Memory     = "memory"
+	Filesystem = "fs"
 )
 
-// New initializes a new cache client.
-func New(addr string) (*Cache, error) {
-	client, err := valkey.NewClient(valkey.ClientOption{
-		InitAddress: []string{addr},
-	})
-	if err != nil {
-		return nil, err
-	}
+// Defaults for how long entries are fresh, and then how long they may be
+// served stale while they are rebuilt.
+const (
+	DefaultTTL      = 24 * time.Hour
+	DefaultStaleTTL = 7 * 24 * time.Hour
+)
 
-	ctx := context.Background()
+// JobTTL is how long a job's state is kept after its last update.
+const JobTTL = 24 * time.Hour
 
-	err = client.Do(ctx, client.B().Ping().Build()).Error()
-	if err != nil {
-		return nil, err
-	}
+// MaxScores caps the number of repos returned by RepoScores.
+const MaxScores = 1000
+
+// Entry is a cached graph.
+type Entry struct {
+	// stored is the graph as stored, which may be gzipped.
+	stored string
+	// Created is when the graph was rendered.
+	Created time.Time
+	// Age is how long ago the graph was rendered.
+	Age time.Duration
+	// MaxAge is how much longer the graph is fresh. Zero once it is stale.
+	MaxAge time.Duration
+	// Stale reports whether the graph has outlived its TTL. Stale graphs are
+	// served while a rebuild is queued.
+	Stale bool
+}
+
+// Value returns the graph, decompressing it if needed.
+func (e Entry) Value() (string, error) {
+	return decompress(e.stored)
+}
 
-	log := log.WithFields(
-		log.Fields{
-			"cache": addr,
-		},
-	)
+// Gzip returns the graph gzipped, if it was stored that way, so it can be
+// served without a decompress/recompress round trip.
+func (e Entry) Gzip() (string, bool) {
+	return strings.CutPrefix(e.stored, gzipHeader)
+}
+
+// Hash identifies the graph's content, for use in entity tags. It is the same
+// however the graph is stored.
+func (e Entry) Hash() string {
+	return storedHash(e.stored)
+}
 
-	registerGauges(client)
+// WithValue returns a copy of the entry holding value, such as the graph
+// transformed for a request.
+func (e Entry) WithValue(value string) Entry {
+	e.stored = value
+	return e
+}
 
-	log.Infof("Cache initialized")
+// Config selects and configures a cache backend.
+type Config struct {
+	// Backend is one of Valkey, Memory or Filesystem.
+	Backend string
+
+	// ValkeyAddr is the Valkey server address.
+	ValkeyAddr string
+	// LocalBytes bounds the in-process cache kept in front of Valkey. Zero
+	// disables it.
+	LocalBytes int
+
+	// MemoryEntries is the maximum number of graphs held by the memory backend.
+	MemoryEntries int
+
+	// Dir is the directory for the filesystem backend.
+	Dir string
+}
+
+// Open returns the Store for a backend.
+func Open(cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case Valkey:
+		return NewValkey(cfg.ValkeyAddr, cfg.LocalBytes)
+	case Memory:
+		return NewMemory(cfg.MemoryEntries)
+	case Filesystem:
+		return NewFS(cfg.Dir)
+	default:
+		return nil, fmt.Errorf("unknown cache %q, must be one of: %s, %s, %s", cfg.Backend, Valkey, Memory, Filesystem)
+	}
+}
+
+// New initializes a new cache. Entries are fresh for ttl, and then served
+// stale for up to staleTTL while they are rebuilt.
+func New(store Store, ttl, staleTTL time.Duration) (*Cache, error) {
+	if ttl < time.Second || staleTTL < 0 {
+		return nil, fmt.Errorf("invalid cache ttls: ttl %s must be at least 1s, stale ttl %s must not be negative", ttl, staleTTL)
+	}
 
 	return &Cache{
-		client: client,
-		log:    log,
+		store:        store,
+		log:          log.WithFields(log.Fields{"cache": fmt.Sprintf("%T", store)}),
+		ttl:          ttl,
+		staleTTL:     staleTTL,
+		revalidating: map[Key]bool{},
 	}, nil
 }
 
+// TTL returns how long entries are fresh.
+func (c *Cache) TTL() time.Duration {
+	return c.ttl
+}
+
+// StaleTTL returns how long entries may be served once stale.
+func (c *Cache) StaleTTL() time.Duration {
+	return c.staleTTL
+}
+
 // Clear deletes all cache entries relevant to a GoLang repo.
 func (c *Cache) Clear(repo string) error {
-	var rerr error
-	_, err := c.hdel(dotHash, repoKey(repo, false))
-	if err != nil && rerr == nil {
-		rerr = err
-	}
-	_, err = c.hdel(dotHash, repoKey(repo, true))
-	if err != nil && rerr == nil {
-		rerr = err
-	}
+	return c.store.Clear(repo)
+}
+
+// Set caches a rendered graph for a repo, gzipped when that makes it smaller.
+// The variant distinguishes render options within a format.
+func (c *Cache) Set(format, repo, variant, value string) {
+	key := Key{format, repo, variant}
+	c.log.Tracef("set[%v]", key)
 
-	_, err = c.hdel(svgHash, repoKey(repo, false))
-	if err != nil && rerr == nil {
-		rerr = err
+	if err := c.store.Set(key, compress(value), time.Now(), c.ttl+c.staleTTL); err != nil {
+		c.log.Errorf("Set %s failed: %s", format, err)
 	}
-	_, err = c.hdel(svgHash, repoKey(repo, true))
-	if err != nil && rerr == nil {
-		rerr = err
+}
+
+// Get gets a rendered graph for a repo. It returns an error if the graph is
+// not cached.
+func (c *Cache) Get(format, repo, variant string) (Entry, error) {
+	key := Key{format, repo, variant}
+	c.log.Tracef("get[%v]", key)
+
+	value, created, err := c.store.Get(key)
+	if err != nil {
+		cacheRequests.WithLabelValues(format, miss).Inc()
+		return Entry{}, err
 	}
 
-	return rerr
+	entry := newEntry(value, created, c.ttl)
+	result := hit
+	if entry.Stale {
+		result = stale
+	}
+	cacheRequests.WithLabelValues(format, result).Inc()
+	return entry, nil
 }
 
-// SetSVG sets an SVG for a repo.
-func (c *Cache) SetSVG(repo string, cluster bool, svg string) {
-	if err := c.hset(svgHash, repoKey(repo, cluster), svg); err != nil {
-		c.log.Errorf("SetSVG failed: %s", err)
+// Revalidate rebuilds a stale graph in the background and caches the result.
+// Rebuilds already underway for the same graph are not repeated.
+func (c *Cache) Revalidate(format, repo, variant string, rebuild func() (string, error)) {
+	key := Key{format, repo, variant}
+
+	c.revalidatingMu.Lock()
+	if c.revalidating[key] {
+		c.revalidatingMu.Unlock()
+		return
 	}
-}
+	c.revalidating[key] = true
+	c.revalidatingMu.Unlock()
 
-// GetSVG gets an SVG for a repo.
-func (c *Cache) GetSVG(repo string, cluster bool) (string, error) {
-	return c.hget(svgHash, repoKey(repo, cluster))
+	go func() {
+		defer func() {
+			c.revalidatingMu.Lock()
+			delete(c.revalidating, key)
+			c.revalidatingMu.Unlock()
+		}()
+
+		c.log.Debugf("Revalidating %v", key)
+		value, err := rebuild()
+		if err != nil {
+			c.log.Errorf("Revalidate %v failed: %s", key, err)
+			revalidations.WithLabelValues(format, failure).Inc()
+			return
+		}
+		c.Set(format, repo, variant, value)
+		revalidations.WithLabelValues(format, success).Inc()
+	}()
 }
 
-// SetDOT sets a DOT for a repo.
-func (c *Cache) SetDOT(repo string, cluster bool, dot string) {
-	if err := c.hset(dotHash, repoKey(repo, cluster), dot); err != nil {
-		c.log.Errorf("SetDOT failed: %s", err)
-	}
+// NewEntry returns an entry for a graph rendered just now, stored as Set
+// stores it, so it is served with the same encoding and ETag as its cached
+// copy.
+func (c *Cache) NewEntry(value string) Entry {
+	return newEntry(compress(value), time.Now(), c.ttl)
 }
 
-// GetDOT gets a DOT for a repo.
-func (c *Cache) GetDOT(repo string, cluster bool) (string, error) {
-	return c.hget(dotHash, repoKey(repo, cluster))
+func newEntry(stored string, created time.Time, ttl time.Duration) Entry {
+	age := max(time.Since(created), 0)
+	return Entry{
+		stored:  stored,
+		Created: created,
+		Age:     age,
+		MaxAge:  max(ttl-age, 0),
+		Stale:   age >= ttl,
+	}
 }
 
-// RepoScoreIncr increments the popularity score for a repo.
-func (c *Cache) RepoScoreIncr(repo string) {
-	c.client.Do(
-		context.Background(),
-		c.client.B().Zincrby().Key(repoScores).Increment(1).Member(repo).Build(),
-	)
+// RepoScoreIncr counts a view of a repo by a client, such as its IP address.
+// Repeat views by the same client within the hour are not counted.
+func (c *Cache) RepoScoreIncr(repo, client string) {
+	if err := c.store.IncrScore(repo, clientID(client), time.Now()); err != nil {
+		c.log.Errorf("RepoScoreIncr failed: %s", err)
+	}
 }
 
-// RepoScores returns the top-10 most popular repos
-func (c *Cache) RepoScores() ([]string, error) {
-	return c.client.Do(
-		context.Background(),
-		c.client.B().Zrevrangebyscore().Key(repoScores).
-			Max("+inf").Min("0").Limit(0, 1000).Build(),
-	).AsStrSlice()
+// RepoScores returns up to limit repos, most viewed over window first. A zero
+// window ranks repos over all time.
+func (c *Cache) RepoScores(window time.Duration, limit int) ([]string, error) {
+	if window < 0 || window > MaxScoreWindow || window%scoreBucket != 0 {
+		return nil, fmt.Errorf("invalid score window: %s", window)
+	}
+	if limit < 1 || limit > MaxScores {
+		return nil, fmt.Errorf("invalid score limit %d, must be between 1 and %d", limit, MaxScores)
+	}
+	return c.store.Scores(window, limit, time.Now())
 }
 
-func (c *Cache) hget(key, field string) (string, error) {
-	c.log.Tracef("hget[%s,%s]", key, field)
-	return c.client.Do(
-		context.Background(), c.client.B().Hget().Key(key).Field(field).Build(),
-	).ToString()
+// Lock takes a named lock for ttl, shared with other instances using the same
+// store, and reports whether it was taken. A lock held elsewhere is not taken
+// until it expires.
+func (c *Cache) Lock(name string, ttl time.Duration) (bool, error) {
+	return c.store.Lock(name, ttl)
 }
 
-func (c *Cache) hset(key, field string, value string) error {
-	c.log.Tracef("hset[%s,%s]", key, field)
-	return c.client.Do(
-		context.Background(),
-		c.client.B().Hset().Key(key).FieldValue().FieldValue(field, value).Build(),
-	).Error()
+// Count increments a named counter, shared with other instances using the same
+// store, that resets every window. It returns the count within the current
+// window, and how long until the window resets.
+func (c *Cache) Count(name string, window time.Duration) (int64, time.Duration, error) {
+	return c.store.Count(name, window)
 }
 
-func (c *Cache) hdel(key, field string) (int64, error) {
-	c.log.Debugf("hdel[%s,%s]", key, field)
-	return c.client.Do(
-		context.Background(),
-		c.client.B().Hdel().Key(key).Field(field).Build(),
-	).AsInt64()
+// SetJob saves a background job's state, shared with other instances using
+// the same store, for JobTTL.
+func (c *Cache) SetJob(id, value string) error {
+	return c.store.SetJob(id, value, JobTTL)
 }
 
-func repoKey(repo string, cluster bool) string {
-	return fmt.Sprintf("%s+%t", repo, cluster)
+// Job returns a job's state, or ErrMiss if it is unknown or has expired.
+func (c *Cache) Job(id string) (string, error) {
+	return c.store.GetJob(id)
 }
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEntryHash checks that a freshly rendered graph has the same ETag as its
+// cached copy, so clients revalidating after the first build get a 304.
+func TestEntryHash(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+		gzip  bool
+	}{
+		{"gzipped", strings.Repeat(`<g class="node"></g>`, 100), true},
+		{"raw", "\x89PNG", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := NewMemory(DefaultMemoryEntries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := New(store, time.Hour, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fresh := c.NewEntry(tc.value)
+			c.Set("svg", "github.com/siggy/gographs", "false", tc.value)
+			cached, err := c.Get("svg", "github.com/siggy/gographs", "false")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fresh.Hash() != cached.Hash() {
+				t.Errorf("fresh hash %s, cached hash %s", fresh.Hash(), cached.Hash())
+			}
+			if want := contentHash(tc.value); fresh.Hash() != want {
+				t.Errorf("hash %s, want %s", fresh.Hash(), want)
+			}
+			_, freshGzip := fresh.Gzip()
+			_, cachedGzip := cached.Gzip()
+			if freshGzip != tc.gzip || cachedGzip != tc.gzip {
+				t.Errorf("gzipped fresh %t, cached %t, want %t", freshGzip, cachedGzip, tc.gzip)
+			}
+		})
+	}
+}
+
+// TestEntryHashUncommented checks entries gzipped before the hash was kept in
+// the gzip header.
+func TestEntryHashUncommented(t *testing.T) {
+	value := strings.Repeat("a -> b\n", 100)
+
+	var buf bytes.Buffer
+	buf.WriteString(gzipHeader)
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(value)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := newEntry(buf.String(), time.Now(), time.Hour)
+	if want := contentHash(value); e.Hash() != want {
+		t.Errorf("hash %s, want %s", e.Hash(), want)
+	}
+}
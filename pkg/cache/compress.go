@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+// gzipHeader prefixes stored values that are gzipped. Rendered graphs never
+// begin with a NUL byte, so values stored raw, including entries written
+// before compression, still read as they are.
+const gzipHeader = "\x00gzip\n"
+
+// compress gzips a value for storage, prefixed with gzipHeader. Values that do
+// not shrink, such as PNGs, are stored raw. The gzip header's comment holds
+// the value's hash, so it can be read without decompressing.
+func compress(value string) string {
+	var buf bytes.Buffer
+	buf.WriteString(gzipHeader)
+	zw := gzip.NewWriter(&buf)
+	zw.Comment = contentHash(value)
+	if _, err := io.WriteString(zw, value); err != nil {
+		return value
+	}
+	if err := zw.Close(); err != nil {
+		return value
+	}
+	if buf.Len() >= len(value) {
+		return value
+	}
+	return buf.String()
+}
+
+// contentHash identifies a value, for use in entity tags.
+func contentHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:16])
+}
+
+// storedHash returns the hash of a stored value's content, read from its gzip
+// header if it has one.
+func storedHash(stored string) string {
+	if gz, ok := strings.CutPrefix(stored, gzipHeader); ok {
+		zr, err := gzip.NewReader(strings.NewReader(gz))
+		if err == nil && zr.Comment != "" {
+			return zr.Comment
+		}
+	}
+	// raw values, and gzipped values stored before hashes were
+	value, err := decompress(stored)
+	if err != nil {
+		value = stored
+	}
+	return contentHash(value)
+}
+
+// decompress returns a stored value as it was cached.
+func decompress(stored string) (string, error) {
+	gz, ok := strings.CutPrefix(stored, gzipHeader)
+	if !ok {
+		return stored, nil
+	}
+	zr, err := gzip.NewReader(strings.NewReader(gz))
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if _, err := io.Copy(&sb, zr); err != nil {
+		return "", err
+	}
+	return sb.String(), zr.Close()
+}
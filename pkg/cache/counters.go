@@ -0,0 +1,40 @@
+package cache
+
+import "time"
+
+// counters keeps fixed-window counters for stores without Valkey. It is not
+// safe for concurrent use.
+type counters struct {
+	windows map[string]*counter
+	pruned  time.Time
+}
+
+type counter struct {
+	count int64
+	reset time.Time
+}
+
+func newCounters() *counters {
+	return &counters{windows: map[string]*counter{}}
+}
+
+// incr increments a counter, starting a new window if the last one ended,
+// and returns its count and how long until it resets.
+func (c *counters) incr(name string, window time.Duration, now time.Time) (int64, time.Duration) {
+	if now.Sub(c.pruned) >= time.Minute {
+		for n, w := range c.windows {
+			if !now.Before(w.reset) {
+				delete(c.windows, n)
+			}
+		}
+		c.pruned = now
+	}
+
+	w, ok := c.windows[name]
+	if !ok || !now.Before(w.reset) {
+		w = &counter{reset: now.Add(window)}
+		c.windows[name] = w
+	}
+	w.count++
+	return w.count, w.reset.Sub(now)
+}
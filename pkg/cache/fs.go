@@ -0,0 +1,299 @@
+package cache
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fsStore implements Store with files in a directory, so the cache survives
+// restarts without a Valkey server. It suits single-node deployments.
+//
+//	[dir]/graph/[format]/[repo]/[variant]
+//	=>
+//	[created unix seconds] [expires unix seconds]
+//	[rendered graph]
+//
+//	[dir]/scores.json holds all-time and hourly repo popularity scores. They
+//	are kept in memory, and written out at most every fsScoresFlush, so
+//	views don't each rewrite the file. Views in the last interval before
+//	the process exits are lost.
+//
+//	[dir]/job/[id]
+//	=>
+//	[expires unix milliseconds]
+//	[job state]
+//
+//	[dir]/lock/[name] holds a lock, and its expiry in unix milliseconds.
+//	[dir]/lock.guard is flocked while a lock is checked and taken.
+//
+// Expired files are removed when next read.
+type fsStore struct {
+	dir string
+
+	scoresMu sync.Mutex
+	scores   *scoreBoard
+	// flushTimer is set while views wait to be written out.
+	flushTimer  *time.Timer
+	scoresFlush time.Duration
+
+	// counters are kept in process, as they only last a short window.
+	countersMu sync.Mutex
+	counters   *counters
+}
+
+const (
+	fsGraphDir   = "graph"
+	fsScoresFile = "scores.json"
+	fsJobDir     = "job"
+	fsLockDir    = "lock"
+	fsLockGuard  = "lock.guard"
+
+	fsScoresFlush = 10 * time.Second
+
+	// maxFileName keeps escaped names under common filesystem limits.
+	maxFileName = 200
+)
+
+// NewFS returns a store that keeps graphs in dir, creating it if needed.
+func NewFS(dir string) (Store, error) {
+	if dir == "" {
+		return nil, errors.New("cache directory required")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, fsGraphDir), 0o700); err != nil {
+		return nil, err
+	}
+
+	s := &fsStore{
+		dir:         dir,
+		scores:      newScoreBoard(),
+		scoresFlush: fsScoresFlush,
+		counters:    newCounters(),
+	}
+	b, err := os.ReadFile(filepath.Join(dir, fsScoresFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := readScores(b, s.scores); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", fsScoresFile, err)
+		}
+	}
+
+	log.Infof("Filesystem cache initialized in %s", dir)
+
+	return s, nil
+}
+
+func (s *fsStore) Get(key Key) (string, time.Time, error) {
+	file := s.path(key)
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", time.Time{}, ErrMiss
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var created, expires int64
+	if _, err := fmt.Fscanf(r, "%d %d\n", &created, &expires); err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid cache file %s: %w", file, err)
+	}
+	if time.Now().Unix() >= expires {
+		os.Remove(file)
+		return "", time.Time{}, ErrMiss
+	}
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return string(value), time.Unix(created, 0), nil
+}
+
+func (s *fsStore) Set(key Key, value string, created time.Time, expiry time.Duration) error {
+	header := fmt.Sprintf("%d %d\n", created.Unix(), created.Add(expiry).Unix())
+	return writeFileAtomic(s.path(key), []byte(header+value))
+}
+
+func (s *fsStore) Clear(repo string) error {
+	formats, err := os.ReadDir(filepath.Join(s.dir, fsGraphDir))
+	if err != nil {
+		return err
+	}
+	for _, format := range formats {
+		err := os.RemoveAll(filepath.Join(s.dir, fsGraphDir, format.Name(), fileName(repo)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fsStore) IncrScore(repo, client string, now time.Time) error {
+	s.scoresMu.Lock()
+	defer s.scoresMu.Unlock()
+
+	if s.scores.incr(repo, client, now) && s.flushTimer == nil {
+		s.flushTimer = time.AfterFunc(s.scoresFlush, s.flushScores)
+	}
+	return nil
+}
+
+// flushScores writes the scores out now, if views are waiting to be written.
+func (s *fsStore) flushScores() {
+	s.scoresMu.Lock()
+	defer s.scoresMu.Unlock()
+
+	if s.flushTimer == nil {
+		return
+	}
+	s.flushTimer.Stop()
+	s.flushTimer = nil
+
+	b, err := json.Marshal(s.scores)
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(s.dir, fsScoresFile), b)
+	}
+	if err != nil {
+		log.Errorf("Failed to write %s: %s", fsScoresFile, err)
+	}
+}
+
+func (s *fsStore) Scores(window time.Duration, limit int, now time.Time) ([]string, error) {
+	s.scoresMu.Lock()
+	defer s.scoresMu.Unlock()
+
+	return s.scores.top(window, limit, now), nil
+}
+
+// readScores loads a scores file into board. Files from before hourly scores
+// hold a plain map of all-time scores.
+func readScores(b []byte, board *scoreBoard) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	if _, ok := fields["all"]; !ok {
+		return json.Unmarshal(b, &board.All)
+	}
+	return json.Unmarshal(b, board)
+}
+
+func (s *fsStore) Lock(name string, ttl time.Duration) (bool, error) {
+	file := filepath.Join(s.dir, fsLockDir, fileName(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return false, err
+	}
+
+	// Check and take the lock under the guard, so of the instances that find
+	// it expired, only one takes it over.
+	unlock, err := lockFile(filepath.Join(s.dir, fsLockGuard))
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	b, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	if err == nil {
+		expires, err := strconv.ParseInt(string(b), 10, 64)
+		if err == nil && time.Now().UnixMilli() < expires {
+			return false, nil
+		}
+	}
+
+	err = writeFileAtomic(file, []byte(strconv.FormatInt(time.Now().Add(ttl).UnixMilli(), 10)))
+	return err == nil, err
+}
+
+func (s *fsStore) Count(name string, window time.Duration) (int64, time.Duration, error) {
+	s.countersMu.Lock()
+	defer s.countersMu.Unlock()
+
+	count, reset := s.counters.incr(name, window, time.Now())
+	return count, reset, nil
+}
+
+func (s *fsStore) SetJob(id, value string, expiry time.Duration) error {
+	header := strconv.FormatInt(time.Now().Add(expiry).UnixMilli(), 10) + "\n"
+	return writeFileAtomic(filepath.Join(s.dir, fsJobDir, fileName(id)), []byte(header+value))
+}
+
+func (s *fsStore) GetJob(id string) (string, error) {
+	file := filepath.Join(s.dir, fsJobDir, fileName(id))
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrMiss
+	}
+	if err != nil {
+		return "", err
+	}
+	header, value, ok := strings.Cut(string(b), "\n")
+	expires, err := strconv.ParseInt(header, 10, 64)
+	if !ok || err != nil {
+		return "", fmt.Errorf("invalid job file %s", file)
+	}
+	if time.Now().UnixMilli() >= expires {
+		os.Remove(file)
+		return "", ErrMiss
+	}
+	return value, nil
+}
+
+func (s *fsStore) path(key Key) string {
+	return filepath.Join(s.dir, fsGraphDir, fileName(key.Format), fileName(key.Repo), fileName(key.Variant))
+}
+
+// fileName escapes a key part for use as a single path element, hashing parts
+// too long for the filesystem.
+func fileName(part string) string {
+	name := url.PathEscape(part)
+	if name == "." || name == ".." {
+		name = url.PathEscape(name + "/")
+	}
+	if len(name) > maxFileName {
+		sum := sha256.Sum256([]byte(part))
+		name = hex.EncodeToString(sum[:])
+	}
+	return name
+}
+
+// writeFileAtomic writes a file via a temp file and rename, so readers never
+// see a partial write.
+func writeFileAtomic(file string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
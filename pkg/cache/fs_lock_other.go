@@ -0,0 +1,14 @@
+//go:build !unix
+
+package cache
+
+import "sync"
+
+var lockFileMu sync.Mutex
+
+// lockFile excludes other goroutines only, as flock is unavailable. Instances
+// sharing a cache directory need a unix system to exclude one another.
+func lockFile(string) (func(), error) {
+	lockFileMu.Lock()
+	return lockFileMu.Unlock, nil
+}
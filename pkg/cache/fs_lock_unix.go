@@ -0,0 +1,24 @@
+//go:build unix
+
+package cache
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive flock of file, creating it if needed, and
+// returns a func that releases it. Processes and goroutines each opening the
+// file exclude one another.
+func lockFile(file string) (func(), error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// closing the file releases the flock
+	return func() { f.Close() }, nil
+}
@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultMemoryEntries bounds the in-memory cache when no size is given.
+const DefaultMemoryEntries = 1000
+
+// memoryStore implements Store in process memory, evicting the least recently
+// used graphs beyond a fixed number of entries. Nothing survives a restart.
+type memoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	lru        *list.List // of *memoryEntry, most recently used first
+	entries    map[Key]*list.Element
+	scores     *scoreBoard
+	locks      map[string]time.Time // by name, when each lock expires
+	counters   *counters
+	// jobs are kept outside the LRU, so graphs never evict them.
+	jobs map[string]memoryJob
+}
+
+type memoryJob struct {
+	value   string
+	expires time.Time
+}
+
+type memoryEntry struct {
+	key     Key
+	value   string
+	created time.Time
+	expires time.Time
+}
+
+// NewMemory returns an in-memory store holding up to maxEntries graphs.
+func NewMemory(maxEntries int) (Store, error) {
+	if maxEntries <= 0 {
+		return nil, fmt.Errorf("invalid memory cache size: %d", maxEntries)
+	}
+
+	log.Infof("Memory cache initialized with %d entries", maxEntries)
+
+	return &memoryStore{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    map[Key]*list.Element{},
+		scores:     newScoreBoard(),
+		locks:      map[string]time.Time{},
+		counters:   newCounters(),
+		jobs:       map[string]memoryJob{},
+	}, nil
+}
+
+func (s *memoryStore) Get(key Key) (string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return "", time.Time{}, ErrMiss
+	}
+	e := el.Value.(*memoryEntry)
+	if time.Now().After(e.expires) {
+		s.remove(el)
+		return "", time.Time{}, ErrMiss
+	}
+	s.lru.MoveToFront(el)
+	return e.value, e.created, nil
+}
+
+func (s *memoryStore) Set(key Key, value string, created time.Time, expiry time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &memoryEntry{key: key, value: value, created: created, expires: created.Add(expiry)}
+	if el, ok := s.entries[key]; ok {
+		el.Value = e
+		s.lru.MoveToFront(el)
+		return nil
+	}
+
+	s.entries[key] = s.lru.PushFront(e)
+	for s.lru.Len() > s.maxEntries {
+		s.remove(s.lru.Back())
+	}
+	return nil
+}
+
+func (s *memoryStore) Clear(repo string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, el := range s.entries {
+		if key.Repo == repo {
+			s.remove(el)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) IncrScore(repo, client string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scores.incr(repo, client, now)
+	return nil
+}
+
+func (s *memoryStore) Scores(window time.Duration, limit int, now time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.scores.top(window, limit, now), nil
+}
+
+func (s *memoryStore) Lock(name string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(s.locks[name]) {
+		return false, nil
+	}
+	s.locks[name] = now.Add(ttl)
+	return true, nil
+}
+
+func (s *memoryStore) Count(name string, window time.Duration) (int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count, reset := s.counters.incr(name, window, time.Now())
+	return count, reset, nil
+}
+
+func (s *memoryStore) SetJob(id, value string, expiry time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for other, job := range s.jobs {
+		if !now.Before(job.expires) {
+			delete(s.jobs, other)
+		}
+	}
+	s.jobs[id] = memoryJob{value: value, expires: now.Add(expiry)}
+	return nil
+}
+
+func (s *memoryStore) GetJob(id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok || !time.Now().Before(job.expires) {
+		return "", ErrMiss
+	}
+	return job.value, nil
+}
+
+func (s *memoryStore) remove(el *list.Element) {
+	s.lru.Remove(el)
+	delete(s.entries, el.Value.(*memoryEntry).key)
+}
+
+// topScores returns up to limit repos, highest score first.
+func topScores(scores map[string]float64, limit int) []string {
+	repos := make([]string, 0, len(scores))
+	for repo := range scores {
+		repos = append(repos, repo)
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		if scores[repos[i]] != scores[repos[j]] {
+			return scores[repos[i]] > scores[repos[j]]
+		}
+		return repos[i] < repos[j]
+	})
+	if len(repos) > limit {
+		repos = repos[:limit]
+	}
+	return repos
+}
@@ -8,18 +8,55 @@ import (
 	"github.com/valkey-io/valkey-go"
 )
 
+const (
+	formatLabel = "format"
+	resultLabel = "result"
+
+	hit  = "hit"
+	miss = "miss"
+	// stale entries are served while they are revalidated
+	stale = "stale"
+
+	success = "success"
+	failure = "failure"
+)
+
+var (
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gographs",
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Count of cache lookups, by result: hit, miss or stale.",
+	}, []string{formatLabel, resultLabel})
+
+	localHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gographs",
+		Subsystem: "cache",
+		Name:      "local_hits_total",
+		Help:      "Count of Valkey lookups served from the in-process cache.",
+	}, []string{formatLabel})
+
+	revalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gographs",
+		Subsystem: "cache",
+		Name:      "revalidations_total",
+		Help:      "Count of background rebuilds of stale entries, by result.",
+	}, []string{formatLabel, resultLabel})
+)
+
 func registerGauges(client valkey.Client) {
-	registerHashGauge(client, dotHash)
-	registerHashGauge(client, svgHash)
+	registerKeysGauge(client, "keys")
 	registerSetGauge(client, repoScores)
 }
 
-func registerHashGauge(client valkey.Client, key string) {
+// registerKeysGauge counts every key in the database, as graph entries are
+// stored one per key.
+func registerKeysGauge(client valkey.Client, key string) {
 	registerGauge(
 		func() float64 {
 			size, _ := client.Do(
 				context.Background(),
-				client.B().Hlen().Key(key).Build(),
+				client.B().Dbsize().Build(),
 			).AsInt64()
 			return float64(size)
 		},
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Repo popularity is counted in hourly buckets, so top repos can be ranked over
+// a recent window as well as all time. Each client counts once per repo per
+// hour.
+const (
+	scoreBucket = time.Hour
+
+	// MaxScoreWindow is the longest window, short of all time, that scores
+	// are kept for.
+	MaxScoreWindow = 7 * 24 * time.Hour
+)
+
+// ScoreWindows are the windows RepoScores accepts, by name. A zero window
+// ranks repos over all time.
+var ScoreWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  MaxScoreWindow,
+	"all": 0,
+}
+
+// Defaults for RepoScores.
+const (
+	DefaultScoreWindow = "7d"
+	DefaultScoreLimit  = 10
+)
+
+// bucketOf returns the start of the bucket counting views at t, in unix
+// seconds.
+func bucketOf(t time.Time) int64 {
+	return t.Truncate(scoreBucket).Unix()
+}
+
+// bucketsIn returns the buckets covering window up to now, newest first.
+func bucketsIn(window time.Duration, now time.Time) []int64 {
+	n := int(window / scoreBucket)
+	buckets := make([]int64, n)
+	for i := range buckets {
+		buckets[i] = bucketOf(now.Add(-time.Duration(i) * scoreBucket))
+	}
+	return buckets
+}
+
+// clientID hashes a client address, so stores never hold raw IPs.
+func clientID(client string) string {
+	sum := sha256.Sum256([]byte(client))
+	return hex.EncodeToString(sum[:8])
+}
+
+// scoreBoard keeps all-time and hourly repo scores for stores without Valkey.
+// It is not safe for concurrent use.
+type scoreBoard struct {
+	All   map[string]float64           `json:"all"`
+	Hours map[int64]map[string]float64 `json:"hours"`
+
+	// seen holds the client and repo pairs counted in each bucket.
+	seen map[int64]map[string]bool
+}
+
+func newScoreBoard() *scoreBoard {
+	return &scoreBoard{
+		All:   map[string]float64{},
+		Hours: map[int64]map[string]float64{},
+		seen:  map[int64]map[string]bool{},
+	}
+}
+
+// incr counts a view of repo by client, unless the client was already counted
+// for the repo this hour. It reports whether the view was counted.
+func (b *scoreBoard) incr(repo, client string, now time.Time) bool {
+	bucket := bucketOf(now)
+	b.prune(bucket)
+
+	if b.seen[bucket] == nil {
+		b.seen[bucket] = map[string]bool{}
+	}
+	if b.seen[bucket][client+" "+repo] {
+		return false
+	}
+	b.seen[bucket][client+" "+repo] = true
+
+	if b.Hours[bucket] == nil {
+		b.Hours[bucket] = map[string]float64{}
+	}
+	b.Hours[bucket][repo]++
+	b.All[repo]++
+	return true
+}
+
+// top returns up to limit repos, highest score over window first.
+func (b *scoreBoard) top(window time.Duration, limit int, now time.Time) []string {
+	if window == 0 {
+		return topScores(b.All, limit)
+	}
+	scores := map[string]float64{}
+	for _, bucket := range bucketsIn(window, now) {
+		for repo, score := range b.Hours[bucket] {
+			scores[repo] += score
+		}
+	}
+	return topScores(scores, limit)
+}
+
+// prune drops buckets older than MaxScoreWindow, and dedupe state from
+// earlier hours.
+func (b *scoreBoard) prune(bucket int64) {
+	oldest := bucket - int64(MaxScoreWindow/time.Second)
+	for h := range b.Hours {
+		if h <= oldest {
+			delete(b.Hours, h)
+		}
+	}
+	for h := range b.seen {
+		if h != bucket {
+			delete(b.seen, h)
+		}
+	}
+}
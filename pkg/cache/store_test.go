@@ -0,0 +1,489 @@
+package cache
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// storeTests checks that a Store behaves as the Store interface documents.
+// Every backend runs it, each test against a fresh store from newStore.
+func storeTests(t *testing.T, newStore func(t *testing.T) Store) {
+	testCases := []struct {
+		name string
+		test func(t *testing.T, s Store)
+	}{
+		{"Get misses", testGetMiss},
+		{"Set then Get", testSetGet},
+		{"Set overwrites", testSetOverwrite},
+		{"Set expires", testSetExpiry},
+		{"Clear deletes a repo", testClear},
+		{"IncrScore and Scores", testScores},
+		{"Scores over a window", testScoresWindow},
+		{"Lock", testLock},
+		{"Lock is exclusive", testLockConcurrent},
+		{"Count", testCount},
+		{"Jobs", testJobs},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newStore(t))
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	storeTests(t, func(t *testing.T) Store {
+		s, err := NewMemory(DefaultMemoryEntries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestFSStore(t *testing.T) {
+	storeTests(t, func(t *testing.T) Store {
+		s, err := NewFS(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// write scores before the directory is removed
+		t.Cleanup(s.(*fsStore).flushScores)
+		return s
+	})
+}
+
+// TestMemoryStoreKeepsJobs checks that graphs, evicted beyond the memory
+// store's size, never evict jobs.
+func TestMemoryStoreKeepsJobs(t *testing.T) {
+	s, err := NewMemory(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetJob("job1", "running", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, repo := range []string{"github.com/a/b", "github.com/a/c", "github.com/a/d"} {
+		if err := s.Set(Key{"svg", repo, "false"}, "graph", now, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := s.Get(Key{"svg", "github.com/a/b", "false"}); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get of least recently used graph = %v, want ErrMiss", err)
+	}
+	if got, err := s.GetJob("job1"); err != nil || got != "running" {
+		t.Errorf("GetJob = %q, %v, want running", got, err)
+	}
+}
+
+// TestFSStoreSharedLock races instances sharing a directory, as on one node,
+// to take over an expired lock.
+func TestFSStoreSharedLock(t *testing.T) {
+	dir := t.TempDir()
+	stores := make([]Store, 8)
+	for i := range stores {
+		s, err := NewFS(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores[i] = s
+	}
+
+	for round := range 5 {
+		var taken atomic.Int32
+		var wg sync.WaitGroup
+		for _, s := range stores {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := s.Lock("warm", 100*time.Millisecond)
+				if err != nil {
+					t.Error(err)
+				}
+				if ok {
+					taken.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := taken.Load(); n != 1 {
+			t.Fatalf("round %d: Lock taken %d times, want once", round, n)
+		}
+		time.Sleep(150 * time.Millisecond)
+	}
+}
+
+// TestFSStoreScoresBatched checks that views are written out together, after
+// the first since the last write, and that the written scores load again.
+func TestFSStoreScoresBatched(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := store.(*fsStore)
+	s.scoresMu.Lock()
+	s.scoresFlush = 50 * time.Millisecond
+	s.scoresMu.Unlock()
+	t.Cleanup(s.flushScores)
+
+	file := filepath.Join(dir, fsScoresFile)
+	now := time.Now()
+	for _, client := range []string{"c1", "c2", "c3"} {
+		if err := s.IncrScore("github.com/a/b", client, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(file); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("%s written on a view, err = %v", fsScoresFile, err)
+	}
+
+	reload := func() []string {
+		t.Helper()
+		again, err := NewFS(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := again.Scores(0, 10, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(reload()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s never written", fsScoresFile)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// views after a write are batched into the next one
+	if err := s.IncrScore("github.com/a/c", "c1", now); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"github.com/a/b", "github.com/a/c"}
+	for got := reload(); !slices.Equal(got, want); got = reload() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Scores after reload = %v, want %v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestValkeyStore runs against the Valkey server at VALKEY_TEST_ADDR, if set.
+// It deletes every gographs key on that server, so never point it at one in
+// use.
+func TestValkeyStore(t *testing.T) {
+	addr := os.Getenv("VALKEY_TEST_ADDR")
+	if addr == "" {
+		t.Skip("VALKEY_TEST_ADDR not set")
+	}
+	// NewValkey registers metrics, so one store is shared, and emptied for
+	// each test.
+	s, err := NewValkey(addr, DefaultLocalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs := s.(*valkeyStore)
+	defer vs.client.Close()
+
+	storeTests(t, func(t *testing.T) Store {
+		for _, pattern := range []string{graphPrefix + "*", repoScores + "*", lockPrefix + "*", countPrefix + "*", jobPrefix + "*"} {
+			keys, err := vs.scan(pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range keys {
+				if err := vs.del(key); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return s
+	})
+}
+
+func testGetMiss(t *testing.T, s Store) {
+	_, _, err := s.Get(Key{"svg", "github.com/a/b", "false"})
+	if !errors.Is(err, ErrMiss) {
+		t.Errorf("Get = %v, want ErrMiss", err)
+	}
+}
+
+func testSetGet(t *testing.T, s Store) {
+	key := Key{"svg", "github.com/a/b", "true+theme=dark"}
+	created := time.Now().Truncate(time.Second)
+	value := compress("<svg>" + string(make([]byte, 1024)) + "</svg>")
+	if err := s.Set(key, value, created, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	got, gotCreated, err := s.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != value {
+		t.Errorf("Get = %q, want %q", got, value)
+	}
+	if !gotCreated.Equal(created) {
+		t.Errorf("Get created = %s, want %s", gotCreated, created)
+	}
+
+	// other formats and variants of the repo are separate
+	for _, other := range []Key{{"png", key.Repo, key.Variant}, {key.Format, key.Repo, "true"}} {
+		if _, _, err := s.Get(other); !errors.Is(err, ErrMiss) {
+			t.Errorf("Get(%v) = %v, want ErrMiss", other, err)
+		}
+	}
+}
+
+func testSetOverwrite(t *testing.T, s Store) {
+	key := Key{"dot", "github.com/a/b", "false"}
+	now := time.Now()
+	if err := s.Set(key, "old", now, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(key, "new", now, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, err := s.Get(key); err != nil || got != "new" {
+		t.Errorf("Get = %q, %v, want new", got, err)
+	}
+}
+
+func testSetExpiry(t *testing.T, s Store) {
+	key := Key{"svg", "github.com/a/b", "false"}
+	if err := s.Set(key, "graph", time.Now(), 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Get(key); err != nil {
+		t.Fatalf("Get before expiry = %v", err)
+	}
+	time.Sleep(2100 * time.Millisecond)
+	if _, _, err := s.Get(key); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get after expiry = %v, want ErrMiss", err)
+	}
+}
+
+func testClear(t *testing.T, s Store) {
+	now := time.Now()
+	cleared := []Key{
+		{"dot", "github.com/a/b", "false"},
+		{"svg", "github.com/a/b", "true"},
+		{"png", "github.com/a/b", "false+dpi=192"},
+	}
+	kept := []Key{
+		{"svg", "github.com/a/bc", "false"},
+		{"svg", "github.com/a/b/c", "false"},
+		{"svg", "github.com/x/y", "false"},
+	}
+	for _, key := range append(slices.Clone(cleared), kept...) {
+		if err := s.Set(key, "graph", now, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Clear("github.com/a/b"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range cleared {
+		if _, _, err := s.Get(key); !errors.Is(err, ErrMiss) {
+			t.Errorf("Get(%v) after Clear = %v, want ErrMiss", key, err)
+		}
+	}
+	for _, key := range kept {
+		if _, _, err := s.Get(key); err != nil {
+			t.Errorf("Get(%v) after Clear = %v, want kept", key, err)
+		}
+	}
+
+	if err := s.Clear("github.com/never/cached"); err != nil {
+		t.Errorf("Clear of uncached repo = %v", err)
+	}
+}
+
+func testScores(t *testing.T, s Store) {
+	now := time.Now()
+	views := []struct{ repo, client string }{
+		{"github.com/a/popular", "c1"},
+		{"github.com/a/popular", "c2"},
+		{"github.com/a/popular", "c3"},
+		{"github.com/a/middle", "c1"},
+		{"github.com/a/middle", "c2"},
+		// repeat views within the hour count once
+		{"github.com/a/middle", "c2"},
+		{"github.com/a/middle", "c2"},
+		{"github.com/a/least", "c1"},
+	}
+	for _, v := range views {
+		if err := s.IncrScore(v.repo, v.client, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"github.com/a/popular", "github.com/a/middle", "github.com/a/least"}
+	for _, window := range []time.Duration{0, 24 * time.Hour} {
+		got, err := s.Scores(window, 10, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Scores(%s) = %v, want %v", window, got, want)
+		}
+	}
+
+	got, err := s.Scores(0, 2, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want[:2]) {
+		t.Errorf("Scores(limit 2) = %v, want %v", got, want[:2])
+	}
+}
+
+func testScoresWindow(t *testing.T, s Store) {
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	for _, client := range []string{"c1", "c2", "c3"} {
+		if err := s.IncrScore("github.com/a/old", client, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.IncrScore("github.com/a/new", "c1", now); err != nil {
+		t.Fatal(err)
+	}
+	// a client counts again in a later hour
+	for _, at := range []time.Time{now.Add(-2 * time.Hour), now.Add(-time.Hour)} {
+		if err := s.IncrScore("github.com/a/recent", "c1", at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		window time.Duration
+		want   []string
+	}{
+		{0, []string{"github.com/a/old", "github.com/a/recent", "github.com/a/new"}},
+		{24 * time.Hour, []string{"github.com/a/recent", "github.com/a/new"}},
+		{MaxScoreWindow, []string{"github.com/a/old", "github.com/a/recent", "github.com/a/new"}},
+		{time.Hour, []string{"github.com/a/new"}},
+	}
+	for _, tc := range testCases {
+		got, err := s.Scores(tc.window, 10, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("Scores(%s) = %v, want %v", tc.window, got, tc.want)
+		}
+	}
+}
+
+func testLock(t *testing.T, s Store) {
+	ok, err := s.Lock("warm", time.Second)
+	if err != nil || !ok {
+		t.Fatalf("Lock = %t, %v, want taken", ok, err)
+	}
+	if ok, err := s.Lock("warm", time.Second); err != nil || ok {
+		t.Errorf("Lock while held = %t, %v, want not taken", ok, err)
+	}
+	if ok, err := s.Lock("other", time.Second); err != nil || !ok {
+		t.Errorf("Lock of another name = %t, %v, want taken", ok, err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if ok, err := s.Lock("warm", time.Second); err != nil || !ok {
+		t.Errorf("Lock after expiry = %t, %v, want taken", ok, err)
+	}
+}
+
+func testLockConcurrent(t *testing.T, s Store) {
+	var taken atomic.Int32
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := s.Lock("race", time.Minute)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				taken.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := taken.Load(); n != 1 {
+		t.Errorf("Lock taken %d times, want once", n)
+	}
+}
+
+func testCount(t *testing.T, s Store) {
+	window := 500 * time.Millisecond
+	for want := int64(1); want <= 3; want++ {
+		count, reset, err := s.Count("client", window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != want {
+			t.Errorf("Count = %d, want %d", count, want)
+		}
+		if reset <= 0 || reset > window {
+			t.Errorf("Count reset = %s, want within %s", reset, window)
+		}
+	}
+	if count, _, err := s.Count("other", window); err != nil || count != 1 {
+		t.Errorf("Count of another name = %d, %v, want 1", count, err)
+	}
+
+	time.Sleep(window + 100*time.Millisecond)
+	if count, _, err := s.Count("client", window); err != nil || count != 1 {
+		t.Errorf("Count after reset = %d, %v, want 1", count, err)
+	}
+}
+
+func testJobs(t *testing.T, s Store) {
+	if _, err := s.GetJob("job1"); !errors.Is(err, ErrMiss) {
+		t.Errorf("GetJob of unknown job = %v, want ErrMiss", err)
+	}
+
+	if err := s.SetJob("job1", "queued", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetJob("job1", "running\n", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetJob("job1"); err != nil || got != "running\n" {
+		t.Errorf("GetJob = %q, %v, want running", got, err)
+	}
+
+	// jobs are apart from graphs
+	if _, _, err := s.Get(Key{"job", "job1", ""}); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get of job as a graph = %v, want ErrMiss", err)
+	}
+	if err := s.Clear("job1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetJob("job1"); err != nil {
+		t.Errorf("GetJob after Clear = %v, want kept", err)
+	}
+
+	if err := s.SetJob("job2", "queued", 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(600 * time.Millisecond)
+	if _, err := s.GetJob("job2"); !errors.Is(err, ErrMiss) {
+		t.Errorf("GetJob after expiry = %v, want ErrMiss", err)
+	}
+}
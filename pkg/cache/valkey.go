@@ -0,0 +1,327 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valkey-io/valkey-go"
+)
+
+// valkeyStore implements Store with a Valkey server, so the cache is shared
+// across gographs instances.
+//
+// Graphs read from Valkey are also kept in a size-bounded, in-process LRU, via
+// client-side caching: Valkey tracks the keys each replica has read, and
+// invalidates them when any replica rewrites or clears them.
+type valkeyStore struct {
+	client valkey.Client
+	log    *log.Entry
+}
+
+const (
+	// graph:[format]:[repo+variant], one key per rendered graph
+	// graph:svg:github.com/siggy/gographs+false
+	// graph:png:github.com/siggy/gographs+true+dpi=192
+	// =>
+	// {value: [rendered graph], created: [unix seconds]}
+	//
+	// graph:dot:[repo+cluster] holds the DOT returned by the graph server.
+	//
+	// Keys expire once their entry has been stale for the stale TTL.
+	graphPrefix  = "graph:"
+	valueField   = "value"
+	createdField = "created"
+
+	// repo-scores[repo]
+	// github.com/siggy/gographs
+	// =>
+	// [numeric popularity score]
+	repoScores = "reposcores"
+
+	// reposcores:[hour unix seconds][repo], as repoScores but counting views
+	// within the hour. Hours expire after MaxScoreWindow.
+	//
+	// reposcores:seen:[hour unix seconds] holds "[client] [repo]" members for
+	// the views counted within the hour.
+	hourScoresPrefix = repoScores + ":"
+	seenScoresPrefix = repoScores + ":seen:"
+
+	// reposcores:window:[window seconds]:[hour unix seconds] briefly holds the
+	// sum of the hours in a window, to rank them.
+	windowScoresPrefix = repoScores + ":window:"
+
+	// lock:[name] is held by whichever instance set it, until it expires.
+	lockPrefix = "lock:"
+
+	// count:[name] is a counter that expires at the end of its window.
+	countPrefix = "count:"
+
+	// job:[id] holds a background job's state, until it expires.
+	jobPrefix = "job:"
+)
+
+// DefaultLocalBytes bounds the in-process cache in front of Valkey when no size
+// is given.
+const DefaultLocalBytes = valkey.DefaultCacheBytes
+
+// windowScoresTTL is how long a window's summed scores are kept after they
+// are ranked. Each ranking sums the hours afresh.
+const windowScoresTTL = 10 * time.Second
+
+// localTTL caps how long a graph is cached in process. Invalidations normally
+// evict it first, and it never outlives its Valkey key.
+const localTTL = time.Hour
+
+// NewValkey connects to a Valkey server, caching up to localBytes of graphs in
+// process. A localBytes of zero disables the in-process cache.
+func NewValkey(addr string, localBytes int) (Store, error) {
+	if localBytes < 0 {
+		return nil, fmt.Errorf("invalid local cache size: %d", localBytes)
+	}
+	client, err := valkey.NewClient(valkey.ClientOption{
+		InitAddress:       []string{addr},
+		CacheSizeEachConn: localBytes,
+		DisableCache:      localBytes == 0,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+
+	err = client.Do(ctx, client.B().Ping().Build()).Error()
+	if err != nil {
+		return nil, err
+	}
+
+	log := log.WithFields(
+		log.Fields{
+			"valkey": addr,
+		},
+	)
+
+	registerGauges(client)
+
+	log.Infof("Valkey cache initialized with %d bytes in process", localBytes)
+
+	return &valkeyStore{
+		client: client,
+		log:    log,
+	}, nil
+}
+
+func (s *valkeyStore) Get(key Key) (string, time.Time, error) {
+	resp := s.client.DoCache(
+		context.Background(),
+		s.client.B().Hmget().Key(entryKey(key)).Field(valueField, createdField).Cache(),
+		localTTL,
+	)
+	if resp.IsCacheHit() {
+		localHits.WithLabelValues(key.Format).Inc()
+	}
+	fields, err := resp.ToArray()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if len(fields) != 2 || fields[0].IsNil() {
+		return "", time.Time{}, ErrMiss
+	}
+	value, err := fields[0].ToString()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	created, err := fields[1].AsInt64()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return value, time.Unix(created, 0), nil
+}
+
+func (s *valkeyStore) Set(key Key, value string, created time.Time, expiry time.Duration) error {
+	k := entryKey(key)
+	cmds := valkey.Commands{
+		s.client.B().Hset().Key(k).FieldValue().
+			FieldValue(valueField, value).
+			FieldValue(createdField, strconv.FormatInt(created.Unix(), 10)).Build(),
+		s.client.B().Expire().Key(k).Seconds(int64(expiry.Seconds())).Build(),
+	}
+	for _, resp := range s.client.DoMulti(context.Background(), cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *valkeyStore) Clear(repo string) error {
+	keys, err := s.scan(graphPrefix + "*:" + globEscape(repo) + "+*")
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := s.del(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *valkeyStore) IncrScore(repo, client string, now time.Time) error {
+	ctx := context.Background()
+	bucket := bucketOf(now)
+
+	seen := seenScoresPrefix + strconv.FormatInt(bucket, 10)
+	resps := s.client.DoMulti(ctx,
+		s.client.B().Sadd().Key(seen).Member(client+" "+repo).Build(),
+		s.client.B().Expire().Key(seen).Seconds(int64(scoreBucket.Seconds())).Build(),
+	)
+	added, err := resps[0].AsInt64()
+	if err != nil {
+		return err
+	}
+	if added == 0 {
+		return nil
+	}
+
+	hour := hourScoresPrefix + strconv.FormatInt(bucket, 10)
+	for _, resp := range s.client.DoMulti(ctx,
+		s.client.B().Zincrby().Key(repoScores).Increment(1).Member(repo).Build(),
+		s.client.B().Zincrby().Key(hour).Increment(1).Member(repo).Build(),
+		s.client.B().Expire().Key(hour).Seconds(int64((MaxScoreWindow + scoreBucket).Seconds())).Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *valkeyStore) Scores(window time.Duration, limit int, now time.Time) ([]string, error) {
+	if window == 0 {
+		return s.client.Do(
+			context.Background(),
+			s.client.B().Zrevrangebyscore().Key(repoScores).
+				Max("+inf").Min("0").Limit(0, int64(limit)).Build(),
+		).AsStrSlice()
+	}
+
+	buckets := bucketsIn(window, now)
+	keys := make([]string, len(buckets))
+	for i, bucket := range buckets {
+		keys[i] = hourScoresPrefix + strconv.FormatInt(bucket, 10)
+	}
+	// Sum the hours server-side, so only the top repos are returned.
+	sum := windowScoresPrefix + strconv.FormatInt(int64(window.Seconds()), 10) + ":" + strconv.FormatInt(buckets[0], 10)
+	resps := s.client.DoMulti(
+		context.Background(),
+		s.client.B().Zunionstore().Destination(sum).Numkeys(int64(len(keys))).Key(keys...).Build(),
+		s.client.B().Expire().Key(sum).Seconds(int64(windowScoresTTL.Seconds())).Build(),
+		s.client.B().Zrevrange().Key(sum).Start(0).Stop(int64(limit-1)).Build(),
+	)
+	for _, resp := range resps[:2] {
+		if err := resp.Error(); err != nil {
+			return nil, err
+		}
+	}
+	return resps[2].AsStrSlice()
+}
+
+func (s *valkeyStore) Lock(name string, ttl time.Duration) (bool, error) {
+	err := s.client.Do(
+		context.Background(),
+		s.client.B().Set().Key(lockPrefix+name).Value(strconv.FormatInt(time.Now().Unix(), 10)).
+			Nx().PxMilliseconds(ttl.Milliseconds()).Build(),
+	).Error()
+	if valkey.IsValkeyNil(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *valkeyStore) Count(name string, window time.Duration) (int64, time.Duration, error) {
+	k := countPrefix + name
+	resps := s.client.DoMulti(
+		context.Background(),
+		s.client.B().Incr().Key(k).Build(),
+		s.client.B().Pexpire().Key(k).Milliseconds(window.Milliseconds()).Nx().Build(),
+		s.client.B().Pttl().Key(k).Build(),
+	)
+	count, err := resps[0].AsInt64()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := resps[1].Error(); err != nil {
+		return 0, 0, err
+	}
+	ttl, err := resps[2].AsInt64()
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, time.Duration(max(ttl, 0)) * time.Millisecond, nil
+}
+
+func (s *valkeyStore) SetJob(id, value string, expiry time.Duration) error {
+	return s.client.Do(
+		context.Background(),
+		s.client.B().Set().Key(jobPrefix+id).Value(value).PxMilliseconds(expiry.Milliseconds()).Build(),
+	).Error()
+}
+
+func (s *valkeyStore) GetJob(id string) (string, error) {
+	value, err := s.client.Do(
+		context.Background(),
+		s.client.B().Get().Key(jobPrefix+id).Build(),
+	).ToString()
+	if valkey.IsValkeyNil(err) {
+		return "", ErrMiss
+	}
+	return value, err
+}
+
+// scan returns the keys matching a glob pattern.
+func (s *valkeyStore) scan(match string) ([]string, error) {
+	var keys []string
+	cursor := uint64(0)
+	for {
+		entry, err := s.client.Do(
+			context.Background(),
+			s.client.B().Scan().Cursor(cursor).Match(match).Count(1000).Build(),
+		).AsScanEntry()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, entry.Elements...)
+		cursor = entry.Cursor
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
+func (s *valkeyStore) del(key string) error {
+	s.log.Debugf("del[%s]", key)
+	return s.client.Do(
+		context.Background(),
+		s.client.B().Del().Key(key).Build(),
+	).Error()
+}
+
+func entryKey(key Key) string {
+	return graphPrefix + key.Format + ":" + key.Repo + "+" + key.Variant
+}
+
+// globEscape escapes glob metacharacters for use in a MATCH pattern.
+func globEscape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,250 @@
+package dot
+
+// This package models the subset of the DOT language produced by goda:
+//
+//   digraph G {
+//     node [fontsize=10 shape=rectangle];
+//     subgraph "cluster_github.com/siggy/gographs" {
+//       label="github.com/siggy/gographs";
+//       "github.com/siggy/gographs/pkg/web" [label="pkg/web"];
+//     }
+//     "github.com/siggy/gographs/pkg/web" -> "github.com/siggy/gographs/pkg/cache";
+//   }
+//
+// Graphs round-trip through Parse and String, so callers can read goda output,
+// adjust it, and hand it to Graphviz or the in-process renderers.
+
+import "strings"
+
+// Attrs holds DOT attributes, keyed by attribute name.
+type Attrs map[string]string
+
+// htmlValues holds the attributes parsed from HTML strings, such as
+// label=<<b>web</b>>, by name, with their values including the angle brackets.
+// String writes an attribute verbatim only while it still has the value
+// parsed, and quotes every other value.
+type htmlValues map[string]string
+
+// set records whether key's value is an HTML string.
+func (h *htmlValues) set(key, value string, html bool) {
+	if !html {
+		delete(*h, key)
+		return
+	}
+	if *h == nil {
+		*h = htmlValues{}
+	}
+	(*h)[key] = value
+}
+
+// attrs is an attribute map, along with the record of which of its values
+// are HTML strings.
+type attrs struct {
+	values Attrs
+	html   *htmlValues
+}
+
+func newAttrs() attrs {
+	return attrs{Attrs{}, new(htmlValues)}
+}
+
+func (a attrs) set(key string, tok token) {
+	a.values[key] = tok.text
+	a.html.set(key, tok.text, tok.html)
+}
+
+// isHTML reports whether key holds the HTML string it was parsed with.
+func (a attrs) isHTML(key string) bool {
+	v, ok := (*a.html)[key]
+	return ok && a.values[key] == v
+}
+
+func (a attrs) copyTo(dst attrs) {
+	for k, v := range a.values {
+		dst.values[k] = v
+		dst.html.set(k, v, a.isHTML(k))
+	}
+}
+
+// Graph is a parsed DOT graph.
+type Graph struct {
+	ID       string
+	Strict   bool
+	Directed bool
+
+	// Attrs holds graph attributes, NodeAttrs and EdgeAttrs hold the default
+	// node and edge attributes declared at the top level.
+	Attrs     Attrs
+	NodeAttrs Attrs
+	EdgeAttrs Attrs
+
+	Subgraphs []*Subgraph
+	Nodes     []*Node
+	Edges     []*Edge
+
+	nodes                    map[string]*Node
+	html, nodeHTML, edgeHTML htmlValues
+}
+
+// Subgraph is a DOT subgraph. Subgraphs whose ID starts with "cluster" are
+// drawn as boxes by Graphviz.
+type Subgraph struct {
+	ID        string
+	Attrs     Attrs
+	NodeAttrs Attrs
+	EdgeAttrs Attrs
+
+	Subgraphs []*Subgraph
+	// Nodes holds the IDs of nodes declared directly in this subgraph.
+	Nodes []string
+
+	html, nodeHTML, edgeHTML htmlValues
+}
+
+// Node is a DOT node.
+type Node struct {
+	ID    string
+	Attrs Attrs
+
+	html htmlValues
+}
+
+// Edge is a DOT edge between two node IDs.
+type Edge struct {
+	From  string
+	To    string
+	Attrs Attrs
+
+	html htmlValues
+}
+
+// NewGraph returns an empty directed graph.
+func NewGraph(id string) *Graph {
+	return &Graph{
+		ID:        id,
+		Directed:  true,
+		Attrs:     Attrs{},
+		NodeAttrs: Attrs{},
+		EdgeAttrs: Attrs{},
+		nodes:     map[string]*Node{},
+	}
+}
+
+// NewSubgraph returns an empty subgraph.
+func NewSubgraph(id string) *Subgraph {
+	return &Subgraph{
+		ID:        id,
+		Attrs:     Attrs{},
+		NodeAttrs: Attrs{},
+		EdgeAttrs: Attrs{},
+	}
+}
+
+// Node returns the node with the given ID, or nil.
+func (g *Graph) Node(id string) *Node {
+	return g.nodes[id]
+}
+
+// AddNode returns the node with the given ID, creating it if needed.
+func (g *Graph) AddNode(id string) *Node {
+	if n, ok := g.nodes[id]; ok {
+		return n
+	}
+	n := &Node{ID: id, Attrs: Attrs{}}
+	g.nodes[id] = n
+	g.Nodes = append(g.Nodes, n)
+	return n
+}
+
+// AddEdge adds an edge, creating its endpoints if needed.
+func (g *Graph) AddEdge(from, to string) *Edge {
+	g.AddNode(from)
+	g.AddNode(to)
+	e := &Edge{From: from, To: to, Attrs: Attrs{}}
+	g.Edges = append(g.Edges, e)
+	return e
+}
+
+// IsCluster reports whether the subgraph is a cluster.
+func (s *Subgraph) IsCluster() bool {
+	return strings.HasPrefix(s.ID, "cluster")
+}
+
+// Get returns the attribute value for key, or def if it is unset.
+func (a Attrs) Get(key, def string) string {
+	if v, ok := a[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// NodeAttr returns a node attribute, falling back to the graph's default node
+// attributes and then def.
+func (g *Graph) NodeAttr(n *Node, key, def string) string {
+	if v, ok := n.Attrs[key]; ok {
+		return v
+	}
+	return g.NodeAttrs.Get(key, def)
+}
+
+// EdgeAttr returns an edge attribute, falling back to the graph's default edge
+// attributes and then def.
+func (g *Graph) EdgeAttr(e *Edge, key, def string) string {
+	if v, ok := e.Attrs[key]; ok {
+		return v
+	}
+	return g.EdgeAttrs.Get(key, def)
+}
+
+// Walk calls fn for every subgraph in depth-first order, along with its chain
+// of ancestors (outermost first).
+func (g *Graph) Walk(fn func(s *Subgraph, parents []*Subgraph)) {
+	var walk func(subs []*Subgraph, parents []*Subgraph)
+	walk = func(subs []*Subgraph, parents []*Subgraph) {
+		for _, s := range subs {
+			fn(s, parents)
+			walk(s.Subgraphs, append(parents[:len(parents):len(parents)], s))
+		}
+	}
+	walk(g.Subgraphs, nil)
+}
+
+// Clusters maps each node ID to its chain of enclosing clusters, outermost
+// first. Nodes outside any cluster are omitted.
+func (g *Graph) Clusters() map[string][]*Subgraph {
+	clusters := map[string][]*Subgraph{}
+	g.Walk(func(s *Subgraph, parents []*Subgraph) {
+		chain := []*Subgraph{}
+		for _, p := range append(parents, s) {
+			if p.IsCluster() {
+				chain = append(chain, p)
+			}
+		}
+		if len(chain) == 0 {
+			return
+		}
+		for _, id := range s.Nodes {
+			if len(chain) > len(clusters[id]) {
+				clusters[id] = chain
+			}
+		}
+	})
+	return clusters
+}
+
+// LabelLines expands the \N and \G escapes in a label and splits it on its
+// line escapes (\n, \l and \r).
+func LabelLines(label, nodeID, graphID string) []string {
+	label = strings.ReplaceAll(label, `\N`, nodeID)
+	label = strings.ReplaceAll(label, `\G`, graphID)
+	for _, esc := range []string{`\l`, `\r`} {
+		label = strings.ReplaceAll(label, esc, `\n`)
+	}
+	label = strings.TrimSuffix(label, `\n`)
+	return strings.Split(label, `\n`)
+}
+
+// NodeLabel returns the lines of a node's label, which defaults to its ID.
+func (g *Graph) NodeLabel(n *Node) []string {
+	return LabelLines(g.NodeAttr(n, "label", `\N`), n.ID, g.ID)
+}
@@ -0,0 +1,61 @@
+package dot
+
+import "strings"
+
+// ImportsAttr is the edge attribute in which the graph server records the
+// files that make up an edge: the files in the edge's tail that import its
+// head. Graphviz ignores attributes it does not know.
+const ImportsAttr = "imports"
+
+// Import is a file's import of a package.
+type Import struct {
+	// File is the importing file's path, relative to the repo root.
+	File string `json:"file"`
+	// Alias is the import's name, e.g. "_" or "log", if it has one.
+	Alias string `json:"alias,omitempty"`
+}
+
+// String formats an import as it appears in tooltips, e.g. "main.go as log".
+func (i Import) String() string {
+	if i.Alias == "" {
+		return i.File
+	}
+	return i.File + " as " + i.Alias
+}
+
+// Imports returns the imports recorded on an edge.
+func (e *Edge) Imports() []Import {
+	v := e.Attrs[ImportsAttr]
+	if v == "" {
+		return nil
+	}
+	var imports []Import
+	for _, entry := range strings.Split(v, ";") {
+		file, alias, _ := strings.Cut(entry, " ")
+		imports = append(imports, Import{
+			File:  importUnescaper.Replace(file),
+			Alias: importUnescaper.Replace(alias),
+		})
+	}
+	return imports
+}
+
+// SetImports records imports on an edge, as semicolon-separated entries of
+// a file path optionally followed by a space and the alias. Separators, and
+// backslashes, which Graphviz reads as escapes, are percent-encoded within
+// paths and aliases.
+func (e *Edge) SetImports(imports []Import) {
+	entries := make([]string, len(imports))
+	for i, imp := range imports {
+		entries[i] = importEscaper.Replace(imp.File)
+		if imp.Alias != "" {
+			entries[i] += " " + importEscaper.Replace(imp.Alias)
+		}
+	}
+	e.Attrs[ImportsAttr] = strings.Join(entries, ";")
+}
+
+var (
+	importEscaper   = strings.NewReplacer("%", "%25", ";", "%3B", " ", "%20", `\`, "%5C")
+	importUnescaper = strings.NewReplacer("%25", "%", "%3B", ";", "%20", " ", "%5C", `\`)
+)
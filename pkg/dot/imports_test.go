@@ -0,0 +1,55 @@
+package dot
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestImportsRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name    string
+		imports []Import
+		attr    string
+	}{
+		{
+			name:    "none",
+			imports: nil,
+			attr:    "",
+		},
+		{
+			name:    "files and aliases",
+			imports: []Import{{File: "main.go"}, {File: "cmd/log.go", Alias: "log"}, {File: "x_test.go", Alias: "_"}},
+			attr:    "main.go;cmd/log.go log;x_test.go _",
+		},
+		{
+			name: "separators in paths",
+			imports: []Import{
+				{File: "my dir/a;b.go", Alias: "x"},
+				{File: "100%.go"},
+				{File: `odd\dir/"quoted".go`},
+				{File: "%3B.go"},
+			},
+			attr: `my%20dir/a%3Bb.go x;100%25.go;odd%5Cdir/"quoted".go;%253B.go`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewGraph("")
+			e := g.AddEdge("a", "b")
+			e.SetImports(tc.imports)
+			if got := e.Attrs[ImportsAttr]; got != tc.attr {
+				t.Errorf("imports attribute %q, want %q", got, tc.attr)
+			}
+
+			// the imports survive writing the graph out and parsing it back
+			again, err := Parse(g.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := again.Edges[0].Imports(); !slices.Equal(got, tc.imports) {
+				t.Errorf("Imports() = %q, want %q", got, tc.imports)
+			}
+		})
+	}
+}
@@ -0,0 +1,613 @@
+package dot
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseError describes malformed DOT input.
+type ParseError struct {
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("dot: %d:%d: %s", e.Line, e.Col, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokID
+	tokPunct
+	tokEdgeOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// quoted is set for double-quoted and HTML IDs, which are never keywords.
+	quoted bool
+	html   bool
+	line   int
+	col    int
+}
+
+// Parse parses a single DOT graph.
+func Parse(src string) (*Graph, error) {
+	p := &parser{lex: &lexer{src: src, line: 1, col: 1}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	g, err := p.parseGraph()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q after graph", p.tok.text)
+	}
+	return g, nil
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	line int
+	col  int
+}
+
+func (l *lexer) peek() rune {
+	if l.pos >= len(l.src) {
+		return -1
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+	return r
+}
+
+func (l *lexer) advance() rune {
+	r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+	l.pos += size
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return r
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return &ParseError{Line: l.line, Col: l.col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// skip consumes whitespace and comments. Lines beginning with '#' are treated
+// as C preprocessor output and ignored, as Graphviz does.
+func (l *lexer) skip() error {
+	for l.pos < len(l.src) {
+		r := l.peek()
+		rest := l.src[l.pos:]
+		switch {
+		case unicode.IsSpace(r):
+			l.advance()
+		case strings.HasPrefix(rest, "//"), r == '#' && l.col == 1:
+			for l.pos < len(l.src) && l.peek() != '\n' {
+				l.advance()
+			}
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return l.errorf("unterminated comment")
+			}
+			for n := end + 4; n > 0; n-- {
+				l.advance()
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skip(); err != nil {
+		return token{}, err
+	}
+	tok := token{line: l.line, col: l.col}
+	if l.pos >= len(l.src) {
+		tok.kind = tokEOF
+		return tok, nil
+	}
+
+	r := l.peek()
+	rest := l.src[l.pos:]
+	switch {
+	case strings.HasPrefix(rest, "->"), strings.HasPrefix(rest, "--"):
+		tok.kind = tokEdgeOp
+		tok.text = rest[:2]
+		l.advance()
+		l.advance()
+	case strings.ContainsRune("{}[];,=:", r):
+		tok.kind = tokPunct
+		tok.text = string(l.advance())
+	case r == '"':
+		s, err := l.quoted()
+		if err != nil {
+			return token{}, err
+		}
+		tok.kind = tokID
+		tok.text = s
+		tok.quoted = true
+	case r == '<':
+		s, err := l.html()
+		if err != nil {
+			return token{}, err
+		}
+		tok.kind = tokID
+		tok.text = s
+		tok.quoted = true
+		tok.html = true
+	case r == '-' || r == '.' || unicode.IsDigit(r):
+		tok.kind = tokID
+		tok.text = l.numeral()
+		if tok.text == "" {
+			return token{}, l.errorf("unexpected %q", r)
+		}
+	case isIDStart(r):
+		tok.kind = tokID
+		start := l.pos
+		for l.pos < len(l.src) && isIDPart(l.peek()) {
+			l.advance()
+		}
+		tok.text = l.src[start:l.pos]
+	default:
+		return token{}, l.errorf("unexpected %q", r)
+	}
+	return tok, nil
+}
+
+// quoted reads a double-quoted string, including "a" + "b" concatenation.
+// Only \" is unescaped; other escapes such as \n and \l are kept for the
+// renderer to interpret, matching Graphviz.
+func (l *lexer) quoted() (string, error) {
+	var sb strings.Builder
+	for {
+		l.advance() // opening quote
+		for {
+			if l.pos >= len(l.src) {
+				return "", l.errorf("unterminated string")
+			}
+			r := l.advance()
+			if r == '"' {
+				break
+			}
+			if r == '\\' && l.pos < len(l.src) {
+				switch l.peek() {
+				case '"':
+					l.advance()
+					sb.WriteRune('"')
+					continue
+				case '\n':
+					l.advance()
+					continue
+				}
+			}
+			sb.WriteRune(r)
+		}
+
+		// look ahead for '+' concatenation
+		save := *l
+		if err := l.skip(); err != nil || l.peek() != '+' {
+			*l = save
+			return sb.String(), nil
+		}
+		l.advance()
+		if err := l.skip(); err != nil || l.peek() != '"' {
+			*l = save
+			return sb.String(), nil
+		}
+	}
+}
+
+// html reads an HTML string, keeping the enclosing angle brackets so it can be
+// written back verbatim.
+func (l *lexer) html() (string, error) {
+	start := l.pos
+	depth := 0
+	for l.pos < len(l.src) {
+		switch l.advance() {
+		case '<':
+			depth++
+		case '>':
+			depth--
+			if depth == 0 {
+				return l.src[start:l.pos], nil
+			}
+		}
+	}
+	return "", l.errorf("unterminated HTML string")
+}
+
+func (l *lexer) numeral() string {
+	start := l.pos
+	if l.peek() == '-' {
+		l.advance()
+	}
+	digits := 0
+	for l.pos < len(l.src) && unicode.IsDigit(l.peek()) {
+		l.advance()
+		digits++
+	}
+	if l.peek() == '.' {
+		l.advance()
+		for l.pos < len(l.src) && unicode.IsDigit(l.peek()) {
+			l.advance()
+			digits++
+		}
+	}
+	if digits == 0 {
+		l.pos, l.col = start, l.col-(l.pos-start)
+		return ""
+	}
+	return l.src[start:l.pos]
+}
+
+func isIDStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || r >= 0x80
+}
+
+func isIDPart(r rune) bool {
+	return isIDStart(r) || unicode.IsDigit(r)
+}
+
+type parser struct {
+	lex *lexer
+	tok token
+	g   *Graph
+}
+
+func (p *parser) next() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &ParseError{Line: p.tok.line, Col: p.tok.col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// keyword reports whether the current token is the given case-insensitive
+// keyword.
+func (p *parser) keyword(kw string) bool {
+	return p.tok.kind == tokID && !p.tok.quoted && strings.EqualFold(p.tok.text, kw)
+}
+
+func (p *parser) punct(s string) bool {
+	return p.tok.kind == tokPunct && p.tok.text == s
+}
+
+func (p *parser) expect(s string) error {
+	if !p.punct(s) {
+		return p.errorf("expected %q, found %q", s, p.tok.text)
+	}
+	return p.next()
+}
+
+func (p *parser) parseGraph() (*Graph, error) {
+	g := NewGraph("")
+	p.g = g
+
+	if p.keyword("strict") {
+		g.Strict = true
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case p.keyword("digraph"):
+		g.Directed = true
+	case p.keyword("graph"):
+		g.Directed = false
+	default:
+		return nil, p.errorf("expected graph or digraph, found %q", p.tok.text)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokID {
+		g.ID = p.tok.text
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	root := &scope{
+		attrs:     attrs{g.Attrs, &g.html},
+		nodeAttrs: attrs{g.NodeAttrs, &g.nodeHTML},
+		edgeAttrs: attrs{g.EdgeAttrs, &g.edgeHTML},
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	if err := p.parseStmts(root); err != nil {
+		return nil, err
+	}
+	g.Subgraphs = root.subgraphs
+	return g, nil
+}
+
+// scope tracks the attribute maps and members of the graph or subgraph being
+// parsed.
+type scope struct {
+	attrs     attrs
+	nodeAttrs attrs
+	edgeAttrs attrs
+	sub       *Subgraph
+	subgraphs []*Subgraph
+	parent    *scope
+}
+
+func (s *scope) addNode(id string) {
+	if s.sub == nil {
+		return
+	}
+	for _, n := range s.sub.Nodes {
+		if n == id {
+			return
+		}
+	}
+	s.sub.Nodes = append(s.sub.Nodes, id)
+}
+
+// defaults returns the default attributes picked from each enclosing
+// subgraph, outermost first. Top-level defaults are kept on the Graph instead.
+func (s *scope) defaults(pick func(*scope) attrs) attrs {
+	out := newAttrs()
+	if s.parent == nil {
+		return out
+	}
+	s.parent.defaults(pick).copyTo(out)
+	pick(s).copyTo(out)
+	return out
+}
+
+// parseStmts parses statements up to and including the closing '}'.
+func (p *parser) parseStmts(s *scope) error {
+	for {
+		switch {
+		case p.tok.kind == tokEOF:
+			return p.errorf("unexpected end of input, expected '}'")
+		case p.punct("}"):
+			return p.next()
+		case p.punct(";"):
+			if err := p.next(); err != nil {
+				return err
+			}
+		default:
+			if err := p.parseStmt(s); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *parser) parseStmt(s *scope) error {
+	switch {
+	case p.keyword("graph"), p.keyword("node"), p.keyword("edge"):
+		target := s.attrs
+		if p.keyword("node") {
+			target = s.nodeAttrs
+		} else if p.keyword("edge") {
+			target = s.edgeAttrs
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+		return p.parseAttrList(target)
+	}
+
+	var lhs []string
+	var node *Node
+	if p.tok.kind == tokID && !p.keyword("subgraph") {
+		id := p.tok.text
+		if err := p.next(); err != nil {
+			return err
+		}
+		if p.punct("=") {
+			if err := p.next(); err != nil {
+				return err
+			}
+			if p.tok.kind != tokID {
+				return p.errorf("expected attribute value, found %q", p.tok.text)
+			}
+			s.attrs.set(id, p.tok)
+			return p.next()
+		}
+		if err := p.parsePort(); err != nil {
+			return err
+		}
+		node = p.addNode(s, id)
+		lhs = []string{id}
+	} else {
+		var err error
+		if lhs, err = p.parseEndpoint(s); err != nil {
+			return err
+		}
+	}
+
+	if p.tok.kind != tokEdgeOp {
+		if node != nil && p.punct("[") {
+			return p.parseAttrList(attrs{node.Attrs, &node.html})
+		}
+		return nil
+	}
+
+	var edges []*Edge
+	defaults := s.defaults(func(s *scope) attrs { return s.edgeAttrs })
+	for p.tok.kind == tokEdgeOp {
+		if err := p.next(); err != nil {
+			return err
+		}
+		rhs, err := p.parseEndpoint(s)
+		if err != nil {
+			return err
+		}
+		for _, from := range lhs {
+			for _, to := range rhs {
+				e := p.g.AddEdge(from, to)
+				defaults.copyTo(attrs{e.Attrs, &e.html})
+				edges = append(edges, e)
+			}
+		}
+		lhs = rhs
+	}
+	if p.punct("[") {
+		list := newAttrs()
+		if err := p.parseAttrList(list); err != nil {
+			return err
+		}
+		for _, e := range edges {
+			list.copyTo(attrs{e.Attrs, &e.html})
+		}
+	}
+	return nil
+}
+
+// parseEndpoint parses a node ID (with optional port) or a subgraph and
+// returns the node IDs it refers to.
+func (p *parser) parseEndpoint(s *scope) ([]string, error) {
+	if p.keyword("subgraph") || p.punct("{") {
+		sub, err := p.parseSubgraph(s)
+		if err != nil {
+			return nil, err
+		}
+		return subgraphNodes(sub), nil
+	}
+	if p.tok.kind != tokID {
+		return nil, p.errorf("expected node, found %q", p.tok.text)
+	}
+	id := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if err := p.parsePort(); err != nil {
+		return nil, err
+	}
+	p.addNode(s, id)
+	return []string{id}, nil
+}
+
+// parsePort skips an optional port suffix; ports are accepted but not
+// modelled.
+func (p *parser) parsePort() error {
+	for p.punct(":") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if p.tok.kind != tokID {
+			return p.errorf("expected port, found %q", p.tok.text)
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addNode records a node reference in scope s, creating the node with the
+// scope's default attributes on first use.
+func (p *parser) addNode(s *scope, id string) *Node {
+	n := p.g.Node(id)
+	if n == nil {
+		n = p.g.AddNode(id)
+		s.defaults(func(s *scope) attrs { return s.nodeAttrs }).copyTo(attrs{n.Attrs, &n.html})
+	}
+	s.addNode(id)
+	return n
+}
+
+func (p *parser) parseSubgraph(s *scope) (*Subgraph, error) {
+	sub := NewSubgraph("")
+	if p.keyword("subgraph") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokID {
+			sub.ID = p.tok.text
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// subgraphs inherit the default attributes of their parent
+	inner := &scope{
+		attrs:     attrs{sub.Attrs, &sub.html},
+		nodeAttrs: attrs{sub.NodeAttrs, &sub.nodeHTML},
+		edgeAttrs: attrs{sub.EdgeAttrs, &sub.edgeHTML},
+		sub:       sub,
+		parent:    s,
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	if err := p.parseStmts(inner); err != nil {
+		return nil, err
+	}
+	sub.Subgraphs = inner.subgraphs
+	s.subgraphs = append(s.subgraphs, sub)
+	return sub, nil
+}
+
+func (p *parser) parseAttrList(target attrs) error {
+	if !p.punct("[") {
+		return p.errorf("expected '[', found %q", p.tok.text)
+	}
+	for p.punct("[") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		for !p.punct("]") {
+			if p.tok.kind != tokID {
+				return p.errorf("expected attribute name, found %q", p.tok.text)
+			}
+			key := p.tok.text
+			if err := p.next(); err != nil {
+				return err
+			}
+			if err := p.expect("="); err != nil {
+				return err
+			}
+			if p.tok.kind != tokID {
+				return p.errorf("expected attribute value, found %q", p.tok.text)
+			}
+			target.set(key, p.tok)
+			if err := p.next(); err != nil {
+				return err
+			}
+			if p.punct(",") || p.punct(";") {
+				if err := p.next(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func subgraphNodes(s *Subgraph) []string {
+	ids := append([]string{}, s.Nodes...)
+	for _, sub := range s.Subgraphs {
+		ids = append(ids, subgraphNodes(sub)...)
+	}
+	return ids
+}
@@ -0,0 +1,203 @@
+package dot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "empty",
+			src:  `digraph {}`,
+			want: "digraph {\n}\n",
+		},
+		{
+			name: "goda",
+			src: `digraph G {
+				node [fontsize=10 shape=rectangle];
+				subgraph "cluster_github.com/siggy/gographs" {
+					label="github.com/siggy/gographs";
+					"github.com/siggy/gographs/pkg/web" [label="pkg/web"];
+					"github.com/siggy/gographs/pkg/cache" [label="pkg/cache"];
+				}
+				"github.com/siggy/gographs/pkg/web" -> "github.com/siggy/gographs/pkg/cache";
+			}`,
+			want: `digraph G {
+	node [fontsize=10 shape=rectangle];
+	subgraph "cluster_github.com/siggy/gographs" {
+		label="github.com/siggy/gographs";
+		"github.com/siggy/gographs/pkg/web" [label="pkg/web"];
+		"github.com/siggy/gographs/pkg/cache" [label="pkg/cache"];
+	}
+	"github.com/siggy/gographs/pkg/web" -> "github.com/siggy/gographs/pkg/cache";
+}
+`,
+		},
+		{
+			name: "strict undirected",
+			src:  `strict graph g { a -- b }`,
+			want: "strict graph g {\n\ta;\n\tb;\n\ta -- b;\n}\n",
+		},
+		{
+			name: "edge chains and subgraph endpoints",
+			src:  `digraph { a -> b -> {c d} [color=red] }`,
+			want: `digraph {
+	subgraph {
+		c;
+		d;
+	}
+	a;
+	b;
+	a -> b [color=red];
+	b -> c [color=red];
+	b -> d [color=red];
+}
+`,
+		},
+		{
+			name: "subgraph defaults",
+			src: `digraph {
+				edge [style=dashed];
+				subgraph cluster_a {
+					node [color=blue];
+					edge [color=gray];
+					x -> y;
+				}
+				z;
+			}`,
+			want: `digraph {
+	edge [style=dashed];
+	subgraph cluster_a {
+		node [color=blue];
+		edge [color=gray];
+		x [color=blue];
+		y [color=blue];
+	}
+	z;
+	x -> y [color=gray];
+}
+`,
+		},
+		{
+			name: "comments, ports and concatenation",
+			src: `# preprocessor line
+				digraph {
+					// line comment
+					/* block
+					   comment */
+					a:n -> b:s:w;
+					c [label="one" + " two", tooltip="say \"hi\"\n"];
+				}`,
+			want: `digraph {
+	a;
+	b;
+	c [label="one two" tooltip="say \"hi\"\n"];
+	a -> b;
+}
+`,
+		},
+		{
+			name: "keywords, numerals and HTML",
+			src:  `digraph { "node" [width=.5 height=-1.25 label=<<b>x</b>>]; _x1 }`,
+			want: "digraph {\n\t\"node\" [height=-1.25 label=<<b>x</b>> width=.5];\n\t_x1;\n}\n",
+		},
+		{
+			name: "HTML strings and strings that look like them",
+			src: `digraph {
+				label=<<i>G</i>>;
+				node [label=<<b>\N</b>>];
+				edge [tooltip="<e>"];
+				subgraph s { node [label="<s>"]; a }
+				b [tooltip=<<u>b</u>> URL="<b>"];
+				c [label="<c>"];
+				a -> b [label=<a&rarr;b>];
+			}`,
+			want: `digraph {
+	label=<<i>G</i>>;
+	node [label=<<b>\N</b>>];
+	edge [tooltip="<e>"];
+	subgraph s {
+		node [label="<s>"];
+		a [label="<s>"];
+	}
+	b [URL="<b>" tooltip=<<u>b</u>>];
+	c [label="<c>"];
+	a -> b [label=<a&rarr;b>];
+}
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := Parse(tc.src)
+			if err != nil {
+				t.Fatalf("Parse: %s", err)
+			}
+			got := g.String()
+			if got != tc.want {
+				t.Errorf("String() =\n%s\nwant:\n%s", got, tc.want)
+			}
+
+			// String's output parses back to the same graph
+			again, err := Parse(got)
+			if err != nil {
+				t.Fatalf("Parse(String()): %s", err)
+			}
+			if again.String() != got {
+				t.Errorf("round trip =\n%s\nwant:\n%s", again.String(), got)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"not a graph", `node {}`, `dot: 1:1: expected graph or digraph, found "node"`},
+		{"unclosed graph", "digraph {\n a -> b", `dot: 2:8: unexpected end of input, expected '}'`},
+		{"unterminated string", `digraph { "a }`, `dot: 1:15: unterminated string`},
+		{"unterminated comment", `digraph { /* a }`, `dot: 1:11: unterminated comment`},
+		{"missing edge target", `digraph { a -> ; }`, `dot: 1:16: expected node, found ";"`},
+		{"missing attribute value", `digraph { a [color=] }`, `dot: 1:20: expected attribute value, found "]"`},
+		{"trailing input", `digraph {} x`, `dot: 1:12: unexpected "x" after graph`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.src)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Parse error = %v, want a *ParseError", err)
+			}
+			if err.Error() != tc.want {
+				t.Errorf("Parse error = %q, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestReplacedHTML(t *testing.T) {
+	g, err := Parse(`digraph { a [label=<<b>a</b>> tooltip=<<i>a</i>>] }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// values set since parsing are strings, whatever they look like
+	n := g.Node("a")
+	n.Attrs["label"] = "a/..."
+	n.Attrs["tooltip"] = "<a>"
+	n.Attrs["URL"] = "<b>"
+
+	want := "digraph {\n\ta [URL=\"<b>\" label=\"a/...\" tooltip=\"<a>\"];\n}\n"
+	if got := g.String(); got != want {
+		t.Errorf("String() =\n%s\nwant:\n%s", got, want)
+	}
+}
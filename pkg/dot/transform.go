@@ -0,0 +1,120 @@
+package dot
+
+import "slices"
+
+// MapNodes renames every node by fn. Nodes that fn maps to "" are removed,
+// along with their edges, and nodes that fn maps to the same ID are merged,
+// keeping the first node's attributes. Edges that become self-loops are
+// removed, and edges that become duplicates are merged, combining their
+// imports without repeating any. Subgraphs left empty are removed.
+func (g *Graph) MapNodes(fn func(id string) string) {
+	ids := make(map[string]string, len(g.Nodes))
+	nodes := g.Nodes
+	g.Nodes = nil
+	g.nodes = map[string]*Node{}
+	for _, n := range nodes {
+		id := fn(n.ID)
+		ids[n.ID] = id
+		if id == "" || g.nodes[id] != nil {
+			continue
+		}
+		n.ID = id
+		g.nodes[id] = n
+		g.Nodes = append(g.Nodes, n)
+	}
+
+	type key struct{ from, to string }
+	edges := g.Edges
+	g.Edges = nil
+	merged := map[key]*Edge{}
+	for _, e := range edges {
+		from, to := ids[e.From], ids[e.To]
+		if from == "" || to == "" || from == to {
+			continue
+		}
+		if prev, ok := merged[key{from, to}]; ok {
+			if imports := e.Imports(); len(imports) > 0 {
+				all := prev.Imports()
+				for _, imp := range imports {
+					if !slices.Contains(all, imp) {
+						all = append(all, imp)
+					}
+				}
+				prev.SetImports(all)
+			}
+			continue
+		}
+		e.From, e.To = from, to
+		merged[key{from, to}] = e
+		g.Edges = append(g.Edges, e)
+	}
+
+	placed := map[string]bool{}
+	var prune func(subs []*Subgraph) []*Subgraph
+	prune = func(subs []*Subgraph) []*Subgraph {
+		var kept []*Subgraph
+		for _, s := range subs {
+			var members []string
+			for _, old := range s.Nodes {
+				id, ok := ids[old]
+				if !ok || id == "" || placed[id] {
+					continue
+				}
+				placed[id] = true
+				members = append(members, id)
+			}
+			s.Nodes = members
+			s.Subgraphs = prune(s.Subgraphs)
+			if len(s.Nodes) > 0 || len(s.Subgraphs) > 0 {
+				kept = append(kept, s)
+			}
+		}
+		return kept
+	}
+	g.Subgraphs = prune(g.Subgraphs)
+}
+
+// ImpliedAttr is the edge attribute that marks an edge as implied by a longer
+// path, for outputs that keep the full edge set of a reduced graph.
+const ImpliedAttr = "implied"
+
+// ImpliedEdges returns the edges that a transitive reduction removes: those
+// whose head stays reachable from their tail without them. Edges are checked
+// in order, and each removal counts for later checks, so reachability is
+// preserved even when the graph has cycles.
+func (g *Graph) ImpliedEdges() []*Edge {
+	out := map[string][]*Edge{}
+	for _, e := range g.Edges {
+		out[e.From] = append(out[e.From], e)
+	}
+
+	removed := map[*Edge]bool{}
+	reachable := func(skip *Edge) bool {
+		seen := map[string]bool{skip.From: true}
+		queue := []string{skip.From}
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			for _, e := range out[id] {
+				if e == skip || removed[e] || seen[e.To] {
+					continue
+				}
+				if e.To == skip.To {
+					return true
+				}
+				seen[e.To] = true
+				queue = append(queue, e.To)
+			}
+		}
+		return false
+	}
+
+	var implied []*Edge
+	for _, e := range g.Edges {
+		if e.From != e.To && reachable(e) {
+			removed[e] = true
+			implied = append(implied, e)
+		}
+	}
+	return implied
+}
@@ -0,0 +1,175 @@
+package dot
+
+import (
+	"maps"
+	"path"
+	"slices"
+	"testing"
+)
+
+// edgeList formats edges as "from -> to".
+func edgeList(edges []*Edge) []string {
+	var out []string
+	for _, e := range edges {
+		out = append(out, e.From+" -> "+e.To)
+	}
+	return out
+}
+
+// reachability returns the nodes reachable from each node over edges.
+func reachability(edges []*Edge) map[string]map[string]bool {
+	out := map[string][]string{}
+	for _, e := range edges {
+		out[e.From] = append(out[e.From], e.To)
+	}
+	reach := map[string]map[string]bool{}
+	for from := range out {
+		seen := map[string]bool{}
+		queue := []string{from}
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			for _, to := range out[id] {
+				if !seen[to] {
+					seen[to] = true
+					queue = append(queue, to)
+				}
+			}
+		}
+		reach[from] = seen
+	}
+	return reach
+}
+
+func TestImpliedEdges(t *testing.T) {
+	testCases := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "chain",
+			src:  `digraph { a -> b -> c -> d }`,
+		},
+		{
+			name: "chain with shortcuts",
+			src:  `digraph { a -> b -> c -> d; a -> c; a -> d; b -> d }`,
+			want: []string{"a -> c", "a -> d", "b -> d"},
+		},
+		{
+			name: "diamond",
+			src:  `digraph { a -> b; a -> c; b -> d; c -> d }`,
+		},
+		{
+			name: "diamond with shortcut",
+			src:  `digraph { a -> d; a -> b; a -> c; b -> d; c -> d }`,
+			want: []string{"a -> d"},
+		},
+		{
+			name: "cycle",
+			src:  `digraph { a -> b -> c -> a }`,
+		},
+		{
+			name: "cycle with shortcut",
+			src:  `digraph { a -> b -> c -> a; a -> c }`,
+			want: []string{"a -> c"},
+		},
+		{
+			name: "two-way edges",
+			src:  `digraph { a -> b; b -> a; b -> c; c -> b }`,
+		},
+		{
+			// every edge is implied by the other direction around, but only
+			// enough are removed to leave one cycle
+			name: "two-way cycle",
+			src:  `digraph { a -> b; b -> c; c -> a; a -> c; c -> b; b -> a }`,
+			want: []string{"a -> b", "b -> c", "c -> a"},
+		},
+		{
+			name: "cycle into a chain",
+			src:  `digraph { a -> b -> a; b -> c -> d; a -> d }`,
+			want: []string{"a -> d"},
+		},
+		{
+			name: "self-loop",
+			src:  `digraph { a -> a; a -> b }`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := Parse(tc.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			implied := g.ImpliedEdges()
+			if got := edgeList(implied); !slices.Equal(got, tc.want) {
+				t.Errorf("ImpliedEdges() = %q, want %q", got, tc.want)
+			}
+
+			kept := slices.DeleteFunc(slices.Clone(g.Edges), func(e *Edge) bool { return slices.Contains(implied, e) })
+			want := reachability(g.Edges)
+			got := reachability(kept)
+			if !maps.EqualFunc(got, want, maps.Equal) {
+				t.Errorf("reduction changed reachability: %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestImpliedEdgesImports(t *testing.T) {
+	g, err := Parse(`digraph {
+		a -> b [imports="a.go"];
+		b -> c [imports="b.go;b_test.go _"];
+		a -> c [imports="a.go;c.go log" color=red];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	implied := g.ImpliedEdges()
+	if got := edgeList(implied); !slices.Equal(got, []string{"a -> c"}) {
+		t.Fatalf("ImpliedEdges() = %q, want [a -> c]", got)
+	}
+	// finding implied edges leaves every edge's attributes as they were
+	want := [][]Import{
+		{{File: "a.go"}},
+		{{File: "b.go"}, {File: "b_test.go", Alias: "_"}},
+		{{File: "a.go"}, {File: "c.go", Alias: "log"}},
+	}
+	for i, e := range g.Edges {
+		if got := e.Imports(); !slices.Equal(got, want[i]) {
+			t.Errorf("%s -> %s imports %v, want %v", e.From, e.To, got, want[i])
+		}
+	}
+	if got := implied[0].Attrs["color"]; got != "red" {
+		t.Errorf("implied edge color %q, want red", got)
+	}
+}
+
+func TestMapNodesImports(t *testing.T) {
+	g, err := Parse(`digraph {
+		"a/x" -> "b/x" [imports="a/x.go"];
+		"a/y" -> "b/y" [imports="a/y.go;a/x.go"];
+		"a/x" -> "b/y" [imports="a/x.go"];
+		"a/x" -> "a/y" [imports="a/x.go _"];
+		"b/x" -> "c/z";
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// merge each directory into one node
+	g.MapNodes(path.Dir)
+
+	if got, want := edgeList(g.Edges), []string{"a -> b", "b -> c"}; !slices.Equal(got, want) {
+		t.Fatalf("edges %q, want %q", got, want)
+	}
+	want := []Import{{File: "a/x.go"}, {File: "a/y.go"}}
+	if got := g.Edges[0].Imports(); !slices.Equal(got, want) {
+		t.Errorf("merged imports %v, want %v", got, want)
+	}
+	if got := g.Edges[1].Imports(); got != nil {
+		t.Errorf("imports %v, want none", got)
+	}
+}
@@ -0,0 +1,132 @@
+package dot
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	plainID   = regexp.MustCompile(`^[A-Za-z_\x{80}-\x{10FFFF}][A-Za-z_0-9\x{80}-\x{10FFFF}]*$`)
+	numeralID = regexp.MustCompile(`^-?(\.[0-9]+|[0-9]+(\.[0-9]*)?)$`)
+	keywords  = map[string]bool{
+		"strict": true, "graph": true, "digraph": true,
+		"subgraph": true, "node": true, "edge": true,
+	}
+)
+
+// Quote returns id as a DOT ID, quoting it if needed. It never writes an HTML
+// string, whatever id looks like; String writes attributes parsed from HTML
+// strings back verbatim.
+func Quote(id string) string {
+	if (plainID.MatchString(id) && !keywords[strings.ToLower(id)]) || numeralID.MatchString(id) {
+		return id
+	}
+	return `"` + strings.ReplaceAll(id, `"`, `\"`) + `"`
+}
+
+// quote returns the value of key as a DOT ID, writing HTML strings verbatim.
+func (a attrs) quote(key string) string {
+	if a.isHTML(key) {
+		return a.values[key]
+	}
+	return Quote(a.values[key])
+}
+
+// String returns the graph in DOT format. Attributes are written in sorted
+// order so the output is stable.
+func (g *Graph) String() string {
+	var sb strings.Builder
+
+	if g.Strict {
+		sb.WriteString("strict ")
+	}
+	kind, op := "graph", "--"
+	if g.Directed {
+		kind, op = "digraph", "->"
+	}
+	sb.WriteString(kind)
+	if g.ID != "" {
+		sb.WriteString(" " + Quote(g.ID))
+	}
+	sb.WriteString(" {\n")
+
+	written := map[string]bool{}
+	g.writeBody(&sb, 1,
+		attrs{g.Attrs, &g.html}, attrs{g.NodeAttrs, &g.nodeHTML}, attrs{g.EdgeAttrs, &g.edgeHTML},
+		g.Subgraphs, nil, written)
+
+	for _, n := range g.Nodes {
+		if !written[n.ID] {
+			g.writeNode(&sb, 1, n)
+		}
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&sb, "\t%s %s %s%s;\n", Quote(e.From), op, Quote(e.To), attrList(attrs{e.Attrs, &e.html}))
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func (g *Graph) writeBody(
+	sb *strings.Builder, depth int,
+	graphAttrs, nodeAttrs, edgeAttrs attrs,
+	subgraphs []*Subgraph, nodes []string,
+	written map[string]bool,
+) {
+	indent := strings.Repeat("\t", depth)
+	for _, k := range sortedKeys(graphAttrs.values) {
+		fmt.Fprintf(sb, "%s%s=%s;\n", indent, Quote(k), graphAttrs.quote(k))
+	}
+	if len(nodeAttrs.values) > 0 {
+		fmt.Fprintf(sb, "%snode%s;\n", indent, attrList(nodeAttrs))
+	}
+	if len(edgeAttrs.values) > 0 {
+		fmt.Fprintf(sb, "%sedge%s;\n", indent, attrList(edgeAttrs))
+	}
+
+	for _, s := range subgraphs {
+		fmt.Fprintf(sb, "%ssubgraph", indent)
+		if s.ID != "" {
+			sb.WriteString(" " + Quote(s.ID))
+		}
+		sb.WriteString(" {\n")
+		g.writeBody(sb, depth+1,
+			attrs{s.Attrs, &s.html}, attrs{s.NodeAttrs, &s.nodeHTML}, attrs{s.EdgeAttrs, &s.edgeHTML},
+			s.Subgraphs, s.Nodes, written)
+		fmt.Fprintf(sb, "%s}\n", indent)
+	}
+
+	for _, id := range nodes {
+		if n := g.Node(id); n != nil && !written[id] {
+			g.writeNode(sb, depth, n)
+			written[id] = true
+		}
+	}
+}
+
+func (g *Graph) writeNode(sb *strings.Builder, depth int, n *Node) {
+	fmt.Fprintf(sb, "%s%s%s;\n", strings.Repeat("\t", depth), Quote(n.ID), attrList(attrs{n.Attrs, &n.html}))
+}
+
+func attrList(a attrs) string {
+	if len(a.values) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(a.values))
+	for _, k := range sortedKeys(a.values) {
+		parts = append(parts, Quote(k)+"="+a.quote(k))
+	}
+	return " [" + strings.Join(parts, " ") + "]"
+}
+
+func sortedKeys(attrs Attrs) []string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,59 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/dot"
+)
+
+var d2Directions = map[string]string{
+	"TB": "down",
+	"BT": "up",
+	"LR": "right",
+	"RL": "left",
+}
+
+// D2 converts a graph to a D2 diagram, with clusters as containers.
+func D2(g *dot.Graph) string {
+	root, membership := clusterTree(g)
+	ids := nodeIDs(g)
+
+	var sb strings.Builder
+	if dir, ok := d2Directions[direction(g)]; ok {
+		fmt.Fprintf(&sb, "direction: %s\n", dir)
+	}
+
+	var write func(grp *group, depth int)
+	write = func(grp *group, depth int) {
+		indent := strings.Repeat("  ", depth)
+		for _, sub := range grp.groups {
+			fmt.Fprintf(&sb, "%s%s: %s {\n", indent, sub.id, d2Quote(sub.label))
+			write(sub, depth+1)
+			fmt.Fprintf(&sb, "%s}\n", indent)
+		}
+		for _, n := range grp.nodes {
+			label := strings.Join(g.NodeLabel(n), "\n")
+			fmt.Fprintf(&sb, "%s%s: %s\n", indent, ids[n.ID], d2Quote(label))
+		}
+	}
+	write(root, 0)
+
+	// edges refer to nodes by their full container path
+	path := func(id string) string {
+		parts := []string{ids[id]}
+		for grp := membership[id]; grp != nil && grp.parent != nil; grp = grp.parent {
+			parts = append([]string{grp.id}, parts...)
+		}
+		return strings.Join(parts, ".")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&sb, "%s -> %s\n", path(e.From), path(e.To))
+	}
+	return sb.String()
+}
+
+func d2Quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,85 @@
+package export
+
+// This package converts DOT graphs from goda into other diagram languages, so
+// dependency graphs can be pasted into Markdown, docs and architecture tools:
+//
+// - Mermaid flowcharts (.mmd)
+// - PlantUML component diagrams (.puml)
+// - D2 diagrams (.d2)
+// - GraphML documents (.graphml)
+// - JSON documents (.json), including the files that import each edge's head
+//
+// Cluster subgraphs, produced by `goda graph -cluster`, carry over as Mermaid
+// subgraphs, PlantUML packages, D2 containers and GraphML nested graphs.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/dot"
+)
+
+// group is a cluster in the graph, or the graph itself at the root, holding
+// the nodes directly inside it.
+type group struct {
+	id     string
+	label  string
+	nodes  []*dot.Node
+	groups []*group
+	parent *group
+}
+
+// clusterTree arranges a graph's nodes into its nested clusters. Non-cluster
+// subgraphs are flattened into their enclosing cluster.
+func clusterTree(g *dot.Graph) (*group, map[string]*group) {
+	root := &group{}
+	groups := map[*dot.Subgraph]*group{}
+	count := 0
+	g.Walk(func(s *dot.Subgraph, parents []*dot.Subgraph) {
+		if !s.IsCluster() {
+			return
+		}
+		parent := root
+		for i := len(parents) - 1; i >= 0; i-- {
+			if pg, ok := groups[parents[i]]; ok {
+				parent = pg
+				break
+			}
+		}
+		grp := &group{
+			id:     fmt.Sprintf("c%d", count),
+			label:  strings.Join(dot.LabelLines(s.Attrs.Get("label", s.ID), s.ID, g.ID), " "),
+			parent: parent,
+		}
+		count++
+		groups[s] = grp
+		parent.groups = append(parent.groups, grp)
+	})
+
+	clusters := g.Clusters()
+	membership := map[string]*group{}
+	for _, n := range g.Nodes {
+		grp := root
+		if chain := clusters[n.ID]; len(chain) > 0 {
+			grp = groups[chain[len(chain)-1]]
+		}
+		grp.nodes = append(grp.nodes, n)
+		membership[n.ID] = grp
+	}
+	return root, membership
+}
+
+// nodeIDs assigns short, syntax-safe identifiers to nodes, since package paths
+// contain characters most diagram languages reserve.
+func nodeIDs(g *dot.Graph) map[string]string {
+	ids := make(map[string]string, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+	}
+	return ids
+}
+
+// direction returns the graph's rankdir, defaulting to top-to-bottom.
+func direction(g *dot.Graph) string {
+	return strings.ToUpper(g.Attrs.Get("rankdir", "TB"))
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/siggy/gographs/pkg/dot"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// TestExportGolden converts each testdata/*.dot graph to every export format
+// and compares it to testdata/*.<ext>. Run with -update to rewrite the golden
+// files after an intended change, and review the diff.
+func TestExportGolden(t *testing.T) {
+	exporters := []struct {
+		ext    string
+		export func(*dot.Graph) string
+	}{
+		{"mmd", Mermaid},
+		{"puml", PlantUML},
+		{"d2", D2},
+		{"graphml", GraphML},
+		{"json", JSON},
+	}
+
+	files, err := filepath.Glob(filepath.Join("testdata", "*.dot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no testdata/*.dot files")
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".dot")
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range exporters {
+			t.Run(name+"."+e.ext, func(t *testing.T) {
+				g, err := dot.Parse(string(src))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := e.export(g)
+
+				golden := filepath.Join("testdata", name+"."+e.ext)
+				if *update {
+					if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("%s, run with -update to create it", err)
+				}
+				if got != string(want) {
+					t.Errorf("export differs from %s, run with -update and review the diff:\n%s", golden, got)
+				}
+			})
+		}
+	}
+}
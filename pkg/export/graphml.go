@@ -0,0 +1,61 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/dot"
+)
+
+// GraphML converts a graph to a GraphML document. Nodes keep their package
+// paths as IDs, and clusters become nested graphs.
+func GraphML(g *dot.Graph) string {
+	root, _ := clusterTree(g)
+
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	sb.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://graphml.graphdrawing.org/xmlns http://graphml.graphdrawing.org/xmlns/1.0/graphml.xsd">` + "\n")
+	sb.WriteString(`  <key id="label" for="node" attr.name="label" attr.type="string"/>` + "\n")
+	sb.WriteString(`  <key id="href" for="node" attr.name="href" attr.type="string"/>` + "\n")
+
+	graphID := g.ID
+	if graphID == "" {
+		graphID = "G"
+	}
+	fmt.Fprintf(&sb, "  <graph id=\"%s\" edgedefault=\"directed\">\n", xmlEscape(graphID))
+
+	var write func(grp *group, depth int)
+	write = func(grp *group, depth int) {
+		indent := strings.Repeat("  ", depth)
+		for _, sub := range grp.groups {
+			fmt.Fprintf(&sb, "%s<node id=\"%s\">\n", indent, sub.id)
+			fmt.Fprintf(&sb, "%s  <data key=\"label\">%s</data>\n", indent, xmlEscape(sub.label))
+			fmt.Fprintf(&sb, "%s  <graph id=\"%s:\" edgedefault=\"directed\">\n", indent, sub.id)
+			write(sub, depth+2)
+			fmt.Fprintf(&sb, "%s  </graph>\n", indent)
+			fmt.Fprintf(&sb, "%s</node>\n", indent)
+		}
+		for _, n := range grp.nodes {
+			fmt.Fprintf(&sb, "%s<node id=\"%s\">\n", indent, xmlEscape(n.ID))
+			fmt.Fprintf(&sb, "%s  <data key=\"label\">%s</data>\n", indent, xmlEscape(strings.Join(g.NodeLabel(n), "\n")))
+			if href := g.NodeAttr(n, "href", g.NodeAttr(n, "URL", "")); href != "" {
+				fmt.Fprintf(&sb, "%s  <data key=\"href\">%s</data>\n", indent, xmlEscape(href))
+			}
+			fmt.Fprintf(&sb, "%s</node>\n", indent)
+		}
+	}
+	write(root, 2)
+
+	for i, e := range g.Edges {
+		fmt.Fprintf(&sb, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\"/>\n", i, xmlEscape(e.From), xmlEscape(e.To))
+	}
+	sb.WriteString("  </graph>\n</graphml>\n")
+	return sb.String()
+}
+
+func xmlEscape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
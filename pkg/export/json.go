@@ -0,0 +1,69 @@
+package export
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/dot"
+)
+
+type jsonGraph struct {
+	Nodes []jsonNode `json:"nodes"`
+	Edges []jsonEdge `json:"edges"`
+}
+
+type jsonNode struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Href  string `json:"href,omitempty"`
+	// Clusters holds the labels of the node's enclosing clusters, outermost
+	// first.
+	Clusters []string `json:"clusters,omitempty"`
+}
+
+type jsonEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Imports lists the files in From that import To.
+	Imports []dot.Import `json:"imports"`
+	// Implied marks edges that a transitive reduction removes from the
+	// drawn graph.
+	Implied bool `json:"implied,omitempty"`
+}
+
+// JSON converts a graph to a JSON document of nodes and edges, including the
+// files behind each edge.
+func JSON(g *dot.Graph) string {
+	_, membership := clusterTree(g)
+
+	out := jsonGraph{
+		Nodes: make([]jsonNode, len(g.Nodes)),
+		Edges: make([]jsonEdge, len(g.Edges)),
+	}
+	for i, n := range g.Nodes {
+		node := jsonNode{
+			ID:    n.ID,
+			Label: strings.Join(g.NodeLabel(n), " "),
+			Href:  g.NodeAttr(n, "href", g.NodeAttr(n, "URL", "")),
+		}
+		for grp := membership[n.ID]; grp.parent != nil; grp = grp.parent {
+			node.Clusters = append([]string{grp.label}, node.Clusters...)
+		}
+		out.Nodes[i] = node
+	}
+	for i, e := range g.Edges {
+		imports := e.Imports()
+		if imports == nil {
+			imports = []dot.Import{}
+		}
+		out.Edges[i] = jsonEdge{
+			From:    e.From,
+			To:      e.To,
+			Imports: imports,
+			Implied: e.Attrs[dot.ImpliedAttr] == "true",
+		}
+	}
+
+	b, _ := json.MarshalIndent(out, "", "  ")
+	return string(b) + "\n"
+}
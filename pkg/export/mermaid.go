@@ -0,0 +1,54 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/dot"
+)
+
+// Mermaid converts a graph to a Mermaid flowchart.
+func Mermaid(g *dot.Graph) string {
+	root, _ := clusterTree(g)
+	ids := nodeIDs(g)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "flowchart %s\n", direction(g))
+
+	var write func(grp *group, depth int)
+	write = func(grp *group, depth int) {
+		indent := strings.Repeat("  ", depth)
+		for _, sub := range grp.groups {
+			fmt.Fprintf(&sb, "%ssubgraph %s [\"%s\"]\n", indent, sub.id, mermaidEscape(sub.label))
+			write(sub, depth+1)
+			fmt.Fprintf(&sb, "%send\n", indent)
+		}
+		for _, n := range grp.nodes {
+			lines := g.NodeLabel(n)
+			for i, line := range lines {
+				lines[i] = mermaidEscape(line)
+			}
+			label := strings.Join(lines, "<br>")
+			fmt.Fprintf(&sb, "%s%s[\"%s\"]\n", indent, ids[n.ID], label)
+		}
+	}
+	write(root, 1)
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&sb, "  %s --> %s\n", ids[e.From], ids[e.To])
+	}
+	return sb.String()
+}
+
+// mermaidEscape writes the characters Mermaid would read as markup, in
+// quotes, HTML tags and entity codes, as entity codes themselves.
+func mermaidEscape(s string) string {
+	return mermaidEscaper.Replace(s)
+}
+
+var mermaidEscaper = strings.NewReplacer(
+	`"`, "#quot;",
+	"#", "#35;",
+	"<", "#lt;",
+	">", "#gt;",
+)
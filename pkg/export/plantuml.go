@@ -0,0 +1,49 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/dot"
+)
+
+// PlantUML converts a graph to a PlantUML component diagram, with clusters as
+// packages.
+func PlantUML(g *dot.Graph) string {
+	root, _ := clusterTree(g)
+	ids := nodeIDs(g)
+
+	var sb strings.Builder
+	sb.WriteString("@startuml\n")
+	switch direction(g) {
+	case "LR", "RL":
+		sb.WriteString("left to right direction\n")
+	}
+
+	var write func(grp *group, depth int)
+	write = func(grp *group, depth int) {
+		indent := strings.Repeat("  ", depth)
+		for _, sub := range grp.groups {
+			fmt.Fprintf(&sb, "%spackage \"%s\" as %s {\n", indent, plantUMLEscape(sub.label), sub.id)
+			write(sub, depth+1)
+			fmt.Fprintf(&sb, "%s}\n", indent)
+		}
+		for _, n := range grp.nodes {
+			label := plantUMLEscape(strings.Join(g.NodeLabel(n), `\n`))
+			fmt.Fprintf(&sb, "%scomponent \"%s\" as %s\n", indent, label, ids[n.ID])
+		}
+	}
+	write(root, 0)
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&sb, "%s --> %s\n", ids[e.From], ids[e.To])
+	}
+	sb.WriteString("@enduml\n")
+	return sb.String()
+}
+
+// plantUMLEscape replaces double quotes, which PlantUML cannot escape inside
+// quoted names.
+func plantUMLEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "'")
+}
@@ -0,0 +1,290 @@
+package graph
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testBackend(name string) *backend {
+	b := &backend{name: name, url: name}
+	b.healthy.Store(true)
+	return b
+}
+
+// owners returns the server each repo goes to first.
+func owners(p *pool, repos []string) map[string]string {
+	out := map[string]string{}
+	for _, repo := range repos {
+		out[repo] = p.order(repo)[0].name
+	}
+	return out
+}
+
+func TestHashKey(t *testing.T) {
+	// web servers must agree on these, across versions, to send each repo to
+	// the same graph server
+	testCases := []struct {
+		key  string
+		hash uint64
+	}{
+		{"github.com/siggy/gographs", 0x6d96d3085d342713},
+		{"http://graph-0:8889#0", 0x399ce0f479090c2c},
+	}
+	for _, tc := range testCases {
+		if got := hashKey(tc.key); got != tc.hash {
+			t.Errorf("hashKey(%q) = %#x, want %#x", tc.key, got, tc.hash)
+		}
+	}
+}
+
+func TestRing(t *testing.T) {
+	a, b, c := testBackend("http://graph-0:8889"), testBackend("http://graph-1:8889"), testBackend("http://graph-2:8889")
+	p := newPool([]*backend{a, b, c})
+
+	if len(p.ring) != 3*ringReplicas {
+		t.Errorf("%d ring points, want %d", len(p.ring), 3*ringReplicas)
+	}
+	if !slices.IsSortedFunc(p.ring, func(x, y ringPoint) int { return cmp.Compare(x.hash, y.hash) }) {
+		t.Error("ring is not sorted")
+	}
+
+	repos := make([]string, 3000)
+	for i := range repos {
+		repos[i] = fmt.Sprintf("github.com/owner-%d/repo", i)
+	}
+	before := owners(p, repos)
+
+	// every server is tried, once
+	for _, repo := range repos[:100] {
+		order := p.order(repo)
+		if len(order) != 3 || order[0] == order[1] || order[1] == order[2] || order[0] == order[2] {
+			t.Fatalf("order(%s) = %v, want each server once", repo, order)
+		}
+	}
+
+	// repos spread evenly
+	counts := map[string]int{}
+	for _, owner := range before {
+		counts[owner]++
+	}
+	for _, s := range []*backend{a, b, c} {
+		if n := counts[s.name]; n < len(repos)/3*7/10 || n > len(repos)/3*13/10 {
+			t.Errorf("%s got %d of %d repos, want about a third", s.name, n, len(repos))
+		}
+	}
+
+	// web servers listing the servers in any order agree
+	if got := owners(newPool([]*backend{c, a, b}), repos); !maps.Equal(got, before) {
+		t.Error("owners depend on the order servers are listed in")
+	}
+
+	// a server leaving moves only its repos, to their next server
+	next := map[string]string{}
+	for _, repo := range repos {
+		next[repo] = p.order(repo)[1].name
+	}
+	for repo, owner := range owners(newPool([]*backend{a, b}), repos) {
+		want := before[repo]
+		if want == c.name {
+			want = next[repo]
+		}
+		if owner != want {
+			t.Errorf("without %s, %s moved from %s to %s, want %s", c.name, repo, before[repo], owner, want)
+		}
+	}
+
+	// a server joining takes repos only for itself
+	d := testBackend("http://graph-3:8889")
+	moved := 0
+	for repo, owner := range owners(newPool([]*backend{a, b, c, d}), repos) {
+		if owner == before[repo] {
+			continue
+		}
+		moved++
+		if owner != d.name {
+			t.Errorf("with %s, %s moved from %s to %s", d.name, repo, before[repo], owner)
+		}
+	}
+	if moved < len(repos)/4*7/10 || moved > len(repos)/4*13/10 {
+		t.Errorf("%d of %d repos moved to a fourth server, want about a quarter", moved, len(repos))
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	// listen on every loopback address, as one server per discovered address
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := make(chan string, 10)
+	closed := make(chan string, 10)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+	}))
+	srv.Listener.Close()
+	srv.Listener = l
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			host, _, _ := net.SplitHostPort(conn.LocalAddr().String())
+			closed <- host
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	base := "http://graph.test:" + port
+
+	var mu sync.Mutex
+	var addrs []string
+	var lookupErr error
+	setAddrs := func(a []string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		addrs, lookupErr = a, err
+	}
+	setAddrs([]string{"127.0.0.2", "127.0.0.1"}, nil)
+
+	c, err := NewClient(ClientConfig{
+		URLs:     []string{base},
+		Discover: true,
+		lookupHost: func(_ context.Context, host string) ([]string, error) {
+			if host != "graph.test" {
+				return nil, fmt.Errorf("looked up %s", host)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			return addrs, lookupErr
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := c.pool.Load().backends
+	want := []string{base + "@127.0.0.1:" + port, base + "@127.0.0.2:" + port}
+	if got := names(first); !slices.Equal(got, want) {
+		t.Fatalf("servers %v, want %v", got, want)
+	}
+
+	// each server is dialed by address, but asked for by host name
+	for _, b := range first {
+		c.check(b)
+		if host := <-hosts; host != "graph.test:"+port {
+			t.Errorf("request to %s for host %s, want graph.test:%s", b.name, host, port)
+		}
+	}
+
+	// servers that stay carry over, and servers that go are closed
+	setAddrs([]string{"127.0.0.3", "127.0.0.2"}, nil)
+	second := c.resolve(first)
+	want = []string{base + "@127.0.0.2:" + port, base + "@127.0.0.3:" + port}
+	if got := names(second); !slices.Equal(got, want) {
+		t.Fatalf("servers %v, want %v", got, want)
+	}
+	if second[0] != first[1] {
+		t.Error("the remaining server was replaced")
+	}
+	select {
+	case host := <-closed:
+		if host != "127.0.0.1" {
+			t.Errorf("closed the connection to %s, want 127.0.0.1", host)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("the removed server's connections were left open")
+	}
+
+	// failed lookups keep the last servers resolved
+	setAddrs(nil, errors.New("no such host"))
+	if third := c.resolve(second); !slices.Equal(third, second) {
+		t.Errorf("servers %v after a failed lookup, want %v", names(third), names(second))
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	type server struct {
+		healthy atomic.Bool
+		srv     *httptest.Server
+	}
+	servers := map[string]*server{}
+	var urls []string
+	for range 2 {
+		s := &server{}
+		s.healthy.Store(true)
+		s.srv = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/healthz" || r.Header.Get("Authorization") != "Bearer secret" || !s.healthy.Load() {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		t.Cleanup(s.srv.Close)
+		servers[s.srv.URL] = s
+		urls = append(urls, s.srv.URL)
+	}
+
+	c, err := NewClient(ClientConfig{URLs: urls, Security: Security{Token: "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := c.pool.Load()
+	const repo = "github.com/siggy/gographs"
+	order := p.order(repo)
+	first, second := order[0], order[1]
+
+	check := func(want ...*backend) {
+		t.Helper()
+		for _, b := range p.backends {
+			c.check(b)
+		}
+		if got := p.order(repo); !slices.Equal(got, want) {
+			t.Errorf("order %v, want %v", names(got), names(want))
+		}
+		for _, b := range p.backends {
+			healthy := 0.0
+			if b.healthy.Load() {
+				healthy = 1
+			}
+			if got := metricValue(t, backendHealthy.WithLabelValues(b.name)); got != healthy {
+				t.Errorf("%s healthy gauge %v, want %v", b.name, got, healthy)
+			}
+		}
+	}
+
+	check(first, second)
+
+	// an unhealthy server is ejected, so its repos go to the next one
+	servers[first.url].healthy.Store(false)
+	check(second)
+
+	// with every server unhealthy, all are tried rather than none
+	servers[second.url].healthy.Store(false)
+	check(first, second)
+
+	// a server passing its check again is readmitted
+	servers[first.url].healthy.Store(true)
+	check(first)
+	servers[second.url].healthy.Store(true)
+	check(first, second)
+
+	// as is an unreachable one
+	servers[second.url].srv.Close()
+	check(first)
+}
+
+func names(backends []*backend) []string {
+	var out []string
+	for _, b := range backends {
+		out = append(out, b.name)
+	}
+	return out
+}
@@ -0,0 +1,130 @@
+package graph
+
+import (
+	"sync"
+	"time"
+)
+
+// breakerState is the state of a circuit breaker, as reported in metrics.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+// breaker is a circuit breaker for one graph server. After failures
+// consecutive failures it opens, failing requests fast for cooldown, then lets
+// one trial request through: success closes it, failure opens it again. A nil
+// breaker, or one with no failures limit, always allows requests.
+type breaker struct {
+	backend  string
+	failures int
+	cooldown time.Duration
+	clock    clock
+
+	mu       sync.Mutex
+	state    breakerState
+	count    int
+	openedAt time.Time
+	// trial is set while the half-open trial request is in flight.
+	trial bool
+}
+
+func newBreaker(backend string, failures int, cooldown time.Duration, clock clock) *breaker {
+	b := &breaker{backend: backend, failures: failures, cooldown: cooldown, clock: clock}
+	breakerStates.WithLabelValues(backend).Set(float64(breakerClosed))
+	return b
+}
+
+// allow reports whether a request may be sent. Callers that are allowed must
+// report the outcome with success, failure or release.
+func (b *breaker) allow() bool {
+	if b.failures == 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.cooldown {
+			breakerRejections.WithLabelValues(b.backend).Inc()
+			return false
+		}
+		b.set(breakerHalfOpen)
+		b.trial = true
+		return true
+	case breakerHalfOpen:
+		if b.trial {
+			breakerRejections.WithLabelValues(b.backend).Inc()
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+// success records a response from the graph server, closing the breaker.
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.count = 0
+	b.trial = false
+	b.set(breakerClosed)
+}
+
+// failure records a failure to reach the graph server, opening the breaker
+// after too many, or after a failed trial.
+func (b *breaker) failure() {
+	if b.failures == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.count++
+	b.trial = false
+	if b.state == breakerHalfOpen || b.count >= b.failures {
+		b.openedAt = b.clock.Now()
+		b.set(breakerOpen)
+	}
+}
+
+// release records a request abandoned without an outcome, e.g. a hedge that
+// lost, letting another trial through.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+func (b *breaker) set(state breakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	breakerStates.WithLabelValues(b.backend).Set(float64(state))
+}
+
+// clock tells the time, and waits, for circuit breakers, retries and hedges,
+// so tests can control it.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+// realClock is the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
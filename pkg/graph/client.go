@@ -2,98 +2,483 @@ package graph
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-// Post defines the input POST body to the `/graph` endpoint.
+// Post defines the input POST body to the `/graph` and `/commit` endpoints.
+// Ref is a branch or tag, or empty for the default branch.
 // curl --data '{"repo":"github.com/siggy/gographs","cluster":true}' -X POST [graph-addr]/graph
+// curl --data '{"repo":"github.com/siggy/gographs","ref":"v1.0.0"}' -X POST [graph-addr]/commit
 type Post struct {
 	Repo    string `json:"repo"`
+	Ref     string `json:"ref,omitempty"`
 	Cluster bool   `json:"cluster"`
 }
 
-// Client provides a client to the graph server.
+// Client provides a client to one or more graph servers. Each repo goes to
+// the same server, by consistent hashing. Requests fail over, and hedge,
+// across servers, retry transient failures, and skip servers that fail health
+// checks or whose circuit breaker is open.
 type Client struct {
-	url string
-	log *log.Entry
+	pool atomic.Pointer[pool]
+
+	urls       []*url.URL
+	discover   bool
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	// transport is shared by servers dialed by URL, and cloned for those
+	// dialed by discovered address.
+	transport       *http.Transport
+	timeout         time.Duration
+	breakerFailures int
+	breakerCooldown time.Duration
+
+	token      string
+	grpc       bool
+	retries    int
+	hedgeDelay time.Duration
+	clock      clock
+	log        *log.Entry
 }
 
-// DefaultGraphAddr defines the graph server's address when running locally. If
-// the caller uses something other than the default it is assumed to be TLS'd.
+// DefaultGraphAddr defines the graph server's address when running locally.
 const DefaultGraphAddr = "localhost:8889"
 
-// NewClient creates a client to the graph server.
-func NewClient(addr string) *Client {
-	url := fmt.Sprintf("http://%s/graph", addr)
-	if addr != DefaultGraphAddr {
-		url = fmt.Sprintf("https://%s/graph", addr)
+const (
+	// DefaultTimeout bounds each request to the graph server. Graphing a large
+	// repo means cloning and loading it, so this is generous.
+	DefaultTimeout = 5 * time.Minute
+
+	// DefaultIdleConns is the number of idle connections kept open to the
+	// graph server, for reuse by later requests.
+	DefaultIdleConns = 32
+
+	// DefaultRetries is the number of times a request is retried after a
+	// transient failure.
+	DefaultRetries = 2
+
+	// DefaultHedgeDelay is how long to wait for a graph server before also
+	// asking the next one. Hedging is off by default: most slow requests are
+	// slow builds, which a second server would only build again.
+	DefaultHedgeDelay time.Duration = 0
+
+	// DefaultBreakerFailures is the number of consecutive failures that open a
+	// graph server's circuit breaker.
+	DefaultBreakerFailures = 5
+
+	// DefaultBreakerCooldown is how long an open circuit breaker fails
+	// requests fast before letting a trial request through.
+	DefaultBreakerCooldown = 30 * time.Second
+
+	// dialTimeout bounds connecting to the graph server, including the TLS
+	// handshake.
+	dialTimeout = 10 * time.Second
+
+	// retryBackoff and maxRetryBackoff bound the exponential backoff between
+	// retries.
+	retryBackoff    = 250 * time.Millisecond
+	maxRetryBackoff = 5 * time.Second
+)
+
+// ErrUnavailable is returned when every graph server's circuit breaker is
+// open.
+var ErrUnavailable = errors.New("no graph server available")
+
+// ClientConfig configures a graph client.
+type ClientConfig struct {
+	// URLs are the graph servers' base URLs, e.g. http://localhost:8889 or
+	// https://graph.internal.
+	URLs []string
+	// Security configures the client's certificate, the CAs to verify the
+	// servers with, and the shared token.
+	Security Security
+	// Timeout bounds each request, including reading the response. Zero
+	// means DefaultTimeout.
+	Timeout time.Duration
+	// IdleConns is the number of idle connections to keep open to each
+	// server. Zero means DefaultIdleConns.
+	IdleConns int
+	// Retries is the number of times to retry a request after a transient
+	// failure. Zero disables retries.
+	Retries int
+	// HedgeDelay is how long to wait for one server before also asking the
+	// next. Zero disables hedging.
+	HedgeDelay time.Duration
+	// BreakerFailures is the number of consecutive failures that open a
+	// server's circuit breaker, for BreakerCooldown. Zero disables breakers.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+	// HealthInterval is how often each server's /healthz is checked. Servers
+	// failing it are ejected until they pass. Zero disables health checks.
+	HealthInterval time.Duration
+	// Discover resolves each URL's host to all its addresses, e.g. a headless
+	// Kubernetes service, and uses one server per address. Addresses are
+	// re-resolved every HealthInterval.
+	Discover bool
+	// GRPC sends requests over the graph servers' gRPC API rather than their
+	// HTTP one. Plain http URLs then speak HTTP/2 without TLS.
+	GRPC bool
+
+	// clock defaults to the system clock, and lookupHost to the system
+	// resolver.
+	clock      clock
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+// GraphURL returns the base URL of a graph server at addr: https if sec
+// configures TLS, otherwise http.
+func GraphURL(addr string, sec Security) string {
+	if sec.tls() {
+		return "https://" + addr
 	}
+	return "http://" + addr
+}
+
+// NewClient creates a client to the graph servers.
+func NewClient(cfg ClientConfig) (*Client, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, errors.New("at least one graph URL required")
+	}
+
+	urls := make([]*url.URL, len(cfg.URLs))
+	for i, raw := range cfg.URLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid graph URL %q: %w", raw, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid graph URL %q, must be http(s)://HOST[:PORT]", raw)
+		}
+		if u.Scheme == "http" && cfg.Security.tls() {
+			return nil, fmt.Errorf("graph URL %q must be https to use TLS", raw)
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		urls[i] = u
+	}
+
+	tlsConfig, err := cfg.Security.clientTLS()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	clock := cfg.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	lookupHost := cfg.lookupHost
+	if lookupHost == nil {
+		lookupHost = net.DefaultResolver.LookupHost
+	}
+	idleConns := cfg.IdleConns
+	if idleConns == 0 {
+		idleConns = DefaultIdleConns
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.DialContext = (&net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = dialTimeout
+	transport.MaxIdleConns = idleConns * len(urls)
+	transport.MaxIdleConnsPerHost = idleConns
 
 	log := log.WithFields(
 		log.Fields{
-			"graphclient": url,
+			"graphclient": strings.Join(cfg.URLs, ","),
 		},
 	)
 
 	log.Infof("Graph client initialized")
 
-	return &Client{url, log}
+	c := &Client{
+		urls:            urls,
+		discover:        cfg.Discover,
+		lookupHost:      lookupHost,
+		transport:       transport,
+		timeout:         timeout,
+		breakerFailures: cfg.BreakerFailures,
+		breakerCooldown: cfg.BreakerCooldown,
+		token:           cfg.Security.Token,
+		grpc:            cfg.GRPC,
+		retries:         cfg.Retries,
+		hedgeDelay:      cfg.HedgeDelay,
+		clock:           clock,
+		log:             log,
+	}
+	c.pool.Store(newPool(c.resolve(nil)))
+
+	if cfg.HealthInterval > 0 {
+		go c.watch(cfg.HealthInterval)
+	}
+
+	return c, nil
 }
 
 // Get takes a repo and cluster flag and returns a DOT representation of the
 // repo.
 func (c *Client) Get(repo string, cluster bool) (string, error) {
-	body, err := json.Marshal(
-		Post{
-			Repo:    repo,
-			Cluster: cluster,
-		},
-	)
-	if err != nil {
-		return "", err
+	return c.GetRef(repo, "", cluster)
+}
+
+// GetRef returns a DOT representation of a repo at a branch or tag, or its
+// default branch if ref is empty.
+func (c *Client) GetRef(repo, ref string, cluster bool) (string, error) {
+	return c.post("/graph", Post{Repo: repo, Ref: ref, Cluster: cluster})
+}
+
+// Commit returns the commit at the head of a repo's default branch.
+func (c *Client) Commit(repo string) (string, error) {
+	return c.CommitRef(repo, "")
+}
+
+// CommitRef returns the commit a branch or tag of a repo points to, or the
+// head of its default branch if ref is empty.
+func (c *Client) CommitRef(repo, ref string) (string, error) {
+	return c.post("/commit", Post{Repo: repo, Ref: ref})
+}
+
+// statusError is a non-200 response from a graph server.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("POST response[%d] (%d bytes): %s ", e.code, len(e.body), e.body)
+}
+
+// unavailable reports whether a response status means the graph server, or a
+// proxy in front of it, is unhealthy, rather than that the request failed.
+func unavailable(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
 	}
+	return false
+}
+
+// retryable reports whether a failed request may succeed if sent again: the
+// graph server could not be reached, or was unavailable. Timeouts are not
+// retried, as the request already took as long as we allow.
+func retryable(err error) bool {
+	var serr *statusError
+	if errors.As(err, &serr) {
+		return unavailable(serr.code)
+	}
+	if s, ok := status.FromError(err); ok {
+		return s.Code() == codes.Unavailable
+	}
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return !uerr.Timeout()
+	}
+	return false
+}
 
-	c.log.Debugf("POST Request: %s", string(body))
+// backoff returns the jittered delay before retry n, counting from 0.
+func backoff(n int) time.Duration {
+	d := min(retryBackoff<<n, maxRetryBackoff)
+	return d/2 + rand.N(d/2)
+}
+
+// post sends a Post to a graph server endpoint and returns the response body,
+// retrying transient failures.
+func (c *Client) post(endpoint string, p Post) (string, error) {
+	c.log.Debugf("POST Request %s: %+v", endpoint, p)
 
-	labels := prometheus.Labels{repoLabel: repo, clusterLabel: strconv.FormatBool(cluster)}
+	labels := prometheus.Labels{repoLabel: p.Repo, clusterLabel: strconv.FormatBool(p.Cluster)}
 	httpRequests.With(labels).Inc()
+
+	timer := prometheus.NewTimer(httpDuration.With(labels))
+	defer timer.ObserveDuration()
+
+	for attempt := 0; ; attempt++ {
+		out, err := c.hedge(endpoint, p, labels)
+		if err == nil {
+			return out, nil
+		}
+		if attempt >= c.retries || !retryable(err) {
+			return "", err
+		}
+
+		delay := backoff(attempt)
+		c.log.Warnf("Retrying %s for %s in %s: %s", endpoint, p.Repo, delay, err)
+		retries.With(labels).Inc()
+		c.clock.Sleep(delay)
+	}
+}
+
+// hedge sends a request to the first of repo's graph servers whose circuit
+// breaker allows it. If that fails transiently, or is still pending after
+// hedgeDelay, it also sends it to the next server, and so on, returning the
+// first success.
+func (c *Client) hedge(endpoint string, p Post, labels prometheus.Labels) (string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type result struct {
+		out string
+		err error
+	}
+	pending := c.pool.Load().order(p.Repo)
+	results := make(chan result, len(pending))
+
+	inflight := 0
+	launch := func() bool {
+		for len(pending) > 0 {
+			b := pending[0]
+			pending = pending[1:]
+			if !b.breaker.allow() {
+				continue
+			}
+			inflight++
+			go func() {
+				out, err := c.send(ctx, b, endpoint, p, labels)
+				results <- result{out, err}
+			}()
+			return true
+		}
+		return false
+	}
+
+	if !launch() {
+		return "", ErrUnavailable
+	}
+
+	var hedgeTimer <-chan time.Time
+	resetHedge := func() {
+		hedgeTimer = nil
+		if c.hedgeDelay > 0 && len(pending) > 0 {
+			hedgeTimer = c.clock.After(c.hedgeDelay)
+		}
+	}
+	resetHedge()
+
+	var err error
+	for inflight > 0 {
+		select {
+		case <-hedgeTimer:
+			if launch() {
+				hedges.With(labels).Inc()
+			}
+			resetHedge()
+		case res := <-results:
+			inflight--
+			if res.err == nil {
+				return res.out, nil
+			}
+			err = res.err
+			if !retryable(err) {
+				// other servers would fail the same way
+				return "", err
+			}
+			if inflight == 0 && launch() {
+				resetHedge()
+			}
+		}
+	}
+	return "", err
+}
+
+// send makes one request to one graph server, over gRPC or the HTTP API's
+// JSON body, recording the outcome in its circuit breaker.
+func (c *Client) send(ctx context.Context, b *backend, endpoint string, p Post, labels prometheus.Labels) (string, error) {
 	httpErrors, err := httpErrors.CurryWith(labels)
 	if err != nil {
+		b.breaker.release()
 		return "", err
 	}
 
-	timer := prometheus.NewTimer(httpDuration.With(labels))
-	defer timer.ObserveDuration()
+	if c.grpc {
+		out, err := c.sendGRPC(ctx, b, endpoint, p)
+		switch {
+		case err == nil:
+			b.breaker.success()
+		case ctx.Err() != nil:
+			// another server answered first
+			b.breaker.release()
+		default:
+			httpErrors.WithLabelValues(grpcLabel(err)).Inc()
+			if grpcUnavailable(status.Code(err)) {
+				b.breaker.failure()
+			} else {
+				b.breaker.success()
+			}
+		}
+		return out, err
+	}
 
-	resp, err := http.Post(c.url, "text/plain; charset=utf-8", bytes.NewBuffer(body))
+	body, err := json.Marshal(p)
 	if err != nil {
-		httpErrors.WithLabelValues(err.Error()).Inc()
+		b.breaker.release()
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url+endpoint, bytes.NewReader(body))
 	if err != nil {
-		httpErrors.WithLabelValues(err.Error()).Inc()
+		b.breaker.release()
 		return "", err
 	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
 
-	debugStr := fmt.Sprintf("POST response[%d] (%d bytes): %s ", resp.StatusCode, len(respBody), string(respBody))
-	c.log.Debug(debugStr)
+	resp, err := b.http.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		var respBody []byte
+		respBody, err = io.ReadAll(resp.Body)
+		if err == nil {
+			return c.response(b, resp.StatusCode, respBody, httpErrors)
+		}
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		err := errors.New(debugStr)
-		httpErrors.WithLabelValues(err.Error()).Inc()
+	if ctx.Err() != nil {
+		// another server answered first
+		b.breaker.release()
 		return "", err
 	}
+	httpErrors.WithLabelValues(err.Error()).Inc()
+	b.breaker.failure()
+	return "", err
+}
+
+// response handles a graph server's response, recording it in its circuit
+// breaker.
+func (c *Client) response(b *backend, code int, body []byte, httpErrors *prometheus.CounterVec) (string, error) {
+	c.log.Debugf("POST response[%d] from %s (%d bytes): %s ", code, b.url, len(body), string(body))
 
-	return string(respBody), nil
+	if code == http.StatusOK {
+		b.breaker.success()
+		return string(body), nil
+	}
+
+	err := &statusError{code, string(body)}
+	httpErrors.WithLabelValues(err.Error()).Inc()
+	if unavailable(code) {
+		b.breaker.failure()
+	} else {
+		b.breaker.success()
+	}
+	return "", err
 }
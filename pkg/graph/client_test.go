@@ -0,0 +1,410 @@
+package graph
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fakeClock is a clock that only moves when told to, or when slept on.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+	sleeps []time.Duration
+	// afters receives the duration of each call to After.
+	afters chan time.Duration
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), afters: make(chan time.Duration, 100)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	c := make(chan time.Time, 1)
+	f.timers = append(f.timers, fakeTimer{f.now.Add(d), c})
+	f.mu.Unlock()
+	f.afters <- d
+	return c
+}
+
+// Sleep records d, and advances the clock by it rather than blocking.
+func (f *fakeClock) Sleep(d time.Duration) {
+	f.mu.Lock()
+	f.sleeps = append(f.sleeps, d)
+	f.mu.Unlock()
+	f.Advance(d)
+}
+
+// Advance moves the clock forward by d, firing timers that come due.
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	pending := f.timers[:0]
+	for _, t := range f.timers {
+		if t.at.After(f.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- f.now
+	}
+	f.timers = pending
+}
+
+func (f *fakeClock) Sleeps() []time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Duration(nil), f.sleeps...)
+}
+
+// failingServer serves a DOT graph, after failing the first failures requests
+// with code.
+func failingServer(t *testing.T, failures int, code int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if int(requests.Add(1)) <= failures {
+			http.Error(rw, http.StatusText(code), code)
+			return
+		}
+		rw.Write([]byte(testDot))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func metricValue(t *testing.T, m prometheus.Metric) float64 {
+	t.Helper()
+	var out dto.Metric
+	if err := m.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Gauge != nil {
+		return out.Gauge.GetValue()
+	}
+	return out.GetCounter().GetValue()
+}
+
+func TestBackoff(t *testing.T) {
+	for n := range 8 {
+		d := min(retryBackoff<<n, maxRetryBackoff)
+		seen := map[time.Duration]bool{}
+		for range 100 {
+			got := backoff(n)
+			if got < d/2 || got >= d {
+				t.Fatalf("backoff(%d) = %s, want [%s, %s)", n, got, d/2, d)
+			}
+			seen[got] = true
+		}
+		if len(seen) < 2 {
+			t.Errorf("backoff(%d) is not jittered: %v", n, seen)
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	clock := newFakeClock()
+	b := newBreaker("test-breaker", 3, time.Minute, clock)
+	rejected := metricValue(t, breakerRejections.WithLabelValues("test-breaker"))
+	state := func(want breakerState) {
+		t.Helper()
+		if got := breakerState(metricValue(t, breakerStates.WithLabelValues("test-breaker"))); got != want {
+			t.Errorf("breaker state %d, want %d", got, want)
+		}
+	}
+	allow := func(want bool) {
+		t.Helper()
+		if got := b.allow(); got != want {
+			t.Errorf("allow = %t, want %t", got, want)
+		}
+	}
+
+	// closed until 3 consecutive failures
+	for range 2 {
+		allow(true)
+		b.failure()
+	}
+	allow(true)
+	b.success()
+	state(breakerClosed)
+	for range 2 {
+		allow(true)
+		b.failure()
+	}
+	state(breakerClosed)
+	allow(true)
+	b.failure()
+	state(breakerOpen)
+
+	// open for the cooldown
+	allow(false)
+	clock.Advance(time.Minute - time.Second)
+	allow(false)
+
+	// then half-open, letting one trial through at a time
+	clock.Advance(time.Second)
+	allow(true)
+	state(breakerHalfOpen)
+	allow(false)
+
+	// a failed trial opens it again, for another cooldown
+	b.failure()
+	state(breakerOpen)
+	allow(false)
+	clock.Advance(time.Minute)
+	allow(true)
+
+	// an abandoned trial lets another through
+	b.release()
+	allow(true)
+	allow(false)
+
+	// a successful trial closes it
+	b.success()
+	state(breakerClosed)
+	allow(true)
+	allow(true)
+
+	rejections := metricValue(t, breakerRejections.WithLabelValues("test-breaker")) - rejected
+	if rejections != 5 {
+		t.Errorf("%v rejections, want 5", rejections)
+	}
+
+	disabled := newBreaker("test-disabled", 0, time.Minute, clock)
+	for range 10 {
+		disabled.failure()
+	}
+	if !disabled.allow() {
+		t.Error("a breaker without a failures limit opened")
+	}
+}
+
+func TestClientBreaker(t *testing.T) {
+	srv, requests := failingServer(t, 2, http.StatusServiceUnavailable)
+	clock := newFakeClock()
+	c, err := NewClient(ClientConfig{
+		URLs:            []string{srv.URL},
+		BreakerFailures: 2,
+		BreakerCooldown: 30 * time.Second,
+		clock:           clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if _, err := c.Get("github.com/test/breaker", false); err == nil {
+			t.Fatal("Get succeeded while the server fails")
+		}
+	}
+	// open: fail fast, without asking the server
+	if _, err := c.Get("github.com/test/breaker", false); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Get with an open breaker = %v, want ErrUnavailable", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("server got %d requests, want 2", n)
+	}
+
+	// half-open after the cooldown, and closed by the server's recovery
+	clock.Advance(30 * time.Second)
+	for range 2 {
+		if _, err := c.Get("github.com/test/breaker", false); err != nil {
+			t.Errorf("Get after the cooldown: %v", err)
+		}
+	}
+	if n := requests.Load(); n != 4 {
+		t.Errorf("server got %d requests, want 4", n)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	testCases := []struct {
+		name     string
+		failures int
+		code     int
+		retries  int
+		requests int32
+		ok       bool
+	}{
+		{"no failures", 0, http.StatusServiceUnavailable, 3, 1, true},
+		{"recovers", 3, http.StatusServiceUnavailable, 3, 4, true},
+		{"recovers from 429s", 2, http.StatusTooManyRequests, 3, 3, true},
+		{"recovers from 502s", 1, http.StatusBadGateway, 3, 2, true},
+		{"out of retries", 4, http.StatusServiceUnavailable, 3, 4, false},
+		{"retries disabled", 1, http.StatusServiceUnavailable, 0, 1, false},
+		{"failed builds are not retried", 1, http.StatusInternalServerError, 3, 1, false},
+		{"bad requests are not retried", 1, http.StatusBadRequest, 3, 1, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, requests := failingServer(t, tc.failures, tc.code)
+			clock := newFakeClock()
+			c, err := NewClient(ClientConfig{URLs: []string{srv.URL}, Retries: tc.retries, clock: clock})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			repo := "github.com/test/retries-" + tc.name
+			retried := metricValue(t, retries.WithLabelValues(repo, "false"))
+			out, err := c.Get(repo, false)
+			if tc.ok && (err != nil || out != testDot) {
+				t.Errorf("Get = %q, %v, want the graph", out, err)
+			}
+			var serr *statusError
+			if !tc.ok && (!errors.As(err, &serr) || serr.code != tc.code) {
+				t.Errorf("Get error %v, want status %d", err, tc.code)
+			}
+			if n := requests.Load(); n != tc.requests {
+				t.Errorf("server got %d requests, want %d", n, tc.requests)
+			}
+
+			// each retry waits a jittered, exponentially growing, backoff
+			sleeps := clock.Sleeps()
+			if len(sleeps) != int(tc.requests)-1 {
+				t.Errorf("slept %d times, want %d", len(sleeps), tc.requests-1)
+			}
+			for n, got := range sleeps {
+				d := min(retryBackoff<<n, maxRetryBackoff)
+				if got < d/2 || got >= d {
+					t.Errorf("retry %d waited %s, want [%s, %s)", n, got, d/2, d)
+				}
+			}
+			if got := metricValue(t, retries.WithLabelValues(repo, "false")) - retried; got != float64(len(sleeps)) {
+				t.Errorf("%v retries counted, want %d", got, len(sleeps))
+			}
+		})
+	}
+}
+
+// twoServers starts two graph servers, and returns a client to them along
+// with the URL of the server repo is sent to first. Requests to that server
+// are passed to first, and to the other to second.
+func twoServers(t *testing.T, cfg ClientConfig, repo string, first, second http.HandlerFunc) (*Client, string) {
+	t.Helper()
+	var firstURL atomic.Value
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if "http://"+r.Host == firstURL.Load() {
+			first(rw, r)
+			return
+		}
+		second(rw, r)
+	})
+	a := httptest.NewServer(handler)
+	t.Cleanup(a.Close)
+	b := httptest.NewServer(handler)
+	t.Cleanup(b.Close)
+
+	cfg.URLs = []string{a.URL, b.URL}
+	c, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := c.pool.Load().order(repo)[0].url
+	firstURL.Store(url)
+	return c, url
+}
+
+func TestClientFailover(t *testing.T) {
+	const repo = "github.com/test/failover"
+	var secondRequests atomic.Int32
+	clock := newFakeClock()
+	c, _ := twoServers(t, ClientConfig{clock: clock}, repo,
+		func(rw http.ResponseWriter, r *http.Request) {
+			http.Error(rw, "overloaded", http.StatusServiceUnavailable)
+		},
+		func(rw http.ResponseWriter, r *http.Request) {
+			secondRequests.Add(1)
+			rw.Write([]byte(testDot))
+		},
+	)
+
+	out, err := c.Get(repo, false)
+	if err != nil || out != testDot {
+		t.Errorf("Get = %q, %v, want the graph from the second server", out, err)
+	}
+	if n := secondRequests.Load(); n != 1 {
+		t.Errorf("second server got %d requests, want 1", n)
+	}
+	if sleeps := clock.Sleeps(); len(sleeps) != 0 {
+		t.Errorf("failover waited %v, want no wait", sleeps)
+	}
+}
+
+func TestClientHedge(t *testing.T) {
+	const repo = "github.com/test/hedge"
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	var secondRequests atomic.Int32
+	clock := newFakeClock()
+	c, _ := twoServers(t, ClientConfig{HedgeDelay: time.Second, clock: clock}, repo,
+		func(rw http.ResponseWriter, r *http.Request) {
+			// the server notices the client going away once the body is read
+			io.Copy(io.Discard, r.Body)
+			close(started)
+			<-r.Context().Done()
+			close(cancelled)
+		},
+		func(rw http.ResponseWriter, r *http.Request) {
+			secondRequests.Add(1)
+			rw.Write([]byte("digraph hedged {}"))
+		},
+	)
+
+	type result struct {
+		out string
+		err error
+	}
+	hedged := metricValue(t, hedges.WithLabelValues(repo, "false"))
+	results := make(chan result, 1)
+	go func() {
+		out, err := c.Get(repo, false)
+		results <- result{out, err}
+	}()
+
+	<-started
+	if d := <-clock.afters; d != time.Second {
+		t.Errorf("hedge delay %s, want 1s", d)
+	}
+	if n := secondRequests.Load(); n != 0 {
+		t.Errorf("hedged before the delay: %d requests", n)
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case res := <-results:
+		if res.err != nil || res.out != "digraph hedged {}" {
+			t.Errorf("Get = %q, %v, want the hedged graph", res.out, res.err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("hedge was not sent")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(10 * time.Second):
+		t.Error("the slow request was not cancelled")
+	}
+	if got := metricValue(t, hedges.WithLabelValues(repo, "false")) - hedged; got != 1 {
+		t.Errorf("%v hedges counted, want 1", got)
+	}
+}
@@ -12,29 +12,51 @@ import (
 	"time"
 
 	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
 	gogitclient "github.com/go-git/go-git/v5/plumbing/transport/client"
 	gogithttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/siggy/gographs/pkg/graph/graphpb"
 	"golang.org/x/net/html"
 )
 
-// toDir resolves a Go import path to a git clone URL and shallow-clones it into
-// a fresh temp directory, returning the directory path.
-func toDir(repo string) (string, error) {
+// toDir resolves a Go import path to a git clone URL and shallow-clones a ref
+// of it, or its default branch if ref is empty, into a fresh temp directory,
+// returning the checkout.
+func toDir(repo, ref string, progress progressFunc) (*checkout, error) {
+	progress(graphpb.Stage_STAGE_RESOLVING, "Resolving "+repo)
 	cloneURL, err := resolveGitURL(trimScheme(repo))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	var refName plumbing.ReferenceName
+	if ref != "" {
+		refName, _, err = remoteRef(cloneURL, ref)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	codeDir, err := os.MkdirTemp("", "") // already 0700 and empty
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if err := gitClone(cloneURL, codeDir); err != nil {
+	progress(graphpb.Stage_STAGE_CLONING, "Cloning "+cloneURL)
+	commit, err := gitClone(cloneURL, refName, codeDir)
+	if err != nil {
 		os.RemoveAll(codeDir)
-		return "", err
+		return nil, err
+	}
+
+	co := &checkout{path: codeDir, url: cloneURL, commit: commit}
+	if err := co.findModules(); err != nil {
+		os.RemoveAll(codeDir)
+		return nil, err
 	}
-	return codeDir, nil
+	return co, nil
 }
 
 // resolveGitURL maps a Go import path to an https git clone URL.
@@ -128,8 +150,7 @@ func blockPrivate(network, address string, _ syscall.RawConn) error {
 // installHTTPOnce registers the SSRF-protected HTTP client with go-git once.
 var installHTTPOnce sync.Once
 
-// gitClone shallow-clones cloneURL into dir using pure-Go git (no git binary required).
-func gitClone(cloneURL, dir string) error {
+func installHTTP() {
 	installHTTPOnce.Do(func() {
 		gogitclient.InstallProtocol("https", gogithttp.NewClient(&http.Client{
 			Transport: &http.Transport{
@@ -137,17 +158,96 @@ func gitClone(cloneURL, dir string) error {
 			},
 		}))
 	})
+}
+
+// headCommit returns the commit a ref of a repo points to, without cloning
+// it. An empty ref means the default branch.
+func headCommit(repo, ref string) (string, error) {
+	cloneURL, err := resolveGitURL(trimScheme(repo))
+	if err != nil {
+		return "", err
+	}
+	_, commit, err := remoteRef(cloneURL, ref)
+	return commit, err
+}
+
+// remoteRef returns the full name of the reference a ref names in a remote
+// repo, and the commit it points to. An empty ref means the default branch,
+// otherwise ref is a branch, a tag, or a full reference name.
+func remoteRef(cloneURL, ref string) (plumbing.ReferenceName, string, error) {
+	installHTTP()
 
-	_, err := gogit.PlainClone(dir, false, &gogit.CloneOptions{
-		URL:          cloneURL,
-		Depth:        1,
-		SingleBranch: true,
-		Tags:         gogit.NoTags,
+	remote := gogit.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: gogit.DefaultRemoteName,
+		URLs: []string{cloneURL},
 	})
+	list, err := remote.List(&gogit.ListOptions{PeelingOption: gogit.AppendPeeled})
 	if err != nil {
-		return fmt.Errorf("git clone failed: %w", err)
+		return "", "", fmt.Errorf("git ls-remote failed: %w", err)
 	}
-	return nil
+
+	refs := map[plumbing.ReferenceName]*plumbing.Reference{}
+	for _, r := range list {
+		refs[r.Name()] = r
+	}
+
+	var found *plumbing.Reference
+	if ref == "" {
+		// HEAD is usually a symbolic ref to the default branch.
+		found = refs[plumbing.HEAD]
+		for range len(refs) {
+			if found == nil || found.Type() != plumbing.SymbolicReference {
+				break
+			}
+			found = refs[found.Target()]
+		}
+	} else {
+		for _, name := range []plumbing.ReferenceName{
+			plumbing.NewBranchReferenceName(ref),
+			plumbing.NewTagReferenceName(ref),
+			plumbing.ReferenceName(ref),
+		} {
+			if found = refs[name]; found != nil {
+				break
+			}
+		}
+	}
+	if found == nil || found.Type() != plumbing.HashReference {
+		if ref == "" {
+			return "", "", fmt.Errorf("no HEAD commit for %s", cloneURL)
+		}
+		return "", "", fmt.Errorf("no ref %q in %s", ref, cloneURL)
+	}
+
+	// annotated tags point to tag objects, peeled to their commits
+	commit := found.Hash()
+	if peeled := refs[found.Name()+"^{}"]; peeled != nil {
+		commit = peeled.Hash()
+	}
+	return found.Name(), commit.String(), nil
+}
+
+// gitClone shallow-clones a reference of cloneURL, or its default branch if
+// refName is empty, into dir using pure-Go git (no git binary required),
+// returning the commit it checked out.
+func gitClone(cloneURL string, refName plumbing.ReferenceName, dir string) (string, error) {
+	installHTTP()
+
+	r, err := gogit.PlainClone(dir, false, &gogit.CloneOptions{
+		URL:           cloneURL,
+		ReferenceName: refName,
+		Depth:         1,
+		SingleBranch:  true,
+		Tags:          gogit.NoTags,
+	})
+	if err != nil {
+		return "", fmt.Errorf("git clone failed: %w", err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return "", fmt.Errorf("git head failed: %w", err)
+	}
+	return head.Hash().String(), nil
 }
 
 // trimScheme strips a leading scheme (e.g. "https://") from a repo path.
@@ -11,6 +11,9 @@ package graph
 //    git clone --depth 1 https://github.com/siggy/gographs /repos/https://github.com/siggy/gographs"
 // 2. dir => dot
 //    goda graph -short -cluster github.com/siggy/gographs...
+// 3. dot => dot with details
+//    edges record the files that import their head, nodes link to pkg.go.dev
+//    or the source host, edges to the importing files
 
 import (
 	"bytes"
@@ -18,17 +21,59 @@ import (
 	"os/exec"
 	"strings"
 
+	"github.com/siggy/gographs/pkg/dot"
+	"github.com/siggy/gographs/pkg/graph/graphpb"
 	log "github.com/sirupsen/logrus"
 )
 
-func repoToDot(repo string, cluster bool) (string, error) {
-	codeDir, err := toDir(repo)
+// progressFunc receives the stages of a build as it reaches them.
+type progressFunc func(stage graphpb.Stage, message string)
+
+func noProgress(graphpb.Stage, string) {}
+
+// build is a repo's graph.
+type build struct {
+	commit string
+	dot    string
+	// graph is the parsed DOT graph, or nil if it failed to parse.
+	graph *dot.Graph
+}
+
+func repoToDot(repo, ref string, cluster bool, links Links) (string, error) {
+	b, err := buildRepo(repo, ref, cluster, links, noProgress)
 	if err != nil {
-		log.Errorf("failed to get dir: %s", err)
 		return "", err
 	}
+	return b.dot, nil
+}
+
+// buildRepo clones a ref of repo, or its default branch if ref is empty, and
+// graphs it, reporting progress.
+func buildRepo(repo, ref string, cluster bool, links Links, progress progressFunc) (*build, error) {
+	co, err := toDir(repo, ref, progress)
+	if err != nil {
+		log.Errorf("failed to get dir: %s", err)
+		return nil, err
+	}
+
+	progress(graphpb.Stage_STAGE_ANALYZING, "Analyzing packages at "+co.commit)
+	src, err := dirToDot(co.path, cluster)
+	if err != nil {
+		return nil, err
+	}
+	b := &build{commit: co.commit, dot: src}
+
+	// details are cosmetic, so fall back to goda's output if it fails to parse
+	g, err := dot.Parse(src)
+	if err != nil {
+		log.Warnf("failed to parse dot for details: %s", err)
+		return b, nil
+	}
+	annotateImports(g, co)
+	links.apply(g, co)
 
-	return dirToDot(codeDir, cluster)
+	b.dot, b.graph = g.String(), g
+	return b, nil
 }
 
 func dirToDot(dir string, cluster bool) (string, error) {
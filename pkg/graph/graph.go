@@ -12,27 +12,79 @@ import (
 
 const graphServer = "graph"
 
-// Start initializes the graph server and starts listening.
-func Start(addr string) error {
-	router := mux.NewRouter()
-	router.Use(prom.Middleware(graphServer))
+// Start initializes the graph server and starts listening. links sets the URL
+// templates for node and edge hrefs, by source host, and sec how clients must
+// authenticate.
+func Start(addr string, links Links, sec Security) error {
+	tlsConfig, err := sec.serverTLS()
+	if err != nil {
+		return err
+	}
 
 	log := log.WithFields(
 		log.Fields{
 			graphServer: addr,
 		},
 	)
+	if sec.Token == "" && (tlsConfig == nil || tlsConfig.ClientCAs == nil) {
+		log.Warnf("%s server accepts unauthenticated requests, expose it only to trusted networks", graphServer)
+	}
+
+	router := newRouter(log, links, &grpcServer{
+		log:        log,
+		links:      links,
+		token:      sec.Token,
+		buildRepo:  buildRepo,
+		headCommit: headCommit,
+	})
+
+	log.Infof("%s server listening on %s", graphServer, addr)
+
+	// gRPC requires HTTP/2, which plain-text clients speak without upgrading
+	protocols := &http.Protocols{}
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	server := &http.Server{Addr: addr, Handler: router, TLSConfig: tlsConfig, Protocols: protocols}
+	if tlsConfig == nil {
+		return server.ListenAndServe()
+	}
+	return server.ListenAndServeTLS("", "")
+}
+
+// newRouter routes the HTTP API, and gRPC calls to rpc, requiring rpc's token
+// of both if set.
+func newRouter(log *log.Entry, links Links, rpc *grpcServer) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(prom.Middleware(graphServer))
+	if rpc.token != "" {
+		router.Use(tokenMiddleware(rpc.token))
+	}
+
+	// grpc api, matched by content type, as its paths are its own
+	router.MatcherFunc(func(r *http.Request, _ *mux.RouteMatch) bool {
+		return r.Method == http.MethodPost && isGRPC(r)
+	}).Handler(newGRPCServer(rpc))
 
 	// apis
-	graphHandler := mkGraphHandler(log)
+	graphHandler := mkGraphHandler(log, links)
 	router.HandleFunc("/graph", graphHandler).Methods(http.MethodPost)
+	router.HandleFunc("/commit", mkCommitHandler(log)).Methods(http.MethodPost)
+	router.HandleFunc("/healthz", healthHandler).Methods(http.MethodGet)
 
-	log.Infof("%s server listening on %s", graphServer, addr)
+	return router
+}
 
-	return http.ListenAndServe(addr, router)
+// healthHandler reports the server is up, for graph clients' health checks.
+func healthHandler(rw http.ResponseWriter, r *http.Request) {
+	// GET /healthz
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("ok\n"))
 }
 
-func mkGraphHandler(log *log.Entry) http.HandlerFunc {
+func mkGraphHandler(log *log.Entry, links Links) http.HandlerFunc {
 	// curl --data '{"repo":"github.com/siggy/gographs","cluster":true}' -X POST /graph
 	return func(rw http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
@@ -46,7 +98,7 @@ func mkGraphHandler(log *log.Entry) http.HandlerFunc {
 
 		log.Debugf("Processing %s", p.Repo)
 
-		dot, err := repoToDot(p.Repo, p.Cluster)
+		dot, err := repoToDot(p.Repo, p.Ref, p.Cluster, links)
 		if err != nil {
 			message := fmt.Sprintf("Failed to render dot: %s", p.Repo)
 			writeError(rw, r, http.StatusInternalServerError, message, err)
@@ -59,6 +111,33 @@ func mkGraphHandler(log *log.Entry) http.HandlerFunc {
 	}
 }
 
+func mkCommitHandler(log *log.Entry) http.HandlerFunc {
+	// curl --data '{"repo":"github.com/siggy/gographs"}' -X POST /commit
+	return func(rw http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+		var p Post
+		err := decoder.Decode(&p)
+		if err != nil {
+			message := fmt.Sprintf("Failed to decode POST body %s", p.Repo)
+			writeError(rw, r, http.StatusInternalServerError, message, err)
+			return
+		}
+
+		log.Debugf("Resolving commit for %s", p.Repo)
+
+		commit, err := headCommit(p.Repo, p.Ref)
+		if err != nil {
+			message := fmt.Sprintf("Failed to resolve commit: %s", p.Repo)
+			writeError(rw, r, http.StatusInternalServerError, message, err)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(commit))
+	}
+}
+
 // writeError handles all errors returned by the web server. It writes an error
 // header, an optional error message, counts the error in metrics, and logs it.
 // TODO: factor out with web.go
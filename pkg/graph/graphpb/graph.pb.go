@@ -0,0 +1,805 @@
+// The graph server's gRPC API. Package graphpb is generated from this file
+// with protoc-gen-go and protoc-gen-go-grpc, as other services' clients may
+// be. Regenerate it with go generate after changing it.
+//
+// Servers configured with a shared token require it in the "authorization"
+// metadata, as "Bearer TOKEN". Servers configured with a CA require a client
+// certificate signed by it.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: graph.proto
+
+package graphpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Stage int32
+
+const (
+	Stage_STAGE_UNSPECIFIED Stage = 0
+	Stage_STAGE_RESOLVING   Stage = 1
+	Stage_STAGE_CLONING     Stage = 2
+	Stage_STAGE_ANALYZING   Stage = 3
+	Stage_STAGE_DONE        Stage = 4
+)
+
+// Enum value maps for Stage.
+var (
+	Stage_name = map[int32]string{
+		0: "STAGE_UNSPECIFIED",
+		1: "STAGE_RESOLVING",
+		2: "STAGE_CLONING",
+		3: "STAGE_ANALYZING",
+		4: "STAGE_DONE",
+	}
+	Stage_value = map[string]int32{
+		"STAGE_UNSPECIFIED": 0,
+		"STAGE_RESOLVING":   1,
+		"STAGE_CLONING":     2,
+		"STAGE_ANALYZING":   3,
+		"STAGE_DONE":        4,
+	}
+)
+
+func (x Stage) Enum() *Stage {
+	p := new(Stage)
+	*p = x
+	return p
+}
+
+func (x Stage) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Stage) Descriptor() protoreflect.EnumDescriptor {
+	return file_graph_proto_enumTypes[0].Descriptor()
+}
+
+func (Stage) Type() protoreflect.EnumType {
+	return &file_graph_proto_enumTypes[0]
+}
+
+func (x Stage) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Stage.Descriptor instead.
+func (Stage) EnumDescriptor() ([]byte, []int) {
+	return file_graph_proto_rawDescGZIP(), []int{0}
+}
+
+type BuildRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Go import path, e.g. github.com/siggy/gographs.
+	Repo string `protobuf:"bytes,1,opt,name=repo,proto3" json:"repo,omitempty"`
+	// Branch or tag to graph. Defaults to the default branch.
+	Ref           string        `protobuf:"bytes,2,opt,name=ref,proto3" json:"ref,omitempty"`
+	Options       *BuildOptions `protobuf:"bytes,3,opt,name=options,proto3" json:"options,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BuildRequest) Reset() {
+	*x = BuildRequest{}
+	mi := &file_graph_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BuildRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BuildRequest) ProtoMessage() {}
+
+func (x *BuildRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_graph_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BuildRequest.ProtoReflect.Descriptor instead.
+func (*BuildRequest) Descriptor() ([]byte, []int) {
+	return file_graph_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *BuildRequest) GetRepo() string {
+	if x != nil {
+		return x.Repo
+	}
+	return ""
+}
+
+func (x *BuildRequest) GetRef() string {
+	if x != nil {
+		return x.Ref
+	}
+	return ""
+}
+
+func (x *BuildRequest) GetOptions() *BuildOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type BuildOptions struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Group packages by directory.
+	Cluster       bool `protobuf:"varint,1,opt,name=cluster,proto3" json:"cluster,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BuildOptions) Reset() {
+	*x = BuildOptions{}
+	mi := &file_graph_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BuildOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BuildOptions) ProtoMessage() {}
+
+func (x *BuildOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_graph_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BuildOptions.ProtoReflect.Descriptor instead.
+func (*BuildOptions) Descriptor() ([]byte, []int) {
+	return file_graph_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *BuildOptions) GetCluster() bool {
+	if x != nil {
+		return x.Cluster
+	}
+	return false
+}
+
+type BuildEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*BuildEvent_Progress
+	//	*BuildEvent_Graph
+	Event         isBuildEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BuildEvent) Reset() {
+	*x = BuildEvent{}
+	mi := &file_graph_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BuildEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BuildEvent) ProtoMessage() {}
+
+func (x *BuildEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_graph_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BuildEvent.ProtoReflect.Descriptor instead.
+func (*BuildEvent) Descriptor() ([]byte, []int) {
+	return file_graph_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BuildEvent) GetEvent() isBuildEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *BuildEvent) GetProgress() *Progress {
+	if x != nil {
+		if x, ok := x.Event.(*BuildEvent_Progress); ok {
+			return x.Progress
+		}
+	}
+	return nil
+}
+
+func (x *BuildEvent) GetGraph() *RepoGraph {
+	if x != nil {
+		if x, ok := x.Event.(*BuildEvent_Graph); ok {
+			return x.Graph
+		}
+	}
+	return nil
+}
+
+type isBuildEvent_Event interface {
+	isBuildEvent_Event()
+}
+
+type BuildEvent_Progress struct {
+	Progress *Progress `protobuf:"bytes,1,opt,name=progress,proto3,oneof"`
+}
+
+type BuildEvent_Graph struct {
+	// Graph is the last event of a successful build.
+	Graph *RepoGraph `protobuf:"bytes,2,opt,name=graph,proto3,oneof"`
+}
+
+func (*BuildEvent_Progress) isBuildEvent_Event() {}
+
+func (*BuildEvent_Graph) isBuildEvent_Event() {}
+
+type Progress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Stage         Stage                  `protobuf:"varint,1,opt,name=stage,proto3,enum=gographs.graph.v1.Stage" json:"stage,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Progress) Reset() {
+	*x = Progress{}
+	mi := &file_graph_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Progress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Progress) ProtoMessage() {}
+
+func (x *Progress) ProtoReflect() protoreflect.Message {
+	mi := &file_graph_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Progress.ProtoReflect.Descriptor instead.
+func (*Progress) Descriptor() ([]byte, []int) {
+	return file_graph_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Progress) GetStage() Stage {
+	if x != nil {
+		return x.Stage
+	}
+	return Stage_STAGE_UNSPECIFIED
+}
+
+func (x *Progress) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// RepoGraph is a built repo's graph. It is not named Graph, which would
+// collide with the service.
+type RepoGraph struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Commit is the commit graphed.
+	Commit string `protobuf:"bytes,1,opt,name=commit,proto3" json:"commit,omitempty"`
+	// Dot is the graph in Graphviz DOT, as served by the HTTP API.
+	Dot           string  `protobuf:"bytes,2,opt,name=dot,proto3" json:"dot,omitempty"`
+	Nodes         []*Node `protobuf:"bytes,3,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	Edges         []*Edge `protobuf:"bytes,4,rep,name=edges,proto3" json:"edges,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RepoGraph) Reset() {
+	*x = RepoGraph{}
+	mi := &file_graph_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RepoGraph) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RepoGraph) ProtoMessage() {}
+
+func (x *RepoGraph) ProtoReflect() protoreflect.Message {
+	mi := &file_graph_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RepoGraph.ProtoReflect.Descriptor instead.
+func (*RepoGraph) Descriptor() ([]byte, []int) {
+	return file_graph_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *RepoGraph) GetCommit() string {
+	if x != nil {
+		return x.Commit
+	}
+	return ""
+}
+
+func (x *RepoGraph) GetDot() string {
+	if x != nil {
+		return x.Dot
+	}
+	return ""
+}
+
+func (x *RepoGraph) GetNodes() []*Node {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *RepoGraph) GetEdges() []*Edge {
+	if x != nil {
+		return x.Edges
+	}
+	return nil
+}
+
+type Node struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Label string                 `protobuf:"bytes,2,opt,name=label,proto3" json:"label,omitempty"`
+	Href  string                 `protobuf:"bytes,3,opt,name=href,proto3" json:"href,omitempty"`
+	// Labels of the node's enclosing clusters, outermost first.
+	Clusters      []string `protobuf:"bytes,4,rep,name=clusters,proto3" json:"clusters,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Node) Reset() {
+	*x = Node{}
+	mi := &file_graph_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Node) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Node) ProtoMessage() {}
+
+func (x *Node) ProtoReflect() protoreflect.Message {
+	mi := &file_graph_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Node.ProtoReflect.Descriptor instead.
+func (*Node) Descriptor() ([]byte, []int) {
+	return file_graph_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Node) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Node) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *Node) GetHref() string {
+	if x != nil {
+		return x.Href
+	}
+	return ""
+}
+
+func (x *Node) GetClusters() []string {
+	if x != nil {
+		return x.Clusters
+	}
+	return nil
+}
+
+type Edge struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	From  string                 `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To    string                 `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	// Files in from that import to.
+	Imports       []*Import `protobuf:"bytes,3,rep,name=imports,proto3" json:"imports,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Edge) Reset() {
+	*x = Edge{}
+	mi := &file_graph_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Edge) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Edge) ProtoMessage() {}
+
+func (x *Edge) ProtoReflect() protoreflect.Message {
+	mi := &file_graph_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Edge.ProtoReflect.Descriptor instead.
+func (*Edge) Descriptor() ([]byte, []int) {
+	return file_graph_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Edge) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *Edge) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *Edge) GetImports() []*Import {
+	if x != nil {
+		return x.Imports
+	}
+	return nil
+}
+
+type Import struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	File          string                 `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
+	Alias         string                 `protobuf:"bytes,2,opt,name=alias,proto3" json:"alias,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Import) Reset() {
+	*x = Import{}
+	mi := &file_graph_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Import) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Import) ProtoMessage() {}
+
+func (x *Import) ProtoReflect() protoreflect.Message {
+	mi := &file_graph_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Import.ProtoReflect.Descriptor instead.
+func (*Import) Descriptor() ([]byte, []int) {
+	return file_graph_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Import) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *Import) GetAlias() string {
+	if x != nil {
+		return x.Alias
+	}
+	return ""
+}
+
+type CommitRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Repo  string                 `protobuf:"bytes,1,opt,name=repo,proto3" json:"repo,omitempty"`
+	// Branch or tag. Defaults to the default branch.
+	Ref           string `protobuf:"bytes,2,opt,name=ref,proto3" json:"ref,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitRequest) Reset() {
+	*x = CommitRequest{}
+	mi := &file_graph_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitRequest) ProtoMessage() {}
+
+func (x *CommitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_graph_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitRequest.ProtoReflect.Descriptor instead.
+func (*CommitRequest) Descriptor() ([]byte, []int) {
+	return file_graph_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CommitRequest) GetRepo() string {
+	if x != nil {
+		return x.Repo
+	}
+	return ""
+}
+
+func (x *CommitRequest) GetRef() string {
+	if x != nil {
+		return x.Ref
+	}
+	return ""
+}
+
+type CommitResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Commit        string                 `protobuf:"bytes,1,opt,name=commit,proto3" json:"commit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitResponse) Reset() {
+	*x = CommitResponse{}
+	mi := &file_graph_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitResponse) ProtoMessage() {}
+
+func (x *CommitResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_graph_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitResponse.ProtoReflect.Descriptor instead.
+func (*CommitResponse) Descriptor() ([]byte, []int) {
+	return file_graph_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CommitResponse) GetCommit() string {
+	if x != nil {
+		return x.Commit
+	}
+	return ""
+}
+
+var File_graph_proto protoreflect.FileDescriptor
+
+const file_graph_proto_rawDesc = "" +
+	"\n" +
+	"\vgraph.proto\x12\x11gographs.graph.v1\"o\n" +
+	"\fBuildRequest\x12\x12\n" +
+	"\x04repo\x18\x01 \x01(\tR\x04repo\x12\x10\n" +
+	"\x03ref\x18\x02 \x01(\tR\x03ref\x129\n" +
+	"\aoptions\x18\x03 \x01(\v2\x1f.gographs.graph.v1.BuildOptionsR\aoptions\"(\n" +
+	"\fBuildOptions\x12\x18\n" +
+	"\acluster\x18\x01 \x01(\bR\acluster\"\x86\x01\n" +
+	"\n" +
+	"BuildEvent\x129\n" +
+	"\bprogress\x18\x01 \x01(\v2\x1b.gographs.graph.v1.ProgressH\x00R\bprogress\x124\n" +
+	"\x05graph\x18\x02 \x01(\v2\x1c.gographs.graph.v1.RepoGraphH\x00R\x05graphB\a\n" +
+	"\x05event\"T\n" +
+	"\bProgress\x12.\n" +
+	"\x05stage\x18\x01 \x01(\x0e2\x18.gographs.graph.v1.StageR\x05stage\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\x93\x01\n" +
+	"\tRepoGraph\x12\x16\n" +
+	"\x06commit\x18\x01 \x01(\tR\x06commit\x12\x10\n" +
+	"\x03dot\x18\x02 \x01(\tR\x03dot\x12-\n" +
+	"\x05nodes\x18\x03 \x03(\v2\x17.gographs.graph.v1.NodeR\x05nodes\x12-\n" +
+	"\x05edges\x18\x04 \x03(\v2\x17.gographs.graph.v1.EdgeR\x05edges\"\\\n" +
+	"\x04Node\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05label\x18\x02 \x01(\tR\x05label\x12\x12\n" +
+	"\x04href\x18\x03 \x01(\tR\x04href\x12\x1a\n" +
+	"\bclusters\x18\x04 \x03(\tR\bclusters\"_\n" +
+	"\x04Edge\x12\x12\n" +
+	"\x04from\x18\x01 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\x02 \x01(\tR\x02to\x123\n" +
+	"\aimports\x18\x03 \x03(\v2\x19.gographs.graph.v1.ImportR\aimports\"2\n" +
+	"\x06Import\x12\x12\n" +
+	"\x04file\x18\x01 \x01(\tR\x04file\x12\x14\n" +
+	"\x05alias\x18\x02 \x01(\tR\x05alias\"5\n" +
+	"\rCommitRequest\x12\x12\n" +
+	"\x04repo\x18\x01 \x01(\tR\x04repo\x12\x10\n" +
+	"\x03ref\x18\x02 \x01(\tR\x03ref\"(\n" +
+	"\x0eCommitResponse\x12\x16\n" +
+	"\x06commit\x18\x01 \x01(\tR\x06commit*k\n" +
+	"\x05Stage\x12\x15\n" +
+	"\x11STAGE_UNSPECIFIED\x10\x00\x12\x13\n" +
+	"\x0fSTAGE_RESOLVING\x10\x01\x12\x11\n" +
+	"\rSTAGE_CLONING\x10\x02\x12\x13\n" +
+	"\x0fSTAGE_ANALYZING\x10\x03\x12\x0e\n" +
+	"\n" +
+	"STAGE_DONE\x10\x042\xa1\x01\n" +
+	"\x05Graph\x12I\n" +
+	"\x05Build\x12\x1f.gographs.graph.v1.BuildRequest\x1a\x1d.gographs.graph.v1.BuildEvent0\x01\x12M\n" +
+	"\x06Commit\x12 .gographs.graph.v1.CommitRequest\x1a!.gographs.graph.v1.CommitResponseB-Z+github.com/siggy/gographs/pkg/graph/graphpbb\x06proto3"
+
+var (
+	file_graph_proto_rawDescOnce sync.Once
+	file_graph_proto_rawDescData []byte
+)
+
+func file_graph_proto_rawDescGZIP() []byte {
+	file_graph_proto_rawDescOnce.Do(func() {
+		file_graph_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_graph_proto_rawDesc), len(file_graph_proto_rawDesc)))
+	})
+	return file_graph_proto_rawDescData
+}
+
+var file_graph_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_graph_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_graph_proto_goTypes = []any{
+	(Stage)(0),             // 0: gographs.graph.v1.Stage
+	(*BuildRequest)(nil),   // 1: gographs.graph.v1.BuildRequest
+	(*BuildOptions)(nil),   // 2: gographs.graph.v1.BuildOptions
+	(*BuildEvent)(nil),     // 3: gographs.graph.v1.BuildEvent
+	(*Progress)(nil),       // 4: gographs.graph.v1.Progress
+	(*RepoGraph)(nil),      // 5: gographs.graph.v1.RepoGraph
+	(*Node)(nil),           // 6: gographs.graph.v1.Node
+	(*Edge)(nil),           // 7: gographs.graph.v1.Edge
+	(*Import)(nil),         // 8: gographs.graph.v1.Import
+	(*CommitRequest)(nil),  // 9: gographs.graph.v1.CommitRequest
+	(*CommitResponse)(nil), // 10: gographs.graph.v1.CommitResponse
+}
+var file_graph_proto_depIdxs = []int32{
+	2,  // 0: gographs.graph.v1.BuildRequest.options:type_name -> gographs.graph.v1.BuildOptions
+	4,  // 1: gographs.graph.v1.BuildEvent.progress:type_name -> gographs.graph.v1.Progress
+	5,  // 2: gographs.graph.v1.BuildEvent.graph:type_name -> gographs.graph.v1.RepoGraph
+	0,  // 3: gographs.graph.v1.Progress.stage:type_name -> gographs.graph.v1.Stage
+	6,  // 4: gographs.graph.v1.RepoGraph.nodes:type_name -> gographs.graph.v1.Node
+	7,  // 5: gographs.graph.v1.RepoGraph.edges:type_name -> gographs.graph.v1.Edge
+	8,  // 6: gographs.graph.v1.Edge.imports:type_name -> gographs.graph.v1.Import
+	1,  // 7: gographs.graph.v1.Graph.Build:input_type -> gographs.graph.v1.BuildRequest
+	9,  // 8: gographs.graph.v1.Graph.Commit:input_type -> gographs.graph.v1.CommitRequest
+	3,  // 9: gographs.graph.v1.Graph.Build:output_type -> gographs.graph.v1.BuildEvent
+	10, // 10: gographs.graph.v1.Graph.Commit:output_type -> gographs.graph.v1.CommitResponse
+	9,  // [9:11] is the sub-list for method output_type
+	7,  // [7:9] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_graph_proto_init() }
+func file_graph_proto_init() {
+	if File_graph_proto != nil {
+		return
+	}
+	file_graph_proto_msgTypes[2].OneofWrappers = []any{
+		(*BuildEvent_Progress)(nil),
+		(*BuildEvent_Graph)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_graph_proto_rawDesc), len(file_graph_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_graph_proto_goTypes,
+		DependencyIndexes: file_graph_proto_depIdxs,
+		EnumInfos:         file_graph_proto_enumTypes,
+		MessageInfos:      file_graph_proto_msgTypes,
+	}.Build()
+	File_graph_proto = out.File
+	file_graph_proto_goTypes = nil
+	file_graph_proto_depIdxs = nil
+}
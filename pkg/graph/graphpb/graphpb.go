@@ -0,0 +1,5 @@
+// Package graphpb holds the graph server's gRPC API, generated from
+// graph.proto.
+package graphpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative graph.proto
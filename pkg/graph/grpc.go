@@ -0,0 +1,283 @@
+package graph
+
+// This file serves the graph server's gRPC API, generated from
+// graphpb/graph.proto, alongside its HTTP one: the HTTP server hands requests
+// with a gRPC content type to a grpc.Server, and the client calls it with the
+// generated client.
+//
+// grpcurl -plaintext -proto pkg/graph/graphpb/graph.proto \
+//   -d '{"repo":"github.com/siggy/gographs","options":{"cluster":true}}' \
+//   [graph-addr] gographs.graph.v1.Graph/Build
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/dot"
+	"github.com/siggy/gographs/pkg/graph/graphpb"
+	"github.com/siggy/gographs/pkg/prom"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	grpcContentType = "application/grpc"
+
+	// maxGRPCMessage bounds messages received, as graphs of large repos are
+	// big, but not this big.
+	maxGRPCMessage = 64 << 20
+)
+
+// isGRPC reports whether a request is a gRPC call.
+func isGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), grpcContentType)
+}
+
+// grpcServer serves the gRPC API, building repos with buildRepo and resolving
+// commits with headCommit. If token is set, calls must send it in their
+// "authorization" metadata.
+type grpcServer struct {
+	graphpb.UnimplementedGraphServer
+
+	log        *log.Entry
+	links      Links
+	token      string
+	buildRepo  func(repo, ref string, cluster bool, links Links, progress progressFunc) (*build, error)
+	headCommit func(repo, ref string) (string, error)
+}
+
+// newGRPCServer returns a gRPC server for s.
+func newGRPCServer(s *grpcServer) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.MaxRecvMsgSize(maxGRPCMessage),
+		grpc.ChainUnaryInterceptor(s.unary),
+		grpc.ChainStreamInterceptor(s.stream),
+	)
+	graphpb.RegisterGraphServer(srv, s)
+	return srv
+}
+
+// unary authenticates a unary call, and records its outcome.
+func (s *grpcServer) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	err := s.authenticate(ctx)
+	if err != nil {
+		s.countError(info.FullMethod, err)
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	if err != nil {
+		s.countError(info.FullMethod, err)
+	}
+	return resp, err
+}
+
+// stream authenticates a streaming call, and records its outcome.
+func (s *grpcServer) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := s.authenticate(ss.Context())
+	if err == nil {
+		err = handler(srv, ss)
+	}
+	if err != nil {
+		s.countError(info.FullMethod, err)
+	}
+	return err
+}
+
+// authenticate checks a call's token, if the server requires one.
+func (s *grpcServer) authenticate(ctx context.Context) error {
+	if s.token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, got := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+s.token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "Unauthorized")
+}
+
+// countError logs a failed call and counts it in metrics, by gRPC code.
+func (s *grpcServer) countError(method string, err error) {
+	st := status.Convert(err)
+	log.Errorf("Failed gRPC request for [%s]: [%s] Message: [%s]", method, st.Code(), st.Message())
+	prom.CountGRPCError(graphServer, method, st.Code().String(), st.Message(), err)
+}
+
+// Build clones a repo and streams progress events, then its graph.
+func (s *grpcServer) Build(req *graphpb.BuildRequest, stream grpc.ServerStreamingServer[graphpb.BuildEvent]) error {
+	if req.GetRepo() == "" {
+		return status.Error(codes.InvalidArgument, "repo required")
+	}
+
+	s.log.Debugf("Building %s at %q", req.GetRepo(), req.GetRef())
+
+	var sendErr error
+	progress := func(stage graphpb.Stage, message string) {
+		if sendErr == nil {
+			sendErr = stream.Send(&graphpb.BuildEvent{Event: &graphpb.BuildEvent_Progress{
+				Progress: &graphpb.Progress{Stage: stage, Message: message},
+			}})
+		}
+	}
+	b, err := s.buildRepo(req.GetRepo(), req.GetRef(), req.GetOptions().GetCluster(), s.links, progress)
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "Failed to build %s: %s", req.GetRepo(), err)
+	}
+
+	progress(graphpb.Stage_STAGE_DONE, "Built "+req.GetRepo())
+	if sendErr != nil {
+		return sendErr
+	}
+	return stream.Send(&graphpb.BuildEvent{Event: &graphpb.BuildEvent_Graph{Graph: toGraphpb(b)}})
+}
+
+// Commit returns the commit a ref points to, without cloning.
+func (s *grpcServer) Commit(_ context.Context, req *graphpb.CommitRequest) (*graphpb.CommitResponse, error) {
+	if req.GetRepo() == "" {
+		return nil, status.Error(codes.InvalidArgument, "repo required")
+	}
+
+	s.log.Debugf("Resolving commit for %s at %q", req.GetRepo(), req.GetRef())
+
+	commit, err := s.headCommit(req.GetRepo(), req.GetRef())
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "Failed to resolve commit for %s: %s", req.GetRepo(), err)
+	}
+	return &graphpb.CommitResponse{Commit: commit}, nil
+}
+
+// toGraphpb converts a build to its gRPC message, with nodes and edges if
+// its DOT graph parsed.
+func toGraphpb(b *build) *graphpb.RepoGraph {
+	out := &graphpb.RepoGraph{Commit: b.commit, Dot: b.dot}
+	g := b.graph
+	if g == nil {
+		return out
+	}
+
+	clusters := g.Clusters()
+	for _, n := range g.Nodes {
+		node := &graphpb.Node{
+			Id:    n.ID,
+			Label: strings.Join(g.NodeLabel(n), " "),
+			Href:  g.NodeAttr(n, "href", g.NodeAttr(n, "URL", "")),
+		}
+		for _, s := range clusters[n.ID] {
+			node.Clusters = append(node.Clusters, strings.Join(dot.LabelLines(s.Attrs.Get("label", s.ID), s.ID, g.ID), " "))
+		}
+		out.Nodes = append(out.Nodes, node)
+	}
+	for _, e := range g.Edges {
+		edge := &graphpb.Edge{From: e.From, To: e.To}
+		for _, imp := range e.Imports() {
+			edge.Imports = append(edge.Imports, &graphpb.Import{File: imp.File, Alias: imp.Alias})
+		}
+		out.Edges = append(out.Edges, edge)
+	}
+	return out
+}
+
+// dialGRPC returns a connection to the graph server at base, dialing addr
+// instead of base's host if set, so TLS still verifies the server by host
+// name. Connections are made lazily, on the first call.
+func (c *Client) dialGRPC(base, addr string) (*grpc.ClientConn, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	target := net.JoinHostPort(u.Hostname(), port(u))
+	if addr != "" {
+		target = addr
+	}
+
+	creds := insecure.NewCredentials()
+	if u.Scheme == "https" {
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if c.transport.TLSClientConfig != nil {
+			cfg = c.transport.TLSClientConfig.Clone()
+		}
+		cfg.ServerName = u.Hostname()
+		creds = credentials.NewTLS(cfg)
+	}
+
+	return grpc.NewClient("passthrough:///"+target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithAuthority(u.Host),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxGRPCMessage)),
+	)
+}
+
+// sendGRPC makes one gRPC call to one graph server, returning what its HTTP
+// API would: the DOT graph of a Build, or the commit of a Commit. Build
+// progress is logged as it streams in.
+func (c *Client) sendGRPC(ctx context.Context, b *backend, endpoint string, p Post) (string, error) {
+	if b.graph == nil {
+		return "", status.Error(codes.Unavailable, "not connected to "+b.name)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	if c.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+	}
+
+	if endpoint == "/commit" {
+		resp, err := b.graph.Commit(ctx, &graphpb.CommitRequest{Repo: p.Repo, Ref: p.Ref})
+		if err != nil {
+			return "", err
+		}
+		return resp.GetCommit(), nil
+	}
+
+	stream, err := b.graph.Build(ctx, &graphpb.BuildRequest{
+		Repo:    p.Repo,
+		Ref:     p.Ref,
+		Options: &graphpb.BuildOptions{Cluster: p.Cluster},
+	})
+	if err != nil {
+		return "", err
+	}
+	for {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return "", status.Error(codes.Internal, "response ended without a graph")
+		}
+		if err != nil {
+			return "", err
+		}
+		switch e := event.GetEvent().(type) {
+		case *graphpb.BuildEvent_Progress:
+			c.log.Debugf("Build progress from %s: %s: %s", b.url, e.Progress.GetStage(), e.Progress.GetMessage())
+		case *graphpb.BuildEvent_Graph:
+			c.log.Debugf("gRPC response from %s (%d bytes)", b.url, len(e.Graph.GetDot()))
+			return e.Graph.GetDot(), nil
+		}
+	}
+}
+
+// grpcUnavailable reports whether a gRPC code means the graph server could not
+// serve the call, rather than that the call failed.
+func grpcUnavailable(code codes.Code) bool {
+	return code == codes.Unavailable || code == codes.DeadlineExceeded
+}
+
+// grpcLabel labels a failed gRPC call in metrics by its code, e.g.
+// "grpc NotFound".
+func grpcLabel(err error) string {
+	return "grpc " + status.Code(err).String()
+}
@@ -0,0 +1,297 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/siggy/gographs/pkg/dot"
+	"github.com/siggy/gographs/pkg/graph/graphpb"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const testDot = `digraph G {
+	subgraph cluster_pkg {
+		label="pkg";
+		a [label="a", href="https://pkg.go.dev/a"];
+	}
+	b;
+	a -> b [imports="a.go"];
+}`
+
+// startGRPC serves s over cleartext HTTP/2 through the graph server's router,
+// as Start does.
+func startGRPC(t *testing.T, s *grpcServer) *httptest.Server {
+	t.Helper()
+	if s.log == nil {
+		s.log = log.WithField(graphServer, "test")
+	}
+
+	srv := httptest.NewUnstartedServer(newRouter(s.log, nil, s))
+	srv.Config.Protocols = &http.Protocols{}
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// dial returns a generated client to srv, sending token as metadata if set.
+func dial(t *testing.T, srv *httptest.Server, token string) (*grpc.ClientConn, context.Context) {
+	t.Helper()
+	conn, err := grpc.NewClient("passthrough:///"+srv.Listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	return conn, ctx
+}
+
+func TestGRPCBuild(t *testing.T) {
+	g, err := dot.Parse(testDot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type request struct {
+		repo, ref string
+		cluster   bool
+	}
+	requests := make(chan request, 1)
+	proceed := make(chan struct{})
+	srv := startGRPC(t, &grpcServer{
+		buildRepo: func(repo, ref string, cluster bool, _ Links, progress progressFunc) (*build, error) {
+			requests <- request{repo, ref, cluster}
+			progress(graphpb.Stage_STAGE_RESOLVING, "Resolving "+repo)
+			// the first event must reach the client while the build runs
+			select {
+			case <-proceed:
+			case <-time.After(10 * time.Second):
+				return nil, errors.New("progress was not streamed")
+			}
+			progress(graphpb.Stage_STAGE_CLONING, "Cloning "+repo)
+			return &build{commit: "abc123", dot: testDot, graph: g}, nil
+		},
+	})
+	conn, ctx := dial(t, srv, "")
+
+	stream, err := graphpb.NewGraphClient(conn).Build(ctx, &graphpb.BuildRequest{
+		Repo:    "github.com/siggy/gographs",
+		Ref:     "main",
+		Options: &graphpb.BuildOptions{Cluster: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []*graphpb.BuildEvent
+	for {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) == 0 {
+			close(proceed)
+		}
+		events = append(events, event)
+	}
+
+	if got, want := <-requests, (request{"github.com/siggy/gographs", "main", true}); got != want {
+		t.Errorf("built %+v, want %+v", got, want)
+	}
+	progress := func(stage graphpb.Stage, message string) *graphpb.BuildEvent {
+		return &graphpb.BuildEvent{Event: &graphpb.BuildEvent_Progress{
+			Progress: &graphpb.Progress{Stage: stage, Message: message},
+		}}
+	}
+	want := []*graphpb.BuildEvent{
+		progress(graphpb.Stage_STAGE_RESOLVING, "Resolving github.com/siggy/gographs"),
+		progress(graphpb.Stage_STAGE_CLONING, "Cloning github.com/siggy/gographs"),
+		progress(graphpb.Stage_STAGE_DONE, "Built github.com/siggy/gographs"),
+		{Event: &graphpb.BuildEvent_Graph{Graph: &graphpb.RepoGraph{
+			Commit: "abc123",
+			Dot:    testDot,
+			Nodes: []*graphpb.Node{
+				{Id: "a", Label: "a", Href: "https://pkg.go.dev/a", Clusters: []string{"pkg"}},
+				{Id: "b", Label: "b"},
+			},
+			Edges: []*graphpb.Edge{
+				{From: "a", To: "b", Imports: []*graphpb.Import{{File: "a.go"}}},
+			},
+		}}},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %v", len(events), len(want), events)
+	}
+	for i := range want {
+		if !proto.Equal(events[i], want[i]) {
+			t.Errorf("event %d:\n%v\nwant:\n%v", i, events[i], want[i])
+		}
+	}
+}
+
+func TestGRPCErrors(t *testing.T) {
+	failing := &grpcServer{
+		token: "secret",
+		buildRepo: func(string, string, bool, Links, progressFunc) (*build, error) {
+			return nil, errors.New("goda: 100% broken/ünïcode")
+		},
+		headCommit: func(string, string) (string, error) {
+			return "", errors.New("no such ref")
+		},
+	}
+	srv := startGRPC(t, failing)
+
+	build := func(ctx context.Context, conn *grpc.ClientConn, repo string) error {
+		stream, err := graphpb.NewGraphClient(conn).Build(ctx, &graphpb.BuildRequest{Repo: repo})
+		if err != nil {
+			return err
+		}
+		for {
+			if _, err := stream.Recv(); err != nil {
+				return err
+			}
+		}
+	}
+	commit := func(ctx context.Context, conn *grpc.ClientConn, repo string) error {
+		_, err := graphpb.NewGraphClient(conn).Commit(ctx, &graphpb.CommitRequest{Repo: repo})
+		return err
+	}
+	unknown := func(ctx context.Context, conn *grpc.ClientConn, repo string) error {
+		return conn.Invoke(ctx, "/gographs.graph.v1.Graph/Delete", &graphpb.CommitRequest{Repo: repo}, &graphpb.CommitResponse{})
+	}
+
+	testCases := []struct {
+		name    string
+		token   string
+		call    func(context.Context, *grpc.ClientConn, string) error
+		repo    string
+		code    codes.Code
+		message string
+	}{
+		{"empty build repo", "secret", build, "", codes.InvalidArgument, "repo required"},
+		{"empty commit repo", "secret", commit, "", codes.InvalidArgument, "repo required"},
+		{"build failure", "secret", build, "r", codes.Internal, "Failed to build r: goda: 100% broken/ünïcode"},
+		{"commit failure", "secret", commit, "r", codes.NotFound, "Failed to resolve commit for r: no such ref"},
+		{"unknown method", "secret", unknown, "r", codes.Unimplemented, "unknown method Delete for service gographs.graph.v1.Graph"},
+		{"missing token", "", commit, "r", codes.Unauthenticated, "Unauthorized"},
+		{"wrong token", "wrong", build, "r", codes.Unauthenticated, "Unauthorized"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, ctx := dial(t, srv, tc.token)
+			err := tc.call(ctx, conn, tc.repo)
+			s := status.Convert(err)
+			if s.Code() != tc.code || s.Message() != tc.message {
+				t.Errorf("status %s %q, want %s %q", s.Code(), s.Message(), tc.code, tc.message)
+			}
+		})
+	}
+
+	// the HTTP API still requires the token as a header
+	resp, err := http.Post(srv.URL+"/commit", "application/json", strings.NewReader(`{"repo":"r"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("POST /commit without a token = %d, want 401", resp.StatusCode)
+	}
+}
+
+// TestGRPCClient checks the client against the server, end to end.
+func TestGRPCClient(t *testing.T) {
+	g, err := dot.Parse(testDot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type request struct{ repo, ref string }
+	builds := make(chan request, 10)
+	commits := make(chan request, 10)
+	srv := startGRPC(t, &grpcServer{
+		token: "secret",
+		buildRepo: func(repo, ref string, cluster bool, _ Links, progress progressFunc) (*build, error) {
+			builds <- request{repo, ref}
+			if repo == "github.com/broken/repo" {
+				return nil, errors.New("no go.mod")
+			}
+			progress(graphpb.Stage_STAGE_CLONING, "Cloning "+repo)
+			if !cluster {
+				return nil, errors.New("cluster not sent")
+			}
+			return &build{commit: "abc123", dot: testDot, graph: g}, nil
+		},
+		headCommit: func(repo, ref string) (string, error) {
+			commits <- request{repo, ref}
+			return "abc123", nil
+		},
+	})
+
+	c, err := NewClient(ClientConfig{
+		URLs:     []string{srv.URL},
+		Security: Security{Token: "secret"},
+		GRPC:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.GetRef("github.com/siggy/gographs", "v1.0.0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != testDot {
+		t.Errorf("Get = %q, want %q", got, testDot)
+	}
+	if r := <-builds; r != (request{"github.com/siggy/gographs", "v1.0.0"}) {
+		t.Errorf("built %+v, want ref v1.0.0", r)
+	}
+
+	commit, err := c.Commit("github.com/siggy/gographs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit != "abc123" {
+		t.Errorf("Commit = %q, want abc123", commit)
+	}
+	if r := <-commits; r != (request{"github.com/siggy/gographs", ""}) {
+		t.Errorf("resolved %+v, want the default branch", r)
+	}
+
+	_, err = c.Get("github.com/broken/repo", true)
+	s := status.Convert(err)
+	if s.Code() != codes.Internal || s.Message() != "Failed to build github.com/broken/repo: no go.mod" {
+		t.Errorf("Get error %v, want an Internal status", err)
+	}
+	var m dto.Metric
+	if err := httpErrors.WithLabelValues("github.com/broken/repo", "true", "grpc Internal").Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.GetCounter().GetValue(); n != 1 {
+		t.Errorf("%v errors labeled grpc Internal, want 1", n)
+	}
+	if retryable(err) {
+		t.Error("build failures are retryable")
+	}
+}
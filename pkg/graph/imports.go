@@ -0,0 +1,83 @@
+package graph
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/dot"
+	log "github.com/sirupsen/logrus"
+)
+
+// annotateImports records on each edge the files in its tail that import its
+// head, and summarizes them in the edge's tooltip.
+func annotateImports(g *dot.Graph, co *checkout) {
+	byDir := map[string]map[string][]dot.Import{}
+	for _, e := range g.Edges {
+		dir, ok := co.dir(e.From)
+		if !ok {
+			continue
+		}
+		imports, ok := byDir[dir]
+		if !ok {
+			imports = packageImports(co.path, dir)
+			byDir[dir] = imports
+		}
+
+		files := imports[e.To]
+		if len(files) == 0 {
+			continue
+		}
+		e.SetImports(files)
+
+		lines := []string{e.From + " imports " + e.To + " in:"}
+		for _, f := range files {
+			lines = append(lines, f.String())
+		}
+		e.Attrs["tooltip"] = strings.Join(lines, `\n`)
+	}
+}
+
+// packageImports parses the imports of the non-test Go files in a package
+// directory, keyed by imported package path. Files that fail to parse are
+// skipped.
+func packageImports(root, dir string) map[string][]dot.Import {
+	imports := map[string][]dot.Import{}
+
+	entries, err := os.ReadDir(filepath.Join(root, filepath.FromSlash(dir)))
+	if err != nil {
+		log.Debugf("failed to read package dir %s: %s", dir, err)
+		return imports
+	}
+
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		file := path.Join(dir, name)
+		f, err := parser.ParseFile(fset, filepath.Join(root, filepath.FromSlash(file)), nil, parser.ImportsOnly)
+		if err != nil {
+			log.Debugf("failed to parse imports of %s: %s", file, err)
+			continue
+		}
+		for _, spec := range f.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			imp := dot.Import{File: file}
+			if spec.Name != nil {
+				imp.Alias = spec.Name.Name
+			}
+			imports[importPath] = append(imports[importPath], imp)
+		}
+	}
+	return imports
+}
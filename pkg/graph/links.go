@@ -0,0 +1,195 @@
+package graph
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/dot"
+	log "github.com/sirupsen/logrus"
+)
+
+// LinkTemplate holds the URL templates for one source host. Templates may use
+// these placeholders:
+//
+//	{url}    the repo's clone URL, e.g. https://github.com/siggy/gographs
+//	{commit} the commit the graph was built from
+//	{pkg}    the package's import path
+//	{dir}    the package's directory, relative to the repo root
+//	{import} the imported package's import path, in Import templates only
+type LinkTemplate struct {
+	// Package links each package in the repo. Empty links to pkg.go.dev, so set
+	// it for hosts with private or unpublished code.
+	Package string `json:"package,omitempty"`
+	// Import links each edge from a package in the repo to the files that
+	// import the edge's target.
+	Import string `json:"import,omitempty"`
+}
+
+// Links maps source hosts, e.g. "github.com", to their URL templates.
+type Links map[string]LinkTemplate
+
+// pkgGoDev hosts documentation for published packages.
+const pkgGoDev = "https://pkg.go.dev/"
+
+// DefaultLinks covers the public hosts that resolveGitURL knows about.
+// Packages on these hosts are published, so they link to pkg.go.dev.
+var DefaultLinks = Links{
+	"github.com":    {Import: "{url}/tree/{commit}/{dir}"},
+	"gitlab.com":    {Import: "{url}/-/tree/{commit}/{dir}"},
+	"bitbucket.org": {Import: "{url}/src/{commit}/{dir}"},
+}
+
+// LoadLinks reads link templates from a JSON file, keyed by host, on top of
+// DefaultLinks. An empty path returns DefaultLinks.
+//
+//	{"git.example.com": {"package": "{url}/src/commit/{commit}/{dir}"}}
+func LoadLinks(file string) (Links, error) {
+	links := Links{}
+	for host, t := range DefaultLinks {
+		links[host] = t
+	}
+	if file == "" {
+		return links, nil
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var custom Links
+	if err := json.Unmarshal(b, &custom); err != nil {
+		return nil, fmt.Errorf("invalid link templates %s: %w", file, err)
+	}
+	for host, t := range custom {
+		links[host] = t
+	}
+	return links, nil
+}
+
+// apply sets hrefs on the nodes and edges of a checkout's graph.
+func (l Links) apply(g *dot.Graph, co *checkout) {
+	u, err := url.Parse(co.url)
+	if err != nil {
+		log.Warnf("failed to parse clone url for links: %s", err)
+		return
+	}
+	t := l[u.Hostname()]
+	vars := func(pkg string) []string {
+		dir, _ := co.dir(pkg)
+		return []string{
+			"{url}", strings.TrimSuffix(co.url, ".git"),
+			"{commit}", co.commit,
+			"{pkg}", pkg,
+			"{dir}", dir,
+		}
+	}
+
+	for _, n := range g.Nodes {
+		if _, ok := co.dir(n.ID); !ok || t.Package == "" {
+			n.Attrs["href"] = pkgGoDev + n.ID
+			continue
+		}
+		n.Attrs["href"] = strings.NewReplacer(vars(n.ID)...).Replace(t.Package)
+	}
+
+	if t.Import != "" {
+		for _, e := range g.Edges {
+			if _, ok := co.dir(e.From); !ok {
+				continue
+			}
+			r := strings.NewReplacer(append(vars(e.From), "{import}", e.To)...)
+			e.Attrs["href"] = r.Replace(t.Import)
+		}
+	}
+}
+
+// checkout is a repo cloned at a commit.
+type checkout struct {
+	path   string
+	url    string
+	commit string
+
+	// modules lists the repo's modules, longest module path first.
+	modules []module
+}
+
+type module struct {
+	path string
+	dir  string
+}
+
+// dir returns a package's directory relative to the repo root, and whether
+// the package belongs to the repo.
+func (co *checkout) dir(pkg string) (string, bool) {
+	for _, m := range co.modules {
+		if pkg == m.path || strings.HasPrefix(pkg, m.path+"/") {
+			return strings.TrimPrefix(path.Join(m.dir, strings.TrimPrefix(pkg, m.path)), "/"), true
+		}
+	}
+	return "", false
+}
+
+// findModules reads the module path from every go.mod in the checkout.
+func (co *checkout) findModules() error {
+	co.modules = nil
+	err := filepath.WalkDir(co.path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" || d.Name() == "vendor" || d.Name() == "testdata" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "go.mod" {
+			return nil
+		}
+
+		modPath, err := modulePath(p)
+		if err != nil || modPath == "" {
+			return err
+		}
+		rel, err := filepath.Rel(co.path, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		dir := filepath.ToSlash(rel)
+		if dir == "." {
+			dir = ""
+		}
+		co.modules = append(co.modules, module{modPath, dir})
+		return nil
+	})
+	sort.Slice(co.modules, func(i, j int) bool {
+		return len(co.modules[i].path) > len(co.modules[j].path)
+	})
+	return err
+}
+
+// modulePath returns the path from a go.mod file's module directive.
+func modulePath(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if rest, ok := strings.CutPrefix(line, "module"); ok && rest != strings.TrimLeft(rest, " \t") {
+			rest, _, _ = strings.Cut(rest, "//")
+			return strings.Trim(strings.TrimSpace(rest), `"`), nil
+		}
+	}
+	return "", scanner.Err()
+}
@@ -12,6 +12,7 @@ const (
 	graphclientSubsystem = "graphclient"
 	repoLabel            = "repo"
 	clusterLabel         = "cluster"
+	backendLabel         = "backend"
 )
 
 var (
@@ -36,4 +37,39 @@ var (
 		Help:      "Duration of HTTP requests.",
 		Buckets:   prometheus.ExponentialBuckets(0.001, 1.3, 50),
 	}, []string{repoLabel, clusterLabel})
+
+	retries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: gographsNamespace,
+		Subsystem: graphclientSubsystem,
+		Name:      "retries_total",
+		Help:      "Count of requests retried after a transient failure.",
+	}, []string{repoLabel, clusterLabel})
+
+	hedges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: gographsNamespace,
+		Subsystem: graphclientSubsystem,
+		Name:      "hedges_total",
+		Help:      "Count of hedged requests, sent to another graph server while one was slow.",
+	}, []string{repoLabel, clusterLabel})
+
+	breakerStates = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: gographsNamespace,
+		Subsystem: graphclientSubsystem,
+		Name:      "breaker_state",
+		Help:      "State of each graph server's circuit breaker: 0 closed, 1 half-open, 2 open.",
+	}, []string{backendLabel})
+
+	breakerRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: gographsNamespace,
+		Subsystem: graphclientSubsystem,
+		Name:      "breaker_rejections_total",
+		Help:      "Count of requests not sent to a graph server because its circuit breaker was open.",
+	}, []string{backendLabel})
+
+	backendHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: gographsNamespace,
+		Subsystem: graphclientSubsystem,
+		Name:      "backend_healthy",
+		Help:      "Whether each graph server passes health checks: 1 healthy, 0 ejected.",
+	}, []string{backendLabel})
 )
@@ -0,0 +1,137 @@
+package graph
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Security authenticates graph clients and the graph server to each other,
+// with mutual TLS, a shared bearer token, or both. The zero value is plain,
+// unauthenticated HTTP, suitable only for a server on localhost.
+type Security struct {
+	// CertFile and KeyFile are this side's TLS certificate and key: the
+	// server's, or the client's, for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// CAFile is a PEM bundle of CAs to verify the other side with. A server
+	// given one requires client certificates signed by it.
+	CAFile string
+	// Token is a shared secret. Clients send it as a bearer token, and the
+	// server rejects requests without it.
+	Token string
+}
+
+// LoadToken reads a shared token from a file, ignoring surrounding
+// whitespace. An empty file name returns no token.
+func LoadToken(file string) (string, error) {
+	if file == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", file)
+	}
+	return token, nil
+}
+
+// tls reports whether s configures TLS.
+func (s Security) tls() bool {
+	return s.CertFile != "" || s.CAFile != ""
+}
+
+// serverTLS returns the graph server's TLS config, or nil for plain HTTP.
+func (s Security) serverTLS() (*tls.Config, error) {
+	if !s.tls() {
+		return nil, nil
+	}
+	if s.CertFile == "" || s.KeyFile == "" {
+		return nil, errors.New("TLS requires both a certificate and a key")
+	}
+	cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if s.CAFile != "" {
+		cfg.ClientCAs, err = loadCAs(s.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// clientTLS returns a graph client's TLS config, or nil for the system
+// defaults.
+func (s Security) clientTLS() (*tls.Config, error) {
+	if !s.tls() {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.CertFile != "" || s.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if s.CAFile != "" {
+		var err error
+		cfg.RootCAs, err = loadCAs(s.CAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+func loadCAs(file string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", file)
+	}
+	return pool, nil
+}
+
+// tokenMiddleware rejects requests without the shared bearer token. gRPC calls
+// pass through, for the gRPC server to check the token in their metadata.
+func tokenMiddleware(token string) mux.MiddlewareFunc {
+	want := []byte("Bearer " + token)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if isGRPC(r) {
+				next.ServeHTTP(rw, r)
+				return
+			}
+			got := []byte(r.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare(got, want) != 1 {
+				rw.Header().Set("WWW-Authenticate", `Bearer realm="gographs-graph"`)
+				writeError(rw, r, http.StatusUnauthorized, "Unauthorized", nil)
+				return
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
@@ -56,11 +56,23 @@ func Middleware(server string) mux.MiddlewareFunc {
 
 // CountError increments http error counters.
 func CountError(server string, r *http.Request, status int, message string, err error) {
-	route := mux.CurrentRoute(r)
-	path, _ := route.GetPathTemplate()
+	path := ""
+	if route := mux.CurrentRoute(r); route != nil {
+		path, _ = route.GetPathTemplate()
+	}
 	errStr := ""
 	if err != nil {
 		errStr = err.Error()
 	}
 	httpErrors.WithLabelValues(server, r.Method, path, http.StatusText(status), message, errStr).Inc()
 }
+
+// CountGRPCError increments error counters for a gRPC call, labeled by its
+// full method and gRPC status code, e.g. "NotFound".
+func CountGRPCError(server, method, code, message string, err error) {
+	errStr := ""
+	if err != nil {
+		errStr = err.Error()
+	}
+	httpErrors.WithLabelValues(server, http.MethodPost, method, code, message, errStr).Inc()
+}
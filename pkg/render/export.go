@@ -0,0 +1,24 @@
+package render
+
+import (
+	"github.com/siggy/gographs/pkg/dot"
+	"github.com/siggy/gographs/pkg/export"
+)
+
+// exporters convert DOT to text formats. Conversion is cheap, so exports are
+// built from the cached DOT on each request rather than cached themselves.
+var exporters = map[Format]func(*dot.Graph) string{
+	Mermaid:  export.Mermaid,
+	PlantUML: export.PlantUML,
+	D2:       export.D2,
+	GraphML:  export.GraphML,
+	JSON:     export.JSON,
+}
+
+func exportDOT(src string, format Format) (string, error) {
+	g, err := dot.Parse(src)
+	if err != nil {
+		return "", err
+	}
+	return exporters[format](g), nil
+}
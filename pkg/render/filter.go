@@ -0,0 +1,152 @@
+package render
+
+import (
+	"path"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/dot"
+)
+
+// filtered reports whether any filter options are set.
+func (o Options) filtered() bool {
+	return len(o.Exclude) > 0 || len(o.Collapse) > 0 || o.MaxDepth > 0
+}
+
+// filterGraph applies the exclude, collapse and maxdepth options to a repo's
+// graph. Patterns match package paths relative to the repo, e.g. "pkg/web",
+// or full import paths for packages outside it.
+func filterGraph(g *dot.Graph, repo string, opts Options) {
+	root := strings.TrimSuffix(trimScheme(repo), "/")
+
+	rel := func(id string) (string, bool) {
+		if id == root {
+			return "", true
+		}
+		if r, ok := strings.CutPrefix(id, root+"/"); ok {
+			return r, true
+		}
+		return id, false
+	}
+	abs := func(r string) string {
+		if r == "" {
+			return root
+		}
+		return root + "/" + r
+	}
+
+	target := func(id string) string {
+		r, inRepo := rel(id)
+		for _, pattern := range opts.Exclude {
+			if matchGlob(pattern, r) {
+				return ""
+			}
+		}
+		for _, pattern := range opts.Collapse {
+			if prefix, ok := matchPrefix(pattern, r); ok {
+				if inRepo {
+					return abs(prefix)
+				}
+				return prefix
+			}
+		}
+		if inRepo && opts.MaxDepth > 0 {
+			if segments := strings.Split(r, "/"); r != "" && len(segments) > opts.MaxDepth {
+				return abs(strings.Join(segments[:opts.MaxDepth], "/"))
+			}
+		}
+		return id
+	}
+
+	targets := map[string]string{}
+	collapsed := map[string]bool{}
+	for _, n := range g.Nodes {
+		t := target(n.ID)
+		targets[n.ID] = t
+		if t != "" && t != n.ID {
+			collapsed[t] = true
+		}
+	}
+
+	g.MapNodes(func(id string) string { return targets[id] })
+
+	// label collapsed nodes as subtrees, e.g. "internal/..."
+	for t := range collapsed {
+		n := g.Node(t)
+		if n == nil {
+			continue
+		}
+		r, _ := rel(t)
+		label := r + "/..."
+		if r == "" {
+			label = path.Base(t) + "/..."
+		}
+		n.Attrs["label"] = label
+		n.Attrs["tooltip"] = t + "/..."
+		delete(n.Attrs, "href")
+		delete(n.Attrs, "URL")
+	}
+}
+
+// matchGlob reports whether a slash-separated path matches a glob pattern. A
+// "**" segment matches any number of segments, a trailing "/..." matches the
+// directory and everything below it, and other segments match as in
+// path.Match.
+func matchGlob(pattern, name string) bool {
+	if p, ok := strings.CutSuffix(pattern, "/..."); ok {
+		pattern = p + "/**"
+	}
+	return matchSegments(strings.Split(pattern, "/"), splitPath(name))
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
+
+// matchPrefix reports whether a path is, or is inside, a directory matching a
+// collapse pattern such as "internal/..." or "cmd/*", and returns the
+// directory.
+func matchPrefix(pattern, name string) (string, bool) {
+	prefix := splitPath(strings.TrimSuffix(pattern, "/..."))
+	segments := splitPath(name)
+	if len(segments) < len(prefix) {
+		return "", false
+	}
+	for i, p := range prefix {
+		if ok, _ := path.Match(p, segments[i]); !ok {
+			return "", false
+		}
+	}
+	return strings.Join(segments[:len(prefix)], "/"), true
+}
+
+func splitPath(name string) []string {
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// trimScheme strips a leading scheme (e.g. "https://") from a repo path.
+func trimScheme(repo string) string {
+	if _, after, ok := strings.Cut(repo, "://"); ok {
+		return after
+	}
+	return repo
+}
@@ -0,0 +1,320 @@
+package render
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/siggy/gographs/pkg/dot"
+)
+
+// filterDot is a small repo, r, importing an external module.
+const filterDot = `digraph G {
+	"r";
+	"r/cmd/app";
+	"r/internal/db" [href="https://pkg.go.dev/r/internal/db"];
+	"r/internal/db/sql";
+	"r/internal/cache";
+	"r/pkg/api";
+	"r/pkg/api/mocks";
+	"github.com/x/y";
+	"github.com/x/y/z";
+
+	"r/cmd/app" -> "r/internal/db" [imports="cmd/app/main.go"];
+	"r/cmd/app" -> "r/internal/cache" [imports="cmd/app/main.go;cmd/app/cache.go"];
+	"r/cmd/app" -> "r/pkg/api" [imports="cmd/app/server.go"];
+	"r/internal/db" -> "r/internal/db/sql" [imports="internal/db/db.go"];
+	"r/internal/cache" -> "r/internal/db/sql" [imports="internal/cache/cache.go"];
+	"r/pkg/api" -> "r/pkg/api/mocks" [imports="pkg/api/api_test.go"];
+	"r/pkg/api/mocks" -> "github.com/x/y/z" [imports="pkg/api/mocks/mocks.go"];
+	"r/pkg/api" -> "github.com/x/y" [imports="pkg/api/api.go"];
+	"r" -> "r/pkg/api" [imports="main.go"];
+}`
+
+// summarize lists a graph's nodes, with their labels and links, and edges,
+// with their imports.
+func summarize(g *dot.Graph) ([]string, []string) {
+	var nodes, edges []string
+	for _, n := range g.Nodes {
+		s := n.ID
+		if label, ok := n.Attrs["label"]; ok {
+			s += " [" + label + "]"
+		}
+		if _, ok := n.Attrs["href"]; ok {
+			s += " href"
+		}
+		nodes = append(nodes, s)
+	}
+	for _, e := range g.Edges {
+		edges = append(edges, e.From+" -> "+e.To+" "+e.Attrs[dot.ImportsAttr])
+	}
+	return nodes, edges
+}
+
+func TestFilterGraph(t *testing.T) {
+	testCases := []struct {
+		name  string
+		opts  Options
+		nodes []string
+		edges []string
+	}{
+		{
+			name: "none",
+			nodes: []string{
+				"r", "r/cmd/app", "r/internal/db href", "r/internal/db/sql", "r/internal/cache",
+				"r/pkg/api", "r/pkg/api/mocks", "github.com/x/y", "github.com/x/y/z",
+			},
+			edges: []string{
+				"r/cmd/app -> r/internal/db cmd/app/main.go",
+				"r/cmd/app -> r/internal/cache cmd/app/main.go;cmd/app/cache.go",
+				"r/cmd/app -> r/pkg/api cmd/app/server.go",
+				"r/internal/db -> r/internal/db/sql internal/db/db.go",
+				"r/internal/cache -> r/internal/db/sql internal/cache/cache.go",
+				"r/pkg/api -> r/pkg/api/mocks pkg/api/api_test.go",
+				"r/pkg/api/mocks -> github.com/x/y/z pkg/api/mocks/mocks.go",
+				"r/pkg/api -> github.com/x/y pkg/api/api.go",
+				"r -> r/pkg/api main.go",
+			},
+		},
+		{
+			name: "exclude glob",
+			opts: Options{Exclude: []string{"**/mocks/**"}},
+			nodes: []string{
+				"r", "r/cmd/app", "r/internal/db href", "r/internal/db/sql", "r/internal/cache",
+				"r/pkg/api", "github.com/x/y", "github.com/x/y/z",
+			},
+			edges: []string{
+				"r/cmd/app -> r/internal/db cmd/app/main.go",
+				"r/cmd/app -> r/internal/cache cmd/app/main.go;cmd/app/cache.go",
+				"r/cmd/app -> r/pkg/api cmd/app/server.go",
+				"r/internal/db -> r/internal/db/sql internal/db/db.go",
+				"r/internal/cache -> r/internal/db/sql internal/cache/cache.go",
+				"r/pkg/api -> github.com/x/y pkg/api/api.go",
+				"r -> r/pkg/api main.go",
+			},
+		},
+		{
+			name:  "exclude subtree",
+			opts:  Options{Exclude: []string{"internal/..."}},
+			nodes: []string{"r", "r/cmd/app", "r/pkg/api", "r/pkg/api/mocks", "github.com/x/y", "github.com/x/y/z"},
+			edges: []string{
+				"r/cmd/app -> r/pkg/api cmd/app/server.go",
+				"r/pkg/api -> r/pkg/api/mocks pkg/api/api_test.go",
+				"r/pkg/api/mocks -> github.com/x/y/z pkg/api/mocks/mocks.go",
+				"r/pkg/api -> github.com/x/y pkg/api/api.go",
+				"r -> r/pkg/api main.go",
+			},
+		},
+		{
+			name: "exclude external",
+			opts: Options{Exclude: []string{"github.com/x/**"}},
+			nodes: []string{
+				"r", "r/cmd/app", "r/internal/db href", "r/internal/db/sql", "r/internal/cache",
+				"r/pkg/api", "r/pkg/api/mocks",
+			},
+			edges: []string{
+				"r/cmd/app -> r/internal/db cmd/app/main.go",
+				"r/cmd/app -> r/internal/cache cmd/app/main.go;cmd/app/cache.go",
+				"r/cmd/app -> r/pkg/api cmd/app/server.go",
+				"r/internal/db -> r/internal/db/sql internal/db/db.go",
+				"r/internal/cache -> r/internal/db/sql internal/cache/cache.go",
+				"r/pkg/api -> r/pkg/api/mocks pkg/api/api_test.go",
+				"r -> r/pkg/api main.go",
+			},
+		},
+		{
+			name: "collapse",
+			opts: Options{Collapse: []string{"internal/..."}},
+			nodes: []string{
+				"r", "r/cmd/app", "r/internal [internal/...]",
+				"r/pkg/api", "r/pkg/api/mocks", "github.com/x/y", "github.com/x/y/z",
+			},
+			// edges into the subtree merge, and edges within it go
+			edges: []string{
+				"r/cmd/app -> r/internal cmd/app/main.go;cmd/app/cache.go",
+				"r/cmd/app -> r/pkg/api cmd/app/server.go",
+				"r/pkg/api -> r/pkg/api/mocks pkg/api/api_test.go",
+				"r/pkg/api/mocks -> github.com/x/y/z pkg/api/mocks/mocks.go",
+				"r/pkg/api -> github.com/x/y pkg/api/api.go",
+				"r -> r/pkg/api main.go",
+			},
+		},
+		{
+			name: "collapse into a directory without a package",
+			opts: Options{Collapse: []string{"cmd"}},
+			nodes: []string{
+				"r", "r/cmd [cmd/...]", "r/internal/db href", "r/internal/db/sql", "r/internal/cache",
+				"r/pkg/api", "r/pkg/api/mocks", "github.com/x/y", "github.com/x/y/z",
+			},
+			edges: []string{
+				"r/cmd -> r/internal/db cmd/app/main.go",
+				"r/cmd -> r/internal/cache cmd/app/main.go;cmd/app/cache.go",
+				"r/cmd -> r/pkg/api cmd/app/server.go",
+				"r/internal/db -> r/internal/db/sql internal/db/db.go",
+				"r/internal/cache -> r/internal/db/sql internal/cache/cache.go",
+				"r/pkg/api -> r/pkg/api/mocks pkg/api/api_test.go",
+				"r/pkg/api/mocks -> github.com/x/y/z pkg/api/mocks/mocks.go",
+				"r/pkg/api -> github.com/x/y pkg/api/api.go",
+				"r -> r/pkg/api main.go",
+			},
+		},
+		{
+			name: "collapse external",
+			opts: Options{Collapse: []string{"github.com/x/y/..."}},
+			nodes: []string{
+				"r", "r/cmd/app", "r/internal/db href", "r/internal/db/sql", "r/internal/cache",
+				"r/pkg/api", "r/pkg/api/mocks", "github.com/x/y [github.com/x/y/...]",
+			},
+			edges: []string{
+				"r/cmd/app -> r/internal/db cmd/app/main.go",
+				"r/cmd/app -> r/internal/cache cmd/app/main.go;cmd/app/cache.go",
+				"r/cmd/app -> r/pkg/api cmd/app/server.go",
+				"r/internal/db -> r/internal/db/sql internal/db/db.go",
+				"r/internal/cache -> r/internal/db/sql internal/cache/cache.go",
+				"r/pkg/api -> r/pkg/api/mocks pkg/api/api_test.go",
+				"r/pkg/api/mocks -> github.com/x/y pkg/api/mocks/mocks.go",
+				"r/pkg/api -> github.com/x/y pkg/api/api.go",
+				"r -> r/pkg/api main.go",
+			},
+		},
+		{
+			name: "maxdepth 1",
+			opts: Options{MaxDepth: 1},
+			nodes: []string{
+				"r", "r/cmd [cmd/...]", "r/internal [internal/...]", "r/pkg [pkg/...]",
+				"github.com/x/y", "github.com/x/y/z",
+			},
+			edges: []string{
+				"r/cmd -> r/internal cmd/app/main.go;cmd/app/cache.go",
+				"r/cmd -> r/pkg cmd/app/server.go",
+				"r/pkg -> github.com/x/y/z pkg/api/mocks/mocks.go",
+				"r/pkg -> github.com/x/y pkg/api/api.go",
+				"r -> r/pkg main.go",
+			},
+		},
+		{
+			name: "maxdepth 2",
+			opts: Options{MaxDepth: 2},
+			nodes: []string{
+				"r", "r/cmd/app", "r/internal/db [internal/db/...]", "r/internal/cache",
+				"r/pkg/api [pkg/api/...]", "github.com/x/y", "github.com/x/y/z",
+			},
+			edges: []string{
+				"r/cmd/app -> r/internal/db cmd/app/main.go",
+				"r/cmd/app -> r/internal/cache cmd/app/main.go;cmd/app/cache.go",
+				"r/cmd/app -> r/pkg/api cmd/app/server.go",
+				"r/internal/cache -> r/internal/db internal/cache/cache.go",
+				"r/pkg/api -> github.com/x/y/z pkg/api/mocks/mocks.go",
+				"r/pkg/api -> github.com/x/y pkg/api/api.go",
+				"r -> r/pkg/api main.go",
+			},
+		},
+		{
+			name: "maxdepth deeper than the repo",
+			opts: Options{MaxDepth: 3},
+			nodes: []string{
+				"r", "r/cmd/app", "r/internal/db href", "r/internal/db/sql", "r/internal/cache",
+				"r/pkg/api", "r/pkg/api/mocks", "github.com/x/y", "github.com/x/y/z",
+			},
+			edges: []string{
+				"r/cmd/app -> r/internal/db cmd/app/main.go",
+				"r/cmd/app -> r/internal/cache cmd/app/main.go;cmd/app/cache.go",
+				"r/cmd/app -> r/pkg/api cmd/app/server.go",
+				"r/internal/db -> r/internal/db/sql internal/db/db.go",
+				"r/internal/cache -> r/internal/db/sql internal/cache/cache.go",
+				"r/pkg/api -> r/pkg/api/mocks pkg/api/api_test.go",
+				"r/pkg/api/mocks -> github.com/x/y/z pkg/api/mocks/mocks.go",
+				"r/pkg/api -> github.com/x/y pkg/api/api.go",
+				"r -> r/pkg/api main.go",
+			},
+		},
+		{
+			name: "exclude before collapse",
+			opts: Options{Exclude: []string{"internal/db/sql"}, Collapse: []string{"internal/..."}},
+			nodes: []string{
+				"r", "r/cmd/app", "r/internal [internal/...]",
+				"r/pkg/api", "r/pkg/api/mocks", "github.com/x/y", "github.com/x/y/z",
+			},
+			edges: []string{
+				"r/cmd/app -> r/internal cmd/app/main.go;cmd/app/cache.go",
+				"r/cmd/app -> r/pkg/api cmd/app/server.go",
+				"r/pkg/api -> r/pkg/api/mocks pkg/api/api_test.go",
+				"r/pkg/api/mocks -> github.com/x/y/z pkg/api/mocks/mocks.go",
+				"r/pkg/api -> github.com/x/y pkg/api/api.go",
+				"r -> r/pkg/api main.go",
+			},
+		},
+		{
+			name: "collapse before maxdepth",
+			opts: Options{Collapse: []string{"pkg/api/..."}, MaxDepth: 1},
+			nodes: []string{
+				"r", "r/cmd [cmd/...]", "r/internal [internal/...]", "r/pkg/api [pkg/api/...]",
+				"github.com/x/y", "github.com/x/y/z",
+			},
+			edges: []string{
+				"r/cmd -> r/internal cmd/app/main.go;cmd/app/cache.go",
+				"r/cmd -> r/pkg/api cmd/app/server.go",
+				"r/pkg/api -> github.com/x/y/z pkg/api/mocks/mocks.go",
+				"r/pkg/api -> github.com/x/y pkg/api/api.go",
+				"r -> r/pkg/api main.go",
+			},
+		},
+		{
+			name: "exclude, collapse and maxdepth",
+			opts: Options{Exclude: []string{"**/mocks/**"}, Collapse: []string{"internal/..."}, MaxDepth: 1},
+			nodes: []string{
+				"r", "r/cmd [cmd/...]", "r/internal [internal/...]", "r/pkg [pkg/...]",
+				"github.com/x/y", "github.com/x/y/z",
+			},
+			edges: []string{
+				"r/cmd -> r/internal cmd/app/main.go;cmd/app/cache.go",
+				"r/cmd -> r/pkg cmd/app/server.go",
+				"r/pkg -> github.com/x/y pkg/api/api.go",
+				"r -> r/pkg main.go",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := dot.Parse(filterDot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filterGraph(g, "https://r/", tc.opts)
+
+			nodes, edges := summarize(g)
+			if !slices.Equal(nodes, tc.nodes) {
+				t.Errorf("nodes:\n%q\nwant:\n%q", nodes, tc.nodes)
+			}
+			if !slices.Equal(edges, tc.edges) {
+				t.Errorf("edges:\n%q\nwant:\n%q", edges, tc.edges)
+			}
+		})
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	testCases := []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"internal", "internal", true},
+		{"internal", "internal/db", false},
+		{"internal/...", "internal", true},
+		{"internal/...", "internal/db/sql", true},
+		{"internal/...", "internalx", false},
+		{"*/mocks", "pkg/mocks", true},
+		{"*/mocks", "pkg/api/mocks", false},
+		{"**/mocks", "pkg/api/mocks", true},
+		{"**/mocks", "mocks", true},
+		{"**/mocks/**", "pkg/mocks/gen", true},
+		{"cmd/*", "cmd/app", true},
+		{"cmd/*", "cmd", false},
+		{"**", "", true},
+	}
+	for _, tc := range testCases {
+		if got := matchGlob(tc.pattern, tc.name); got != tc.match {
+			t.Errorf("matchGlob(%q, %q) = %t, want %t", tc.pattern, tc.name, got, tc.match)
+		}
+	}
+}
@@ -0,0 +1,731 @@
+package render
+
+// The layered renderer lays out DOT graphs in-process using the classic
+// Sugiyama approach, then writes SVG directly (see svg.go):
+//
+// 1. break cycles by reversing DFS back edges
+// 2. assign ranks by longest path
+// 3. split edges spanning several ranks with dummy vertices
+// 4. order each rank with barycenter sweeps, keeping clusters contiguous
+// 5. give each cluster its own band across the ranks, then assign coordinates
+//    within each band via isotonic regression
+//
+// It covers the subset of DOT emitted by goda: nodes, edges, nested cluster
+// subgraphs, colors, labels, links and rankdir. It only produces SVG.
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/dot"
+)
+
+const (
+	pointsPerInch   = 72.0
+	defaultFontSize = 14.0
+	defaultFontName = "Roboto,Arial,sans-serif"
+	defaultNodeSep  = 0.25 // inches
+	defaultRankSep  = 0.5  // inches
+	minNodeWidth    = 0.75 * pointsPerInch
+	minNodeHeight   = 0.5 * pointsPerInch
+	charWidth       = 0.6 // average glyph width, in ems
+	lineHeight      = 1.2 // in ems
+	labelPadding    = 8.0
+	clusterPadding  = 8.0
+	arrowSize       = 10.0
+	graphMargin     = 4.0
+	orderIterations = 24
+	placeIterations = 8
+)
+
+// layered implements Renderer without depending on Graphviz.
+type layered struct{}
+
+func (layered) Render(src string, opts Options) (string, error) {
+	if opts.Format != SVG {
+		return "", fmt.Errorf("layered renderer: %w: %s", ErrUnsupportedFormat, opts.Format)
+	}
+	if opts.Engine != "" {
+		return "", fmt.Errorf("layered renderer: %w: %s", ErrUnsupportedEngine, opts.Engine)
+	}
+
+	g, err := dot.Parse(src)
+	if err != nil {
+		return "", err
+	}
+	return newLayout(g).svg(), nil
+}
+
+type vertex struct {
+	node  *dot.Node // nil for dummy vertices
+	label []string
+
+	// w is the extent along a rank, h the extent across it. For LR and RL
+	// layouts these are the node's height and width respectively.
+	w, h float64
+
+	rank     int
+	order    int
+	pos      float64
+	clusters []*dot.Subgraph
+
+	in, out []int
+}
+
+type layoutEdge struct {
+	edge *dot.Edge
+	// path holds vertex indexes from tail to head in rank order.
+	path     []int
+	reversed bool
+}
+
+type layout struct {
+	g       *dot.Graph
+	rankdir string
+	nodeSep float64
+	rankSep float64
+
+	vertices []*vertex
+	edges    []*layoutEdge
+	ranks    [][]int
+	rankPos  []float64
+	rankSize []float64
+}
+
+func newLayout(g *dot.Graph) *layout {
+	l := &layout{
+		g:       g,
+		rankdir: strings.ToUpper(g.Attrs.Get("rankdir", "TB")),
+		nodeSep: inches(g.Attrs.Get("nodesep", ""), defaultNodeSep),
+		rankSep: inches(g.Attrs.Get("ranksep", ""), defaultRankSep),
+	}
+
+	index := map[string]int{}
+	clusters := g.Clusters()
+	for _, n := range g.Nodes {
+		if g.NodeAttr(n, "style", "") == "invis" {
+			continue
+		}
+		v := l.newVertex(n)
+		v.clusters = clusters[n.ID]
+		index[n.ID] = len(l.vertices)
+		l.vertices = append(l.vertices, v)
+	}
+
+	for _, e := range g.Edges {
+		from, ok1 := index[e.From]
+		to, ok2 := index[e.To]
+		if !ok1 || !ok2 || from == to || g.EdgeAttr(e, "style", "") == "invis" {
+			continue
+		}
+		l.edges = append(l.edges, &layoutEdge{edge: e, path: []int{from, to}})
+	}
+
+	l.breakCycles()
+	l.assignRanks()
+	l.insertDummies()
+	l.orderRanks()
+	l.assignPositions()
+	l.assignRankPositions()
+	return l
+}
+
+func (l *layout) newVertex(n *dot.Node) *vertex {
+	fontSize := number(l.g.NodeAttr(n, "fontsize", ""), defaultFontSize)
+	label := l.g.NodeLabel(n)
+
+	longest := 0
+	for _, line := range label {
+		if c := len([]rune(line)); c > longest {
+			longest = c
+		}
+	}
+	width := math.Max(float64(longest)*fontSize*charWidth+2*labelPadding, inches(l.g.NodeAttr(n, "width", ""), minNodeWidth/pointsPerInch))
+	height := math.Max(float64(len(label))*fontSize*lineHeight+labelPadding, inches(l.g.NodeAttr(n, "height", ""), minNodeHeight/pointsPerInch))
+
+	switch l.g.NodeAttr(n, "shape", "ellipse") {
+	case "ellipse", "oval":
+		width *= math.Sqrt2
+		height *= math.Sqrt2
+	case "circle":
+		width = math.Max(width, height) * math.Sqrt2
+		height = width
+	}
+
+	v := &vertex{node: n, label: label, w: width, h: height}
+	if l.horizontal() {
+		v.w, v.h = v.h, v.w
+	}
+	return v
+}
+
+// horizontal reports whether ranks run left to right (or right to left).
+func (l *layout) horizontal() bool {
+	return l.rankdir == "LR" || l.rankdir == "RL"
+}
+
+// breakCycles reverses DFS back edges so the remaining graph is acyclic.
+func (l *layout) breakCycles() {
+	out := make([][]*layoutEdge, len(l.vertices))
+	for _, e := range l.edges {
+		out[e.path[0]] = append(out[e.path[0]], e)
+	}
+
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := make([]int, len(l.vertices))
+	type frame struct {
+		v    int
+		next int
+	}
+	for root := range l.vertices {
+		if state[root] != unvisited {
+			continue
+		}
+		stack := []frame{{v: root}}
+		state[root] = active
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.next == len(out[top.v]) {
+				state[top.v] = done
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			e := out[top.v][top.next]
+			top.next++
+			switch state[e.path[1]] {
+			case unvisited:
+				state[e.path[1]] = active
+				stack = append(stack, frame{v: e.path[1]})
+			case active:
+				e.reversed = true
+			}
+		}
+	}
+
+	for _, e := range l.edges {
+		if e.reversed {
+			e.path[0], e.path[1] = e.path[1], e.path[0]
+		}
+	}
+}
+
+// assignRanks places every vertex one rank below its deepest predecessor, then
+// pulls sources down next to their nearest successor.
+func (l *layout) assignRanks() {
+	indegree := make([]int, len(l.vertices))
+	out := make([][]int, len(l.vertices))
+	for _, e := range l.edges {
+		out[e.path[0]] = append(out[e.path[0]], e.path[1])
+		indegree[e.path[1]]++
+	}
+
+	var topo []int
+	queue := []int{}
+	remaining := append([]int{}, indegree...)
+	for v := range l.vertices {
+		if indegree[v] == 0 {
+			queue = append(queue, v)
+		}
+	}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		topo = append(topo, v)
+		for _, w := range out[v] {
+			if r := l.vertices[v].rank + 1; r > l.vertices[w].rank {
+				l.vertices[w].rank = r
+			}
+			remaining[w]--
+			if remaining[w] == 0 {
+				queue = append(queue, w)
+			}
+		}
+	}
+
+	for i := len(topo) - 1; i >= 0; i-- {
+		v := topo[i]
+		if indegree[v] != 0 || len(out[v]) == 0 {
+			continue
+		}
+		lowest := math.MaxInt
+		for _, w := range out[v] {
+			if r := l.vertices[w].rank; r < lowest {
+				lowest = r
+			}
+		}
+		l.vertices[v].rank = lowest - 1
+	}
+}
+
+// insertDummies splits edges spanning more than one rank so every edge in the
+// layout connects adjacent ranks.
+func (l *layout) insertDummies() {
+	for _, e := range l.edges {
+		tail, head := e.path[0], e.path[1]
+		path := []int{tail}
+		prev := tail
+		for r := l.vertices[tail].rank + 1; r < l.vertices[head].rank; r++ {
+			d := &vertex{
+				rank:     r,
+				clusters: commonClusters(l.vertices[tail].clusters, l.vertices[head].clusters),
+			}
+			l.vertices = append(l.vertices, d)
+			idx := len(l.vertices) - 1
+			l.link(prev, idx)
+			prev = idx
+			path = append(path, idx)
+		}
+		l.link(prev, head)
+		e.path = append(path, head)
+	}
+
+	maxRank := 0
+	for _, v := range l.vertices {
+		if v.rank > maxRank {
+			maxRank = v.rank
+		}
+	}
+	l.ranks = make([][]int, maxRank+1)
+	for i, v := range l.vertices {
+		v.order = len(l.ranks[v.rank])
+		l.ranks[v.rank] = append(l.ranks[v.rank], i)
+	}
+}
+
+func (l *layout) link(from, to int) {
+	l.vertices[from].out = append(l.vertices[from].out, to)
+	l.vertices[to].in = append(l.vertices[to].in, from)
+}
+
+// orderRanks reduces edge crossings with alternating barycenter sweeps,
+// keeping the best ordering seen.
+func (l *layout) orderRanks() {
+	best := l.snapshot()
+	bestCrossings := l.crossings()
+
+	for i := 0; i < orderIterations && bestCrossings > 0; i++ {
+		keys := l.clusterKeys()
+		for r := 1; r < len(l.ranks); r++ {
+			l.sortRank(r, keys, func(v *vertex) []int { return v.in })
+		}
+		keys = l.clusterKeys()
+		for r := len(l.ranks) - 2; r >= 0; r-- {
+			l.sortRank(r, keys, func(v *vertex) []int { return v.out })
+		}
+		if c := l.crossings(); c < bestCrossings {
+			bestCrossings = c
+			best = l.snapshot()
+		}
+	}
+
+	l.ranks = best
+	for _, rank := range l.ranks {
+		for i, v := range rank {
+			l.vertices[v].order = i
+		}
+	}
+}
+
+func (l *layout) snapshot() [][]int {
+	ranks := make([][]int, len(l.ranks))
+	for i, r := range l.ranks {
+		ranks[i] = append([]int{}, r...)
+	}
+	return ranks
+}
+
+// clusterKeys returns the mean relative order of each cluster's members across
+// all ranks, so every rank orders clusters the same way.
+func (l *layout) clusterKeys() map[*dot.Subgraph]float64 {
+	sums := map[*dot.Subgraph]float64{}
+	counts := map[*dot.Subgraph]float64{}
+	for _, rank := range l.ranks {
+		for _, v := range rank {
+			vert := l.vertices[v]
+			rel := (float64(vert.order) + 0.5) / float64(len(rank))
+			for _, c := range vert.clusters {
+				sums[c] += rel
+				counts[c]++
+			}
+		}
+	}
+	keys := map[*dot.Subgraph]float64{}
+	for c, sum := range sums {
+		keys[c] = sum / counts[c]
+	}
+	return keys
+}
+
+// sortRank orders rank r by the mean order of each vertex's neighbors,
+// grouping vertices by cluster so clusters stay contiguous.
+func (l *layout) sortRank(r int, keys map[*dot.Subgraph]float64, neighbors func(*vertex) []int) {
+	bary := map[int]float64{}
+	for _, v := range l.ranks[r] {
+		vert := l.vertices[v]
+		ns := neighbors(vert)
+		if len(ns) == 0 {
+			bary[v] = float64(vert.order)
+			continue
+		}
+		sum := 0.0
+		for _, n := range ns {
+			sum += float64(l.vertices[n].order)
+		}
+		bary[v] = sum / float64(len(ns))
+	}
+
+	l.ranks[r] = l.groupByCluster(l.ranks[r], 0, bary, keys)
+	for i, v := range l.ranks[r] {
+		l.vertices[v].order = i
+	}
+}
+
+// groupByCluster sorts members that sit directly in the cluster at the given
+// depth by barycenter, followed by each nested cluster in key order. This
+// matches the band order used by assignPositions.
+func (l *layout) groupByCluster(members []int, depth int, bary map[int]float64, keys map[*dot.Subgraph]float64) []int {
+	var loose []int
+	var clusters []*dot.Subgraph
+	groups := map[*dot.Subgraph][]int{}
+	for _, v := range members {
+		vc := l.vertices[v].clusters
+		if len(vc) <= depth {
+			loose = append(loose, v)
+			continue
+		}
+		c := vc[depth]
+		if _, ok := groups[c]; !ok {
+			clusters = append(clusters, c)
+		}
+		groups[c] = append(groups[c], v)
+	}
+
+	sort.SliceStable(loose, func(i, j int) bool { return bary[loose[i]] < bary[loose[j]] })
+	sort.SliceStable(clusters, func(i, j int) bool { return keys[clusters[i]] < keys[clusters[j]] })
+
+	sorted := loose
+	for _, c := range clusters {
+		sorted = append(sorted, l.groupByCluster(groups[c], depth+1, bary, keys)...)
+	}
+	return sorted
+}
+
+// crossings counts edge crossings between all adjacent ranks, using a binary
+// indexed tree to count inversions.
+func (l *layout) crossings() int {
+	total := 0
+	for r := 0; r+1 < len(l.ranks); r++ {
+		type pair struct{ a, b int }
+		var pairs []pair
+		for _, v := range l.ranks[r] {
+			for _, w := range l.vertices[v].out {
+				pairs = append(pairs, pair{l.vertices[v].order, l.vertices[w].order})
+			}
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			if pairs[i].a != pairs[j].a {
+				return pairs[i].a < pairs[j].a
+			}
+			return pairs[i].b < pairs[j].b
+		})
+
+		size := len(l.ranks[r+1])
+		tree := make([]int, size+1)
+		seen := 0
+		for _, p := range pairs {
+			// count previously seen edges ending strictly after p.b
+			le := 0
+			for i := p.b + 1; i > 0; i -= i & -i {
+				le += tree[i]
+			}
+			total += seen - le
+			for i := p.b + 1; i <= size; i += i & -i {
+				tree[i]++
+			}
+			seen++
+		}
+	}
+	return total
+}
+
+// band is the strip along the ranks reserved for a cluster (or the whole graph
+// when cluster is nil). Vertices directly in the cluster are placed in its
+// loose region, followed by one nested band per child cluster. Bands never
+// overlap, so cluster boxes never cover another cluster's nodes.
+type band struct {
+	cluster  *dot.Subgraph
+	children []*band
+	// loose holds, per rank, the vertices directly in this band, in order.
+	loose      [][]int
+	looseStart float64
+	looseWidth float64
+	width      float64
+}
+
+func (l *layout) bands() *band {
+	root := &band{}
+	bands := map[*dot.Subgraph]*band{}
+	get := func(chain []*dot.Subgraph) *band {
+		parent := root
+		for _, c := range chain {
+			b, ok := bands[c]
+			if !ok {
+				b = &band{cluster: c}
+				bands[c] = b
+				parent.children = append(parent.children, b)
+			}
+			parent = b
+		}
+		return parent
+	}
+
+	for r, rank := range l.ranks {
+		for _, v := range rank {
+			b := get(l.vertices[v].clusters)
+			for len(b.loose) <= r {
+				b.loose = append(b.loose, nil)
+			}
+			b.loose[r] = append(b.loose[r], v)
+		}
+	}
+
+	keys := l.clusterKeys()
+	var sortChildren func(b *band)
+	sortChildren = func(b *band) {
+		sort.SliceStable(b.children, func(i, j int) bool {
+			return keys[b.children[i].cluster] < keys[b.children[j].cluster]
+		})
+		for _, c := range b.children {
+			sortChildren(c)
+		}
+	}
+	sortChildren(root)
+	return root
+}
+
+func (l *layout) measure(b *band) {
+	for _, rank := range b.loose {
+		width := 0.0
+		for i, v := range rank {
+			if i > 0 {
+				width += l.nodeSep
+			}
+			width += l.vertices[v].w
+		}
+		b.looseWidth = math.Max(b.looseWidth, width)
+	}
+
+	parts := 0
+	if b.looseWidth > 0 {
+		b.width = b.looseWidth
+		parts++
+	}
+	for _, c := range b.children {
+		l.measure(c)
+		b.width += c.width
+		parts++
+	}
+	if parts > 1 {
+		b.width += float64(parts-1) * l.nodeSep
+	}
+	b.width += l.border(b)
+}
+
+// border returns the space reserved inside a band for its cluster's border
+// and, when ranks run horizontally, its label.
+func (l *layout) border(b *band) float64 {
+	if b.cluster == nil {
+		return 0
+	}
+	border := 2 * clusterPadding
+	if l.horizontal() && b.cluster.Attrs.Get("label", "") != "" {
+		border += defaultFontSize * lineHeight
+	}
+	return border
+}
+
+func (l *layout) place(b *band, start float64) {
+	x := start + l.border(b)
+	if b.cluster != nil {
+		x -= clusterPadding
+	}
+	b.looseStart = x
+	if b.looseWidth > 0 {
+		x += b.looseWidth + l.nodeSep
+	}
+	for _, c := range b.children {
+		l.place(c, x)
+		x += c.width + l.nodeSep
+	}
+}
+
+func (l *layout) walkBands(b *band, fn func(*band)) {
+	fn(b)
+	for _, c := range b.children {
+		l.walkBands(c, fn)
+	}
+}
+
+// assignPositions places vertices along each rank within their band, pulling
+// each towards the mean position of its neighbors while preserving order and
+// spacing.
+func (l *layout) assignPositions() {
+	root := l.bands()
+	l.measure(root)
+	l.place(root, 0)
+
+	var segments []segment
+	l.walkBands(root, func(b *band) {
+		for r, rank := range b.loose {
+			if len(rank) == 0 {
+				continue
+			}
+			s := segment{rank: r, vertices: rank, lo: b.looseStart, hi: b.looseStart + b.looseWidth}
+			l.pack(s)
+			segments = append(segments, s)
+		}
+	})
+	sort.SliceStable(segments, func(i, j int) bool { return segments[i].rank < segments[j].rank })
+
+	in := func(v *vertex) []int { return v.in }
+	out := func(v *vertex) []int { return v.out }
+	both := func(v *vertex) []int { return append(v.in[:len(v.in):len(v.in)], v.out...) }
+	for i := 0; i < placeIterations; i++ {
+		for _, s := range segments {
+			l.placeSegment(s, in)
+		}
+		for j := len(segments) - 1; j >= 0; j-- {
+			l.placeSegment(segments[j], out)
+		}
+	}
+	for _, s := range segments {
+		l.placeSegment(s, both)
+	}
+}
+
+// segment is the run of vertices in one rank of a band's loose region.
+type segment struct {
+	rank     int
+	vertices []int
+	lo, hi   float64
+}
+
+func (l *layout) pack(s segment) {
+	x := s.lo
+	for i, v := range s.vertices {
+		if i > 0 {
+			x += l.nodeSep
+		}
+		x += l.vertices[v].w / 2
+		l.vertices[v].pos = x
+		x += l.vertices[v].w / 2
+	}
+}
+
+// placeSegment solves for positions closest to each vertex's desired position
+// subject to minimum separation, using pool-adjacent-violators, then clamps
+// the result to the segment's bounds.
+func (l *layout) placeSegment(s segment, neighbors func(*vertex) []int) {
+	n := len(s.vertices)
+	offsets := make([]float64, n)
+	targets := make([]float64, n)
+	weights := make([]float64, n)
+	for i, v := range s.vertices {
+		vert := l.vertices[v]
+		if i > 0 {
+			prev := l.vertices[s.vertices[i-1]]
+			offsets[i] = offsets[i-1] + (prev.w+vert.w)/2 + l.nodeSep
+		}
+		desired := vert.pos
+		if ns := neighbors(vert); len(ns) > 0 {
+			sum := 0.0
+			for _, n := range ns {
+				sum += l.vertices[n].pos
+			}
+			desired = sum / float64(len(ns))
+		}
+		targets[i] = desired - offsets[i]
+		weights[i] = 1
+		if vert.node == nil {
+			// keep long edges straight
+			weights[i] = 2
+		}
+	}
+
+	type block struct {
+		start, end  int
+		sum, weight float64
+	}
+	var blocks []block
+	for i := range s.vertices {
+		blocks = append(blocks, block{start: i, end: i + 1, sum: targets[i] * weights[i], weight: weights[i]})
+		for len(blocks) > 1 {
+			a, b := blocks[len(blocks)-2], blocks[len(blocks)-1]
+			if a.sum/a.weight <= b.sum/b.weight {
+				break
+			}
+			blocks = append(blocks[:len(blocks)-2], block{start: a.start, end: b.end, sum: a.sum + b.sum, weight: a.weight + b.weight})
+		}
+	}
+	pos := make([]float64, n)
+	for _, b := range blocks {
+		y := b.sum / b.weight
+		for i := b.start; i < b.end; i++ {
+			pos[i] = y + offsets[i]
+		}
+	}
+
+	// clamping each position relative to its offset keeps the spacing intact
+	lo := s.lo + l.vertices[s.vertices[0]].w/2
+	hi := s.hi - l.vertices[s.vertices[n-1]].w/2 - offsets[n-1]
+	for i, v := range s.vertices {
+		y := math.Max(lo, math.Min(hi, pos[i]-offsets[i]))
+		l.vertices[v].pos = y + offsets[i]
+	}
+}
+
+func (l *layout) assignRankPositions() {
+	l.rankSize = make([]float64, len(l.ranks))
+	l.rankPos = make([]float64, len(l.ranks))
+	for r, rank := range l.ranks {
+		for _, v := range rank {
+			l.rankSize[r] = math.Max(l.rankSize[r], l.vertices[v].h)
+		}
+		if r == 0 {
+			l.rankPos[r] = l.rankSize[r] / 2
+		} else {
+			l.rankPos[r] = l.rankPos[r-1] + l.rankSize[r-1]/2 + l.rankSep + l.rankSize[r]/2
+		}
+	}
+}
+
+func commonClusters(a, b []*dot.Subgraph) []*dot.Subgraph {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
+
+// number parses a DOT numeric attribute, returning def if it is unset or
+// malformed.
+func number(s string, def float64) float64 {
+	if f := strings.Fields(s); len(f) > 0 {
+		if v, err := strconv.ParseFloat(f[0], 64); err == nil {
+			return v
+		}
+	}
+	return def
+}
+
+// inches converts a DOT length in inches to points.
+func inches(s string, def float64) float64 {
+	return number(s, def) * pointsPerInch
+}
@@ -0,0 +1,75 @@
+package render
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// TestLayeredGolden renders each testdata/*.dot graph with the layered
+// renderer and compares it to testdata/*.svg. Run with -update to rewrite the
+// golden files after an intended layout change, and review the diff.
+func TestLayeredGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.dot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no testdata/*.dot files")
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".dot")
+		t.Run(name, func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := layered{}.Render(string(src), Options{Format: SVG})
+			if err != nil {
+				t.Fatalf("Render: %s", err)
+			}
+
+			// layouts must be deterministic for caching and for this test
+			again, err := layered{}.Render(string(src), Options{Format: SVG})
+			if err != nil {
+				t.Fatalf("Render: %s", err)
+			}
+			if again != got {
+				t.Fatal("Render is not deterministic")
+			}
+
+			golden := filepath.Join("testdata", name+".svg")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%s, run with -update to create it", err)
+			}
+			if got != string(want) {
+				t.Errorf("Render differs from %s, run with -update and review the diff:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestLayeredUnsupported(t *testing.T) {
+	src := "digraph { a -> b }"
+	if _, err := (layered{}).Render(src, Options{Format: PNG}); err == nil {
+		t.Error("Render(png) succeeded, want ErrUnsupportedFormat")
+	}
+	if _, err := (layered{}).Render(src, Options{Format: SVG, Engine: "neato"}); err == nil {
+		t.Error("Render(neato) succeeded, want ErrUnsupportedEngine")
+	}
+	if _, err := (layered{}).Render("digraph {", Options{Format: SVG}); err == nil {
+		t.Error("Render of malformed DOT succeeded")
+	}
+}
@@ -0,0 +1,217 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Format is an output format, named by its file suffix.
+type Format string
+
+const (
+	// DOT is Graphviz's DOT language, as produced by the graph server.
+	DOT Format = "dot"
+	// SVG is a scalable vector image.
+	SVG Format = "svg"
+	// PNG is a raster image.
+	PNG Format = "png"
+	// PDF is a vector document.
+	PDF Format = "pdf"
+	// WebP is a raster image.
+	WebP Format = "webp"
+	// Mermaid is a Mermaid flowchart.
+	Mermaid Format = "mmd"
+	// PlantUML is a PlantUML component diagram.
+	PlantUML Format = "puml"
+	// D2 is a D2 diagram.
+	D2 Format = "d2"
+	// GraphML is a GraphML document.
+	GraphML Format = "graphml"
+	// JSON is a JSON document of nodes and edges.
+	JSON Format = "json"
+)
+
+// Formats lists every supported output format.
+var Formats = []Format{DOT, SVG, PNG, PDF, WebP, Mermaid, PlantUML, D2, GraphML, JSON}
+
+var contentTypes = map[Format]string{
+	DOT:  "text/plain; charset=utf-8",
+	SVG:  "image/svg+xml; charset=utf-8",
+	PNG:  "image/png",
+	PDF:  "application/pdf",
+	WebP: "image/webp",
+
+	Mermaid:  "text/plain; charset=utf-8",
+	PlantUML: "text/plain; charset=utf-8",
+	D2:       "text/plain; charset=utf-8",
+	GraphML:  "application/graphml+xml; charset=utf-8",
+	JSON:     "application/json",
+}
+
+const (
+	// DefaultDPI matches Graphviz's default resolution for raster formats.
+	DefaultDPI = 96
+	minDPI     = 24
+	maxDPI     = 600
+)
+
+// Engines lists the Graphviz layout engines that may be selected. The empty
+// engine means dot.
+var Engines = []string{"dot", "neato", "fdp", "sfdp", "circo", "twopi"}
+
+// RankDirs lists the rank directions that may be selected. The empty rank
+// direction keeps the one in the DOT graph.
+var RankDirs = []string{"TB", "LR", "BT", "RL"}
+
+var (
+	// ErrUnsupportedFormat is returned by Renderers that cannot produce a
+	// format.
+	ErrUnsupportedFormat = errors.New("unsupported format")
+
+	// ErrUnsupportedEngine is returned by Renderers that cannot lay out
+	// graphs with an engine.
+	ErrUnsupportedEngine = errors.New("unsupported engine")
+)
+
+// ParseFormat returns the Format for a file suffix, with or without the
+// leading dot.
+func ParseFormat(suffix string) (Format, error) {
+	f := Format(strings.TrimPrefix(suffix, "."))
+	if _, ok := contentTypes[f]; !ok {
+		return "", fmt.Errorf("unknown format %q", suffix)
+	}
+	return f, nil
+}
+
+// ContentType returns the HTTP Content-Type for the format.
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// Raster reports whether the format is a bitmap, and hence honors DPI.
+func (f Format) Raster() bool {
+	return f == PNG || f == WebP
+}
+
+// Binary reports whether the format is binary rather than text.
+func (f Format) Binary() bool {
+	return f.Raster() || f == PDF
+}
+
+// Options describes how to render a repo's dependency graph.
+type Options struct {
+	// Cluster groups packages by directory.
+	Cluster bool
+	Format  Format
+	// DPI sets the resolution of raster formats. Zero means DefaultDPI.
+	DPI int
+	// Engine selects the Graphviz layout engine, one of Engines.
+	Engine string
+	// RankDir overrides the graph's rank direction, one of RankDirs.
+	RankDir string
+	// Theme styles the graph, one of Themes.
+	Theme string
+
+	// Exclude hides packages matching any of these globs, e.g. "**/mocks/**".
+	Exclude []string
+	// Collapse merges each directory subtree matching any of these patterns
+	// into a single node, e.g. "internal/...".
+	Collapse []string
+	// MaxDepth collapses packages more than MaxDepth directories below the
+	// repo root into their ancestor at that depth. Zero means no limit.
+	MaxDepth int
+	// Reduce removes edges implied by longer paths. JSON output keeps them,
+	// marked as implied.
+	Reduce bool
+}
+
+// Validate checks the options and normalizes settings that do not apply to
+// the format, so equivalent options share a cache entry.
+func (o *Options) Validate() error {
+	if _, ok := contentTypes[o.Format]; !ok {
+		return fmt.Errorf("unknown format %q", o.Format)
+	}
+	if !o.Format.Raster() || o.DPI == DefaultDPI {
+		o.DPI = 0
+	}
+	if o.DPI != 0 && (o.DPI < minDPI || o.DPI > maxDPI) {
+		return fmt.Errorf("dpi must be between %d and %d", minDPI, maxDPI)
+	}
+	if o.Engine != "" && !slices.Contains(Engines, o.Engine) {
+		return fmt.Errorf("engine must be one of: %s", strings.Join(Engines, ", "))
+	}
+	if o.Engine == "dot" {
+		o.Engine = ""
+	}
+	o.RankDir = strings.ToUpper(o.RankDir)
+	if o.RankDir != "" && !slices.Contains(RankDirs, o.RankDir) {
+		return fmt.Errorf("rankdir must be one of: %s", strings.Join(RankDirs, ", "))
+	}
+	if o.Theme != "" && !slices.Contains(Themes, o.Theme) {
+		return fmt.Errorf("theme must be one of: %s", strings.Join(Themes, ", "))
+	}
+
+	var err error
+	if o.Exclude, err = validatePatterns("exclude", o.Exclude); err != nil {
+		return err
+	}
+	if o.Collapse, err = validatePatterns("collapse", o.Collapse); err != nil {
+		return err
+	}
+	if o.MaxDepth < 0 {
+		return fmt.Errorf("maxdepth must not be negative")
+	}
+	return nil
+}
+
+// validatePatterns checks glob patterns, and sorts them so equivalent options
+// share a cache entry.
+func validatePatterns(name string, patterns []string) ([]string, error) {
+	for _, p := range patterns {
+		if p == "" || strings.Contains(p, ",") {
+			return nil, fmt.Errorf("invalid %s pattern: %q", name, p)
+		}
+		for _, segment := range strings.Split(p, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("invalid %s pattern: %q", name, p)
+			}
+		}
+	}
+	patterns = slices.Clone(patterns)
+	slices.Sort(patterns)
+	return slices.Compact(patterns), nil
+}
+
+// variant returns a cache key for the options within a format: the cluster
+// flag, followed by each option that is set, e.g. "true+dpi=192".
+func (o Options) variant() string {
+	v := fmt.Sprintf("%t", o.Cluster)
+	if o.DPI != 0 {
+		v += fmt.Sprintf("+dpi=%d", o.DPI)
+	}
+	if o.Engine != "" {
+		v += "+engine=" + o.Engine
+	}
+	if o.RankDir != "" {
+		v += "+rankdir=" + o.RankDir
+	}
+	if o.Theme != "" {
+		v += "+theme=" + o.Theme
+	}
+	if len(o.Exclude) > 0 {
+		v += "+exclude=" + strings.Join(o.Exclude, ",")
+	}
+	if len(o.Collapse) > 0 {
+		v += "+collapse=" + strings.Join(o.Collapse, ",")
+	}
+	if o.MaxDepth != 0 {
+		v += fmt.Sprintf("+maxdepth=%d", o.MaxDepth)
+	}
+	if o.Reduce {
+		v += "+reduce"
+	}
+	return v
+}
@@ -1,26 +1,37 @@
 package render
 
-// This package takes GoLang repos as input and outputs SVG and DOT files:
+// This package takes GoLang repos as input and outputs DOT, SVG, PNG, PDF and
+// WebP files, plus Mermaid, PlantUML, D2, GraphML and JSON exports:
 //
 // 1. repo => dot
 //    curl --data '{"repo":"github.com/siggy/gographs","cluster":true}' -X POST [graph-addr]/graph
-// 2. dot => svg
-//    echo "..." | \
-//      dot -Tsvg \
-//      -Gfontname=Roboto,Arial,sans-serif \
-//      -Nfontname=Roboto,Arial,sans-serif \
-//      -Efontname=Roboto,Arial,sans-serif \
-//      -o graph2.svg
+// 2. dot => svg|png|pdf|webp, via a Renderer:
+//    - graphviz: shells out to the dot binary, with a selectable layout engine
+//      echo "..." | \
+//        dot -Tsvg \
+//        -Kdot \
+//        -Gdpi=96 \
+//        -Gfontname=Roboto,Arial,sans-serif \
+//        -Nfontname=Roboto,Arial,sans-serif \
+//        -Efontname=Roboto,Arial,sans-serif \
+//        -o graph2.svg
+//    - layered: lays out the graph in-process, no Graphviz required, SVG only
 //
-// Nested control-flow accommodates caching:
+// 3. dot => mmd|puml|d2|graphml|json, via pkg/export
 //
-// ToSVG(repo) {
+// Nested control-flow accommodates caching, per format:
+//
+// Render(repo, format) {
 //   ToDOT(repo) {} => DOT
-//   dotToSVG(DOT) {} => SVG
-// } => SVG
+//   renderer.Render(DOT, format) {} => SVG|PNG|PDF|WebP
+// } => SVG|PNG|PDF|WebP
+//
+// Cached graphs outlive their TTL as stale entries. Stale entries are served
+// as-is while Render rebuilds them, from fresh DOT, in the background.
 
 import (
 	"bytes"
+	"fmt"
 	"os/exec"
 	"strings"
 
@@ -29,65 +40,224 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// ToSVG takes a GoLang repo as input and returns an SVG dependency graph
-func ToSVG(graph *graph.Client, cache *cache.Cache, repo string, cluster bool) (string, error) {
-	svg, err := cache.GetSVG(repo, cluster)
+const (
+	// Graphviz renders by shelling out to Graphviz's dot binary.
+	Graphviz = "graphviz"
+
+	// Layered renders in-process, without Graphviz.
+	Layered = "layered"
+)
+
+// Renderer converts a DOT graph to an image. Renderers return
+// ErrUnsupportedFormat for formats they cannot produce.
+type Renderer interface {
+	Render(dot string, opts Options) (string, error)
+}
+
+// NewRenderer returns the Renderer with the given name, one of Graphviz or
+// Layered.
+func NewRenderer(name string) (Renderer, error) {
+	switch name {
+	case Graphviz:
+		return graphviz{}, nil
+	case Layered:
+		return layered{}, nil
+	default:
+		return nil, fmt.Errorf("unknown renderer %q, must be one of: %s, %s", name, Graphviz, Layered)
+	}
+}
+
+// Render takes a GoLang repo as input and returns its dependency graph in the
+// format given by opts. Stale graphs are returned immediately, and rebuilt in
+// the background.
+func Render(graph *graph.Client, cache *cache.Cache, renderer Renderer, repo string, opts Options) (cache.Entry, error) {
+	if opts.Format == DOT {
+		entry, err := ToDOT(graph, cache, repo, opts.Cluster)
+		if err != nil {
+			return entry, err
+		}
+		dot, err := entry.Value()
+		if err != nil {
+			return entry, err
+		}
+		dot, err = applyOptions(dot, repo, opts)
+		return entry.WithValue(dot), err
+	}
+
+	if _, ok := exporters[opts.Format]; ok {
+		entry, err := ToDOT(graph, cache, repo, opts.Cluster)
+		if err != nil {
+			return entry, err
+		}
+		dot, err := entry.Value()
+		if err != nil {
+			return entry, err
+		}
+		dot, err = applyOptions(dot, repo, opts)
+		if err != nil {
+			return entry, err
+		}
+		out, err := exportDOT(dot, opts.Format)
+		return entry.WithValue(out), err
+	}
+
+	format := string(opts.Format)
+	entry, err := cache.Get(format, repo, opts.variant())
 	if err == nil {
-		return svg, nil
+		if entry.Stale {
+			cache.Revalidate(format, repo, opts.variant(), func() (string, error) {
+				dot, err := fetchDOT(graph, cache, repo, opts.Cluster)
+				if err != nil {
+					return "", err
+				}
+				return renderDOT(renderer, dot, repo, opts)
+			})
+		}
+		return entry, nil
 	}
 
-	dot, err := ToDOT(graph, cache, repo, cluster)
+	dotEntry, err := ToDOT(graph, cache, repo, opts.Cluster)
 	if err != nil {
 		log.Errorf("error generating dot: %s", err)
-		return "", err
+		return entry, err
+	}
+	dot, err := dotEntry.Value()
+	if err != nil {
+		return entry, err
 	}
 
-	svg, err = dotToSVG(dot)
+	out, err := renderDOT(renderer, dot, repo, opts)
 	if err != nil {
-		log.Errorf("error converting dot to svg: %s", err)
-		return "", err
+		return entry, err
 	}
 
-	go cache.SetSVG(repo, cluster, svg)
+	go cache.Set(format, repo, opts.variant(), out)
 
-	return svg, nil
+	return cache.NewEntry(out), nil
+}
+
+// Warm rebuilds a repo's DOT graph, and its rendering in the format given by
+// opts, and caches both, replacing any cached copies.
+func Warm(graph *graph.Client, cache *cache.Cache, renderer Renderer, repo string, opts Options) error {
+	dot, err := graph.Get(repo, opts.Cluster)
+	if err != nil {
+		return err
+	}
+	cache.Set(string(DOT), repo, Options{Cluster: opts.Cluster}.variant(), dot)
+
+	if opts.Format == DOT {
+		return nil
+	}
+	if _, ok := exporters[opts.Format]; ok {
+		// exports are derived from the DOT graph on each request
+		return nil
+	}
+
+	out, err := renderDOT(renderer, dot, repo, opts)
+	if err != nil {
+		return err
+	}
+	cache.Set(string(opts.Format), repo, opts.variant(), out)
+	return nil
+}
+
+// Cached reports whether a repo's graph in the format given by opts is cached,
+// stale or not, so Render would return it without building it.
+func Cached(cache *cache.Cache, repo string, opts Options) bool {
+	format, variant := opts.Format, opts.variant()
+	if _, ok := exporters[format]; ok || format == DOT {
+		// DOT and exports are derived from the cached DOT graph
+		format, variant = DOT, Options{Cluster: opts.Cluster}.variant()
+	}
+	_, err := cache.Get(string(format), repo, variant)
+	return err == nil
+}
+
+// renderDOT applies opts to a DOT graph and renders it.
+func renderDOT(renderer Renderer, dot, repo string, opts Options) (string, error) {
+	dot, err := applyOptions(dot, repo, opts)
+	if err != nil {
+		log.Errorf("error applying options to dot: %s", err)
+		return "", err
+	}
+
+	out, err := renderer.Render(dot, opts)
+	if err != nil {
+		log.Errorf("error converting dot to %s: %s", opts.Format, err)
+		return "", err
+	}
+	if opts.Format == SVG && opts.Theme == Auto {
+		out = adaptiveStyle(out)
+	}
+	return out, nil
 }
 
 // ToDOT takes a GoLang repo as input and returns a DOT dependency graph
-func ToDOT(graph *graph.Client, cache *cache.Cache, repo string, cluster bool) (string, error) {
-	dot, err := cache.GetDOT(repo, cluster)
+func ToDOT(graph *graph.Client, cache *cache.Cache, repo string, cluster bool) (cache.Entry, error) {
+	variant := Options{Cluster: cluster}.variant()
+	entry, err := cache.Get(string(DOT), repo, variant)
 	if err == nil {
-		return dot, nil
+		if entry.Stale {
+			cache.Revalidate(string(DOT), repo, variant, func() (string, error) {
+				return graph.Get(repo, cluster)
+			})
+		}
+		return entry, nil
 	}
 
-	dot, err = graph.Get(repo, cluster)
+	dot, err := fetchDOT(graph, cache, repo, cluster)
+	if err != nil {
+		return entry, err
+	}
+
+	return cache.NewEntry(dot), nil
+}
+
+// fetchDOT asks the graph server for a repo's DOT graph and caches it.
+func fetchDOT(graph *graph.Client, cache *cache.Cache, repo string, cluster bool) (string, error) {
+	dot, err := graph.Get(repo, cluster)
 	if err != nil {
 		return "", err
 	}
 
-	go cache.SetDOT(repo, cluster, dot)
+	go cache.Set(string(DOT), repo, Options{Cluster: cluster}.variant(), dot)
 
 	return dot, nil
 }
 
-func dotToSVG(dot string) (string, error) {
-	command := exec.Command(
-		"dot",
-		"-Tsvg",
+// graphviz implements Renderer using Graphviz's dot binary.
+type graphviz struct{}
+
+func (graphviz) Render(dot string, opts Options) (string, error) {
+	args := []string{
+		"-T" + string(opts.Format),
+		"-K" + engine(opts),
 		"-Gfontname=Roboto,Arial,sans-serif",
 		"-Nfontname=Roboto,Arial,sans-serif",
 		"-Efontname=Roboto,Arial,sans-serif",
-	)
+	}
+	if opts.DPI != 0 {
+		args = append(args, fmt.Sprintf("-Gdpi=%d", opts.DPI))
+	}
+	command := exec.Command("dot", args...)
 	command.Stdin = strings.NewReader(dot)
 	var stderr bytes.Buffer
 	command.Stderr = &stderr
 
 	log.Debugf("running dot: %s", command)
-	svg, err := command.Output()
+	out, err := command.Output()
 	if err != nil {
-		log.Errorf("dot cmd failed: %s", err)
-		return "", err
+		log.Errorf("dot cmd failed [%s]: %s", err, stderr.String())
+		return "", fmt.Errorf("dot cmd failed: %w: %s", err, strings.TrimSpace(stderr.String()))
 	}
 
-	return string(svg), nil
+	return string(out), nil
+}
+
+// engine returns the Graphviz layout engine for opts, defaulting to dot.
+func engine(opts Options) string {
+	if opts.Engine == "" {
+		return "dot"
+	}
+	return opts.Engine
 }
@@ -0,0 +1,410 @@
+package render
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/dot"
+)
+
+type point struct{ x, y float64 }
+
+type box struct{ x0, y0, x1, y1 float64 }
+
+func (b box) union(o box) box {
+	return box{math.Min(b.x0, o.x0), math.Min(b.y0, o.y0), math.Max(b.x1, o.x1), math.Max(b.y1, o.y1)}
+}
+
+// toPoint maps a layout coordinate (position along a rank, position across
+// ranks) onto the page according to rankdir.
+func (l *layout) toPoint(pos, rank float64) point {
+	last := len(l.rankPos) - 1
+	extent := 0.0
+	if last >= 0 {
+		extent = l.rankPos[last] + l.rankSize[last]/2
+	}
+	switch l.rankdir {
+	case "BT":
+		return point{pos, extent - rank}
+	case "LR":
+		return point{rank, pos}
+	case "RL":
+		return point{extent - rank, pos}
+	default:
+		return point{pos, rank}
+	}
+}
+
+func (l *layout) vertexBox(v *vertex) box {
+	c := l.toPoint(v.pos, l.rankPos[v.rank])
+	w, h := v.w, v.h
+	if l.horizontal() {
+		w, h = h, w
+	}
+	return box{c.x - w/2, c.y - h/2, c.x + w/2, c.y + h/2}
+}
+
+// svg writes the layout as an SVG document, mirroring the element structure
+// Graphviz emits so existing styling and tooling keep working.
+func (l *layout) svg() string {
+	clusterBoxes := map[*dot.Subgraph]box{}
+	var bounds *box
+	grow := func(b box) {
+		if bounds == nil {
+			bounds = &b
+			return
+		}
+		u := bounds.union(b)
+		bounds = &u
+	}
+
+	var visit func(s *dot.Subgraph) (box, bool)
+	visit = func(s *dot.Subgraph) (box, bool) {
+		var b *box
+		add := func(o box) {
+			if b == nil {
+				b = &o
+				return
+			}
+			u := b.union(o)
+			b = &u
+		}
+		for _, sub := range s.Subgraphs {
+			if sb, ok := visit(sub); ok {
+				add(sb)
+			}
+		}
+		for _, v := range l.vertices {
+			if v.node != nil && len(v.clusters) > 0 && v.clusters[len(v.clusters)-1] == s {
+				add(l.vertexBox(v))
+			}
+		}
+		if b == nil || !s.IsCluster() {
+			if b == nil {
+				return box{}, false
+			}
+			return *b, true
+		}
+		padded := box{b.x0 - clusterPadding, b.y0 - clusterPadding, b.x1 + clusterPadding, b.y1 + clusterPadding}
+		if s.Attrs.Get("label", "") != "" {
+			padded.y0 -= defaultFontSize * lineHeight
+		}
+		clusterBoxes[s] = padded
+		return padded, true
+	}
+	for _, s := range l.g.Subgraphs {
+		if b, ok := visit(s); ok {
+			grow(b)
+		}
+	}
+	for _, v := range l.vertices {
+		if v.node != nil {
+			grow(l.vertexBox(v))
+		}
+	}
+	if bounds == nil {
+		bounds = &box{}
+	}
+
+	dx, dy := graphMargin-bounds.x0, graphMargin-bounds.y0
+	width := bounds.x1 - bounds.x0 + 2*graphMargin
+	height := bounds.y1 - bounds.y0 + 2*graphMargin
+	shift := func(p point) point { return point{p.x + dx, p.y + dy} }
+
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n")
+	fmt.Fprintf(&sb, `<svg width="%.0fpt" height="%.0fpt" viewBox="0.00 0.00 %.2f %.2f" xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">`+"\n",
+		width, height, width, height)
+	sb.WriteString(`<g id="graph0" class="graph">` + "\n")
+	fmt.Fprintf(&sb, "<title>%s</title>\n", html.EscapeString(l.g.ID))
+	bg, bgOpacity := svgColor(l.g.Attrs.Get("bgcolor", "white"))
+	fmt.Fprintf(&sb, `<polygon fill="%s"%s stroke="none" points="%s"/>`+"\n",
+		bg, opacityAttr("fill", bgOpacity), rectPoints(box{0, 0, width, height}))
+
+	// draw outer clusters first so nested clusters sit on top
+	var clusters []*dot.Subgraph
+	l.g.Walk(func(s *dot.Subgraph, _ []*dot.Subgraph) {
+		if _, ok := clusterBoxes[s]; ok {
+			clusters = append(clusters, s)
+		}
+	})
+	for i, s := range clusters {
+		b := clusterBoxes[s]
+		b = box{b.x0 + dx, b.y0 + dy, b.x1 + dx, b.y1 + dy}
+		fmt.Fprintf(&sb, `<g id="clust%d" class="cluster">`+"\n", i+1)
+		fmt.Fprintf(&sb, "<title>%s</title>\n", html.EscapeString(s.ID))
+		closeLink := openLink(&sb, s.Attrs)
+		stroke, strokeOpacity := svgColor(s.Attrs.Get("pencolor", s.Attrs.Get("color", "black")))
+		fill, fillOpacity := "none", 1.0
+		if strings.Contains(s.Attrs.Get("style", ""), "filled") {
+			fill, fillOpacity = svgColor(s.Attrs.Get("fillcolor", s.Attrs.Get("color", "lightgrey")))
+		}
+		fmt.Fprintf(&sb, `<polygon fill="%s"%s stroke="%s"%s points="%s"/>`+"\n",
+			fill, opacityAttr("fill", fillOpacity), stroke, opacityAttr("stroke", strokeOpacity), rectPoints(b))
+		if label := s.Attrs.Get("label", ""); label != "" {
+			writeText(&sb, dot.LabelLines(label, s.ID, l.g.ID), point{(b.x0 + b.x1) / 2, b.y0 + clusterPadding/2},
+				s.Attrs.Get("fontname", l.g.Attrs.Get("fontname", defaultFontName)),
+				number(s.Attrs.Get("fontsize", ""), defaultFontSize),
+				s.Attrs.Get("fontcolor", "black"))
+		}
+		closeLink()
+		sb.WriteString("</g>\n")
+	}
+
+	nodeCount := 0
+	for _, v := range l.vertices {
+		if v.node == nil {
+			continue
+		}
+		nodeCount++
+		n := v.node
+		attr := func(key, def string) string { return l.g.NodeAttr(n, key, def) }
+		b := l.vertexBox(v)
+		b = box{b.x0 + dx, b.y0 + dy, b.x1 + dx, b.y1 + dy}
+		center := point{(b.x0 + b.x1) / 2, (b.y0 + b.y1) / 2}
+
+		fmt.Fprintf(&sb, `<g id="node%d" class="node">`+"\n", nodeCount)
+		fmt.Fprintf(&sb, "<title>%s</title>\n", html.EscapeString(n.ID))
+		closeLink := openLink(&sb, mergedAttrs(l.g.NodeAttrs, n.Attrs))
+
+		style := attr("style", "")
+		stroke, strokeOpacity := svgColor(attr("color", "black"))
+		fill, fillOpacity := "none", 1.0
+		if strings.Contains(style, "filled") {
+			fill, fillOpacity = svgColor(attr("fillcolor", attr("color", "lightgrey")))
+		}
+		paint := fmt.Sprintf(`fill="%s"%s stroke="%s"%s stroke-width="%s"%s`,
+			fill, opacityAttr("fill", fillOpacity),
+			stroke, opacityAttr("stroke", strokeOpacity),
+			strconv.FormatFloat(number(attr("penwidth", ""), 1), 'f', -1, 64),
+			dashAttr(style))
+
+		switch attr("shape", "ellipse") {
+		case "none", "plaintext", "plain":
+		case "ellipse", "oval", "circle":
+			fmt.Fprintf(&sb, `<ellipse %s cx="%.2f" cy="%.2f" rx="%.2f" ry="%.2f"/>`+"\n",
+				paint, center.x, center.y, (b.x1-b.x0)/2, (b.y1-b.y0)/2)
+		default:
+			radius := 0.0
+			if strings.Contains(style, "rounded") {
+				radius = 4
+			}
+			fmt.Fprintf(&sb, `<rect %s x="%.2f" y="%.2f" width="%.2f" height="%.2f" rx="%.0f" ry="%.0f"/>`+"\n",
+				paint, b.x0, b.y0, b.x1-b.x0, b.y1-b.y0, radius, radius)
+		}
+
+		fontSize := number(attr("fontsize", ""), defaultFontSize)
+		top := center.y - float64(len(v.label))*fontSize*lineHeight/2
+		writeText(&sb, v.label, point{center.x, top}, attr("fontname", defaultFontName), fontSize, attr("fontcolor", "black"))
+		closeLink()
+		sb.WriteString("</g>\n")
+	}
+
+	for i, e := range l.edges {
+		attr := func(key, def string) string { return l.g.EdgeAttr(e.edge, key, def) }
+		points, tip, base := l.route(e)
+
+		fmt.Fprintf(&sb, `<g id="edge%d" class="edge">`+"\n", i+1)
+		fmt.Fprintf(&sb, "<title>%s</title>\n", html.EscapeString(e.edge.From+"->"+e.edge.To))
+		closeLink := openLink(&sb, mergedAttrs(l.g.EdgeAttrs, e.edge.Attrs))
+
+		stroke, strokeOpacity := svgColor(attr("color", "black"))
+		penWidth := strconv.FormatFloat(number(attr("penwidth", ""), 1), 'f', -1, 64)
+		var d strings.Builder
+		p0 := shift(points[0])
+		fmt.Fprintf(&d, "M%.2f,%.2f", p0.x, p0.y)
+		for j := 1; j < len(points); j++ {
+			a, b := shift(points[j-1]), shift(points[j])
+			c1, c2 := l.controls(a, b)
+			fmt.Fprintf(&d, " C%.2f,%.2f %.2f,%.2f %.2f,%.2f", c1.x, c1.y, c2.x, c2.y, b.x, b.y)
+		}
+		fmt.Fprintf(&sb, `<path fill="none" stroke="%s"%s stroke-width="%s"%s d="%s"/>`+"\n",
+			stroke, opacityAttr("stroke", strokeOpacity), penWidth, dashAttr(attr("style", "")), d.String())
+
+		if attr("arrowhead", "normal") != "none" && attr("dir", "forward") != "none" {
+			t, b := shift(tip), shift(base)
+			nx, ny := (t.y-b.y)/2, (b.x-t.x)/2
+			fmt.Fprintf(&sb, `<polygon fill="%s"%s stroke="%s"%s stroke-width="%s" points="%.2f,%.2f %.2f,%.2f %.2f,%.2f %.2f,%.2f"/>`+"\n",
+				stroke, opacityAttr("fill", strokeOpacity), stroke, opacityAttr("stroke", strokeOpacity), penWidth,
+				t.x, t.y, b.x+nx*0.7, b.y+ny*0.7, b.x-nx*0.7, b.y-ny*0.7, t.x, t.y)
+		}
+		closeLink()
+		sb.WriteString("</g>\n")
+	}
+
+	sb.WriteString("</g>\n</svg>\n")
+	return sb.String()
+}
+
+// route returns the points an edge passes through, from the tail's boundary to
+// the base of the arrowhead, along with the arrowhead's tip and base.
+func (l *layout) route(e *layoutEdge) ([]point, point, point) {
+	var raw []point
+	for i, idx := range e.path {
+		v := l.vertices[idx]
+		rank := l.rankPos[v.rank]
+		switch {
+		case i == 0:
+			raw = append(raw, point{v.pos, rank + v.h/2})
+		case i == len(e.path)-1:
+			raw = append(raw, point{v.pos, rank - v.h/2})
+		default:
+			// run straight through the rank so long edges stay clear of nodes
+			half := l.rankSize[v.rank] / 2
+			raw = append(raw, point{v.pos, rank - half}, point{v.pos, rank + half})
+		}
+	}
+	if e.reversed {
+		for i, j := 0, len(raw)-1; i < j; i, j = i+1, j-1 {
+			raw[i], raw[j] = raw[j], raw[i]
+		}
+	}
+
+	// shorten the final segment to leave room for the arrowhead
+	end := raw[len(raw)-1]
+	dir := 1.0
+	if e.reversed {
+		dir = -1
+	}
+	base := point{end.x, end.y - dir*arrowSize}
+	raw[len(raw)-1] = base
+
+	points := make([]point, len(raw))
+	for i, p := range raw {
+		points[i] = l.toPoint(p.x, p.y)
+	}
+	return points, l.toPoint(end.x, end.y), l.toPoint(base.x, base.y)
+}
+
+// controls returns Bézier control points that leave and enter each point
+// perpendicular to the ranks.
+func (l *layout) controls(a, b point) (point, point) {
+	if l.horizontal() {
+		mid := (a.x + b.x) / 2
+		return point{mid, a.y}, point{mid, b.y}
+	}
+	mid := (a.y + b.y) / 2
+	return point{a.x, mid}, point{b.x, mid}
+}
+
+// openLink writes an <a> element for href/URL attributes and returns a func
+// that closes it.
+func openLink(sb *strings.Builder, attrs dot.Attrs) func() {
+	href := attrs.Get("href", attrs.Get("URL", ""))
+	tooltip := attrs.Get("tooltip", "")
+	if href == "" && tooltip == "" {
+		return func() {}
+	}
+	sb.WriteString("<a")
+	if href != "" {
+		fmt.Fprintf(sb, ` xlink:href="%s"`, html.EscapeString(href))
+	}
+	if tooltip != "" {
+		fmt.Fprintf(sb, ` xlink:title="%s"`, html.EscapeString(strings.ReplaceAll(tooltip, `\n`, "\n")))
+	}
+	if target := attrs.Get("target", ""); target != "" {
+		fmt.Fprintf(sb, ` target="%s"`, html.EscapeString(target))
+	}
+	sb.WriteString(">\n")
+	return func() { sb.WriteString("</a>\n") }
+}
+
+func writeText(sb *strings.Builder, lines []string, top point, font string, size float64, color string) {
+	fill, opacity := svgColor(color)
+	for i, line := range lines {
+		y := top.y + (float64(i)+0.8)*size*lineHeight
+		fmt.Fprintf(sb, `<text text-anchor="middle" x="%.2f" y="%.2f" font-family="%s" font-size="%.2f" fill="%s"%s>%s</text>`+"\n",
+			top.x, y, html.EscapeString(font), size, fill, opacityAttr("fill", opacity), html.EscapeString(line))
+	}
+}
+
+func mergedAttrs(defaults, attrs dot.Attrs) dot.Attrs {
+	merged := dot.Attrs{}
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range attrs {
+		merged[k] = v
+	}
+	return merged
+}
+
+func rectPoints(b box) string {
+	return fmt.Sprintf("%.2f,%.2f %.2f,%.2f %.2f,%.2f %.2f,%.2f %.2f,%.2f",
+		b.x0, b.y0, b.x1, b.y0, b.x1, b.y1, b.x0, b.y1, b.x0, b.y0)
+}
+
+func opacityAttr(prop string, opacity float64) string {
+	if opacity >= 1 {
+		return ""
+	}
+	return fmt.Sprintf(` %s-opacity="%.6f"`, prop, opacity)
+}
+
+func dashAttr(style string) string {
+	switch {
+	case strings.Contains(style, "dashed"):
+		return ` stroke-dasharray="5,2"`
+	case strings.Contains(style, "dotted"):
+		return ` stroke-dasharray="1,5"`
+	}
+	return ""
+}
+
+// svgColor converts a Graphviz color (#rrggbb, #rrggbbaa, "H S V" or a name)
+// into an SVG color and opacity. Color lists use their first entry.
+func svgColor(c string) (string, float64) {
+	c = strings.TrimSpace(strings.SplitN(c, ":", 2)[0])
+	if strings.HasPrefix(c, "#") && len(c) == 9 {
+		a, err := strconv.ParseUint(c[7:], 16, 8)
+		if err == nil {
+			return c[:7], float64(a) / 255
+		}
+	}
+	if f := strings.FieldsFunc(c, func(r rune) bool { return r == ' ' || r == ',' }); len(f) == 3 {
+		var hsv [3]float64
+		ok := true
+		for i, s := range f {
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				ok = false
+				break
+			}
+			hsv[i] = math.Max(0, math.Min(1, v))
+		}
+		if ok {
+			r, g, b := hsvToRGB(hsv[0], hsv[1], hsv[2])
+			return fmt.Sprintf("#%02x%02x%02x", r, g, b), 1
+		}
+	}
+	if c == "" {
+		return "black", 1
+	}
+	return html.EscapeString(c), 1
+}
+
+func hsvToRGB(h, s, v float64) (uint8, uint8, uint8) {
+	h = math.Mod(h*6, 6)
+	i := math.Floor(h)
+	f := h - i
+	p, q, t := v*(1-s), v*(1-s*f), v*(1-s*(1-f))
+	var r, g, b float64
+	switch int(i) {
+	case 0:
+		r, g, b = v, t, p
+	case 1:
+		r, g, b = q, v, p
+	case 2:
+		r, g, b = p, v, t
+	case 3:
+		r, g, b = p, q, v
+	case 4:
+		r, g, b = t, p, v
+	default:
+		r, g, b = v, p, q
+	}
+	return uint8(math.Round(r * 255)), uint8(math.Round(g * 255)), uint8(math.Round(b * 255))
+}
@@ -0,0 +1,186 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/dot"
+)
+
+const (
+	// Light draws dark text on a white background.
+	Light = "light"
+	// Dark draws light text on a dark background.
+	Dark = "dark"
+	// HighContrast draws white and yellow on black, replacing goda's per-package
+	// colors.
+	HighContrast = "high-contrast"
+	// Auto draws with the light theme, and embeds a stylesheet that switches SVGs
+	// to the dark theme when the viewer prefers a dark color scheme.
+	Auto = "auto"
+)
+
+// Themes lists the themes that may be selected. The empty theme keeps goda's
+// styling, i.e. Graphviz's defaults.
+var Themes = []string{Light, Dark, HighContrast, Auto}
+
+// palette holds the colors a theme is built from. Colors are lowercase hex, as
+// they appear in rendered SVGs, so the adaptive stylesheet can match them.
+type palette struct {
+	background string // graph background and node fill
+	foreground string // node labels
+	muted      string // node borders, edges and cluster labels
+	border     string // cluster borders
+	surface    string // cluster fill
+}
+
+var (
+	lightPalette = palette{
+		background: "#ffffff",
+		foreground: "#24292f",
+		muted:      "#57606a",
+		border:     "#d0d7de",
+		surface:    "#f6f8fa",
+	}
+	darkPalette = palette{
+		background: "#0d1117",
+		foreground: "#e6edf3",
+		muted:      "#8b949e",
+		border:     "#30363d",
+		surface:    "#161b22",
+	}
+)
+
+// theme holds the default attributes a theme applies to a graph.
+type theme struct {
+	graph   dot.Attrs
+	node    dot.Attrs
+	edge    dot.Attrs
+	cluster dot.Attrs
+
+	// override removes per-node and per-edge colors, so goda's package colors
+	// do not dilute the theme.
+	override bool
+}
+
+func (p palette) theme() theme {
+	return theme{
+		graph: dot.Attrs{
+			"bgcolor":   p.background,
+			"fontcolor": p.foreground,
+		},
+		node: dot.Attrs{
+			"color":     p.muted,
+			"fontcolor": p.foreground,
+			"style":     "filled",
+			"fillcolor": p.background,
+		},
+		edge: dot.Attrs{
+			"color": p.muted,
+		},
+		cluster: dot.Attrs{
+			"color":     p.border,
+			"fontcolor": p.muted,
+			"style":     "filled",
+			"fillcolor": p.surface,
+		},
+	}
+}
+
+var themes = map[string]theme{
+	Light: lightPalette.theme(),
+	Dark:  darkPalette.theme(),
+	HighContrast: {
+		graph: dot.Attrs{
+			"bgcolor":   "#000000",
+			"fontcolor": "#ffffff",
+		},
+		node: dot.Attrs{
+			"color":     "#ffffff",
+			"fontcolor": "#ffffff",
+			"style":     "filled",
+			"fillcolor": "#000000",
+			"penwidth":  "3",
+		},
+		edge: dot.Attrs{
+			"color":    "#ffff00",
+			"penwidth": "3",
+		},
+		cluster: dot.Attrs{
+			"color":     "#ffffff",
+			"fontcolor": "#ffffff",
+			"style":     "solid",
+			"penwidth":  "2",
+		},
+		override: true,
+	},
+	Auto: lightPalette.theme(),
+}
+
+// applyTheme sets a theme's attributes on the graph, its clusters, and its
+// default node and edge attributes.
+func applyTheme(g *dot.Graph, name string) {
+	t := themes[name]
+	for k, v := range t.graph {
+		g.Attrs[k] = v
+	}
+	for k, v := range t.node {
+		g.NodeAttrs[k] = v
+	}
+	for k, v := range t.edge {
+		g.EdgeAttrs[k] = v
+	}
+	g.Walk(func(s *dot.Subgraph, _ []*dot.Subgraph) {
+		if !s.IsCluster() {
+			return
+		}
+		for k, v := range t.cluster {
+			s.Attrs[k] = v
+		}
+	})
+
+	if !t.override {
+		return
+	}
+	for _, n := range g.Nodes {
+		delete(n.Attrs, "color")
+		delete(n.Attrs, "fillcolor")
+		delete(n.Attrs, "fontcolor")
+	}
+	for _, e := range g.Edges {
+		delete(e.Attrs, "color")
+	}
+}
+
+// adaptiveStyle embeds a stylesheet in an SVG drawn with the light palette,
+// recoloring it with the dark palette when the viewer prefers a dark color
+// scheme. Presentation attributes yield to CSS, so matching on them swaps each
+// light color for its dark counterpart and leaves goda's package colors alone.
+func adaptiveStyle(svg string) string {
+	start := strings.Index(svg, "<svg")
+	if start == -1 {
+		return svg
+	}
+	end := strings.Index(svg[start:], ">")
+	if end == -1 {
+		return svg
+	}
+	end += start + 1
+
+	pairs := [][2]string{
+		{lightPalette.background, darkPalette.background},
+		{lightPalette.foreground, darkPalette.foreground},
+		{lightPalette.muted, darkPalette.muted},
+		{lightPalette.border, darkPalette.border},
+		{lightPalette.surface, darkPalette.surface},
+	}
+	var sb strings.Builder
+	sb.WriteString("\n<style>\n@media (prefers-color-scheme: dark) {\n")
+	for _, p := range pairs {
+		fmt.Fprintf(&sb, "  [fill=\"%s\"] { fill: %s; }\n", p[0], p[1])
+		fmt.Fprintf(&sb, "  [stroke=\"%s\"] { stroke: %s; }\n", p[0], p[1])
+	}
+	sb.WriteString("}\n</style>")
+
+	return svg[:end] + sb.String() + svg[end:]
+}
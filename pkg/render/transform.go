@@ -0,0 +1,55 @@
+package render
+
+import (
+	"slices"
+
+	"github.com/siggy/gographs/pkg/dot"
+)
+
+// applyOptions rewrites a DOT graph for the options that Graphviz command-line
+// flags cannot express. goda sets rankdir in the graph itself, which takes
+// precedence over -Grankdir, so the rank direction is set on the graph. Themes
+// are applied here too, before layout, so every renderer draws them, along
+// with filters, which need the repo to resolve package paths, and transitive
+// reduction.
+func applyOptions(src string, repo string, opts Options) (string, error) {
+	if opts.RankDir == "" && opts.Theme == "" && !opts.filtered() && !opts.Reduce {
+		return src, nil
+	}
+
+	g, err := dot.Parse(src)
+	if err != nil {
+		return "", err
+	}
+	if opts.filtered() {
+		filterGraph(g, repo, opts)
+	}
+	if opts.Reduce {
+		reduce(g, opts.Format)
+	}
+	if opts.RankDir != "" {
+		g.Attrs["rankdir"] = opts.RankDir
+	}
+	if opts.Theme != "" {
+		applyTheme(g, opts.Theme)
+	}
+	return g.String(), nil
+}
+
+// reduce removes the edges implied by longer paths. JSON output keeps the full
+// edge set for tooling, marking the implied edges instead.
+func reduce(g *dot.Graph, format Format) {
+	implied := g.ImpliedEdges()
+	if format == JSON {
+		for _, e := range implied {
+			e.Attrs[dot.ImpliedAttr] = "true"
+		}
+		return
+	}
+
+	remove := make(map[*dot.Edge]bool, len(implied))
+	for _, e := range implied {
+		remove[e] = true
+	}
+	g.Edges = slices.DeleteFunc(g.Edges, func(e *dot.Edge) bool { return remove[e] })
+}
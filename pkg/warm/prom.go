@@ -0,0 +1,19 @@
+package warm
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	success   = "success"
+	failure   = "failure"
+	unchanged = "unchanged"
+)
+
+var rebuilds = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gographs",
+	Subsystem: "warmer",
+	Name:      "repos_total",
+	Help:      "Count of popular repos checked by the cache warmer, by result: success, failure or unchanged.",
+}, []string{"result"})
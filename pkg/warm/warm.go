@@ -0,0 +1,139 @@
+package warm
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/siggy/gographs/pkg/cache"
+	"github.com/siggy/gographs/pkg/graph"
+	"github.com/siggy/gographs/pkg/render"
+	log "github.com/sirupsen/logrus"
+)
+
+// Config sets how often, and how much, the warmer rebuilds.
+type Config struct {
+	// Interval is how often the most popular repos are checked. Zero disables
+	// the warmer.
+	Interval time.Duration
+	// Repos is how many of the most popular repos are checked.
+	Repos int
+	// Delay is the minimum time between rebuilds, to limit load on the graph
+	// server.
+	Delay time.Duration
+}
+
+// Defaults for Config.
+const (
+	DefaultInterval = time.Hour
+	DefaultRepos    = 10
+	DefaultDelay    = 10 * time.Second
+)
+
+const (
+	// lockName is held by the instance warming the current round, so replicas
+	// sharing a cache don't duplicate work.
+	lockName = "warmer"
+
+	// commitFormat caches the commit each repo was last warmed at.
+	commitFormat = "commit"
+)
+
+// Start checks the most popular repos every interval, with jitter, and
+// rebuilds the DOT and SVG graphs, clustered and not, of those whose upstream
+// commit changed. It blocks forever, or returns at once if cfg.Interval is zero.
+func Start(c *cache.Cache, graph *graph.Client, renderer render.Renderer, cfg Config) {
+	if cfg.Interval <= 0 {
+		return
+	}
+
+	log := log.WithFields(
+		log.Fields{
+			"warmer": cfg.Interval,
+		},
+	)
+
+	if cfg.Repos < 1 || cfg.Repos > cache.MaxScores {
+		log.Errorf("Cache warmer disabled, repos must be between 1 and %d: %d", cache.MaxScores, cfg.Repos)
+		return
+	}
+
+	log.Infof("Cache warmer checking the top %d repos every %s", cfg.Repos, cfg.Interval)
+
+	for {
+		time.Sleep(jitter(cfg.Interval))
+
+		// Hold the lock for most of the interval, so each round runs on one
+		// replica even as their jittered schedules drift.
+		ok, err := c.Lock(lockName, cfg.Interval*4/5)
+		if err != nil {
+			log.Errorf("Failed to take warmer lock: %s", err)
+			continue
+		}
+		if !ok {
+			log.Debugf("Warmer lock held elsewhere, skipping")
+			continue
+		}
+
+		warm(c, graph, renderer, cfg, log)
+	}
+}
+
+// warm runs one round of the warmer.
+func warm(c *cache.Cache, graph *graph.Client, renderer render.Renderer, cfg Config, log *log.Entry) {
+	repos, err := c.RepoScores(cache.ScoreWindows[cache.DefaultScoreWindow], cfg.Repos)
+	if err != nil {
+		log.Errorf("Failed to get top repos: %s", err)
+		return
+	}
+
+	for _, repo := range repos {
+		commit, err := graph.Commit(repo)
+		if err != nil {
+			log.Errorf("Failed to resolve commit for %s: %s", repo, err)
+			rebuilds.WithLabelValues(failure).Inc()
+			continue
+		}
+		if entry, err := c.Get(commitFormat, repo, ""); err == nil {
+			if prev, _ := entry.Value(); prev == commit {
+				log.Debugf("%s unchanged at %s", repo, commit)
+				rebuilds.WithLabelValues(unchanged).Inc()
+				continue
+			}
+		}
+
+		log.Infof("Warming %s at %s", repo, commit)
+		if err := Rebuild(c, graph, renderer, repo); err != nil {
+			log.Errorf("Failed to warm %s: %s", repo, err)
+			rebuilds.WithLabelValues(failure).Inc()
+		} else {
+			c.Set(commitFormat, repo, "", commit)
+			rebuilds.WithLabelValues(success).Inc()
+		}
+
+		time.Sleep(cfg.Delay)
+	}
+}
+
+// Rebuild rebuilds and caches the DOT and SVG graphs of a repo, clustered and
+// not.
+func Rebuild(c *cache.Cache, graph *graph.Client, renderer render.Renderer, repo string) error {
+	for _, cluster := range []bool{false, true} {
+		opts := render.Options{Cluster: cluster, Format: render.SVG}
+		if err := opts.Validate(); err != nil {
+			return err
+		}
+		if err := render.Warm(graph, c, renderer, repo, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jitter returns d, give or take up to a tenth.
+func jitter(d time.Duration) time.Duration {
+	spread := int64(d / 5)
+	if spread <= 0 {
+		return d
+	}
+	return d - d/10 + time.Duration(rand.Int64N(spread))
+}
@@ -0,0 +1,256 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/siggy/gographs/pkg/graph"
+	"github.com/siggy/gographs/pkg/prom"
+	"github.com/siggy/gographs/pkg/render"
+	log "github.com/sirupsen/logrus"
+)
+
+// apiPrefix is the base path of the versioned JSON API.
+const apiPrefix = "/api/v1"
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID matches client-supplied request IDs that are echoed back.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// apiError is the body of every API error response.
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	// Code is a machine-readable form of the HTTP status, e.g. "not_found".
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId"`
+}
+
+// apiGraph is a rendered graph.
+type apiGraph struct {
+	Repo        string `json:"repo"`
+	Format      string `json:"format"`
+	ContentType string `json:"contentType"`
+	// URL links directly to the rendered graph.
+	URL string `json:"url"`
+	// Age and MaxAge are in seconds, as in the Age and Cache-Control headers.
+	Age    int  `json:"age"`
+	MaxAge int  `json:"maxAge"`
+	Stale  bool `json:"stale"`
+	// Content holds text formats. Binary formats are fetched from URL.
+	Content string `json:"content,omitempty"`
+}
+
+// apiRepo is a Go repo and links to its graphs.
+type apiRepo struct {
+	Repo   string `json:"repo"`
+	Commit string `json:"commit"`
+	// Graphs links to the repo's graph in each format.
+	Graphs map[string]string `json:"graphs"`
+}
+
+// apiPopularity lists the most viewed repos over a window.
+type apiPopularity struct {
+	Window string           `json:"window"`
+	Repos  []apiPopularRepo `json:"repos"`
+}
+
+type apiPopularRepo struct {
+	Repo string `json:"repo"`
+	URL  string `json:"url"`
+}
+
+// registerAPI adds the /api/v1 routes to router. It must be called before any
+// catch-all routes.
+func registerAPI(router *mux.Router, core *core) {
+	api := router.PathPrefix(apiPrefix).Subrouter()
+	api.Use(requestIDMiddleware)
+
+	api.HandleFunc("/openapi.json", openAPIHandler).Methods(http.MethodGet)
+	api.HandleFunc("/graphs/{repo:.+}", mkAPIGraphHandler(core)).Methods(http.MethodGet)
+	api.HandleFunc("/repos/{repo:.+}", mkAPIRepoHandler(core.graph, core.limiter, core.access)).Methods(http.MethodGet)
+	api.HandleFunc("/jobs", mkAPICreateJobHandler(core)).Methods(http.MethodPost)
+	api.HandleFunc("/jobs/{id}", mkAPIJobHandler(core.cache)).Methods(http.MethodGet)
+	api.HandleFunc("/popularity", mkAPIPopularityHandler(core)).Methods(http.MethodGet)
+	if core.access.enabled() {
+		api.HandleFunc("/keys", mkAPIKeysHandler(core.access)).Methods(http.MethodGet)
+		api.HandleFunc("/keys", mkAPICreateKeyHandler(core.access, core.log)).Methods(http.MethodPost)
+		api.HandleFunc("/keys/{id}", mkAPIDeleteKeyHandler(core.access, core.log)).Methods(http.MethodDelete)
+	}
+
+	api.NotFoundHandler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		writeAPIError(rw, r, http.StatusNotFound, "No such API resource", nil)
+	})
+	api.MethodNotAllowedHandler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		writeAPIError(rw, r, http.StatusMethodNotAllowed, "Method not allowed", nil)
+	})
+}
+
+func mkAPIGraphHandler(core *core) http.HandlerFunc {
+	// GET /api/v1/graphs/github.com/siggy/gographs
+	// GET /api/v1/graphs/github.com/siggy/gographs?format=dot&cluster=true
+	return func(rw http.ResponseWriter, r *http.Request) {
+		vars := r.URL.Query()
+
+		format := render.SVG
+		if f := vars.Get("format"); f != "" {
+			var err error
+			format, err = render.ParseFormat(f)
+			if err != nil {
+				writeAPIError(rw, r, http.StatusBadRequest, err.Error(), err)
+				return
+			}
+		}
+
+		g, rerr := core.renderGraph(rw, r, mux.Vars(r)["repo"], format, vars, false)
+		if rerr != nil {
+			writeAPIError(rw, r, rerr.status, rerr.message, rerr.err)
+			return
+		}
+
+		direct := url.Values{}
+		for k, v := range vars {
+			if k != "format" {
+				direct[k] = v
+			}
+		}
+		resp := apiGraph{
+			Repo:        g.repo,
+			Format:      string(format),
+			ContentType: format.ContentType(),
+			URL:         graphURL(g.repo, format, direct),
+			Age:         int(g.entry.Age.Seconds()),
+			MaxAge:      int(g.entry.MaxAge.Seconds()),
+			Stale:       g.entry.Stale,
+		}
+		if !format.Binary() {
+			var err error
+			resp.Content, err = g.entry.Value()
+			if err != nil {
+				writeAPIError(rw, r, http.StatusInternalServerError, fmt.Sprintf("Failed to read cached %s graph", g.repo), err)
+				return
+			}
+		}
+
+		setCacheHeaders(rw, g.entry, core.cache.StaleTTL(), core.access.privateResponse(r, g.repo))
+		writeJSON(rw, http.StatusOK, resp)
+	}
+}
+
+func mkAPIRepoHandler(graph *graph.Client, limiter *limiter, access Access) http.HandlerFunc {
+	// GET /api/v1/repos/github.com/siggy/gographs
+	return func(rw http.ResponseWriter, r *http.Request) {
+		repo, err := normalizeRepo(mux.Vars(r)["repo"])
+		if err != nil {
+			writeAPIError(rw, r, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		if rerr := access.repo(r, repo); rerr != nil {
+			writeAPIError(rw, r, rerr.status, rerr.message, rerr.err)
+			return
+		}
+		if rerr := limiter.read(rw, r); rerr != nil {
+			writeAPIError(rw, r, rerr.status, rerr.message, rerr.err)
+			return
+		}
+
+		commit, err := graph.Commit(repo)
+		if err != nil {
+			writeAPIError(rw, r, http.StatusBadGateway, fmt.Sprintf("Failed to resolve commit for %s", repo), err)
+			return
+		}
+
+		resp := apiRepo{Repo: repo, Commit: commit, Graphs: map[string]string{}}
+		for _, f := range render.Formats {
+			resp.Graphs[string(f)] = apiPrefix + "/graphs/" + repo + "?format=" + string(f)
+		}
+		writeJSON(rw, http.StatusOK, resp)
+	}
+}
+
+func mkAPIPopularityHandler(core *core) http.HandlerFunc {
+	// GET /api/v1/popularity?window=24h|7d|all&limit=N
+	return func(rw http.ResponseWriter, r *http.Request) {
+		window, repos, rerr := core.topRepos(r.URL.Query())
+		if rerr != nil {
+			writeAPIError(rw, r, rerr.status, rerr.message, rerr.err)
+			return
+		}
+
+		resp := apiPopularity{Window: window, Repos: make([]apiPopularRepo, len(repos))}
+		for i, repo := range repos {
+			resp.Repos[i] = apiPopularRepo{Repo: repo, URL: apiPrefix + "/repos/" + repo}
+		}
+		writeJSON(rw, http.StatusOK, resp)
+	}
+}
+
+// graphURL returns the direct link to a rendered graph.
+func graphURL(repo string, format render.Format, vars url.Values) string {
+	u := "/graph/" + repo + "." + string(format)
+	if len(vars) > 0 {
+		u += "?" + vars.Encode()
+	}
+	return u
+}
+
+// writeJSON writes v as a JSON response body.
+func writeJSON(rw http.ResponseWriter, status int, v any) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(v)
+}
+
+// writeAPIError handles all errors returned by the API. Like writeError, it
+// counts the error in metrics and logs it, but writes a JSON body.
+func writeAPIError(rw http.ResponseWriter, r *http.Request, status int, message string, err error) {
+	id := requestID(rw, r)
+	writeJSON(rw, status, apiError{apiErrorDetail{
+		Code:      strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_")),
+		Message:   message,
+		RequestID: id,
+	}})
+
+	path := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		path, _ = route.GetPathTemplate()
+	}
+
+	log.Errorf("Failed request for [%s]: [%d] Message: [%s] Error: [%s] Request ID: [%s]", path, status, message, err, id)
+	prom.CountError(webServer, r, status, message, err)
+}
+
+// requestIDMiddleware tags each API response with a request ID.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requestID(rw, r)
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// requestID returns the response's request ID, setting it if needed: the
+// client's X-Request-ID if valid, or a new random ID.
+func requestID(rw http.ResponseWriter, r *http.Request) string {
+	if id := rw.Header().Get(requestIDHeader); id != "" {
+		return id
+	}
+	id := r.Header.Get(requestIDHeader)
+	if !validRequestID.MatchString(id) {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	rw.Header().Set(requestIDHeader, id)
+	return id
+}
@@ -0,0 +1,167 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/siggy/gographs/pkg/auth"
+	"github.com/siggy/gographs/pkg/cache"
+	"github.com/siggy/gographs/pkg/render"
+	log "github.com/sirupsen/logrus"
+)
+
+// Access restricts requests to holders of API keys. With no Keys, every
+// request is allowed.
+type Access struct {
+	Keys *auth.Authenticator
+	// PrivateRepos are repo prefixes, e.g. "git.example.com/", whose graphs
+	// require the private-repos scope. They are not counted in popularity.
+	PrivateRepos []string
+}
+
+// enabled reports whether requests must be authenticated for anything beyond
+// cached public graphs.
+func (a Access) enabled() bool {
+	return a.Keys != nil
+}
+
+// private reports whether repo matches one of the PrivateRepos prefixes, in
+// any spelling. Repos that cannot be normalized are private, to fail closed.
+func (a Access) private(repo string) bool {
+	repo, err := normalizeRepo(repo)
+	if err != nil {
+		return true
+	}
+	for _, prefix := range a.PrivateRepos {
+		if strings.HasPrefix(repo, normalizePrefix(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// privateResponse reports whether the response to r for repo's graph must not
+// be kept by shared caches: the repo is private, or a key authenticated r.
+func (a Access) privateResponse(r *http.Request, repo string) bool {
+	return a.private(repo) || auth.FromContext(r.Context()) != nil
+}
+
+// Reasons requests are refused, as counted in metrics.
+const (
+	invalidKey   = "invalid_key"
+	missingScope = "missing_scope"
+)
+
+// anonymous labels metrics for requests without an API key.
+const anonymous = "anonymous"
+
+// authMiddleware authenticates requests bearing an API key, in the
+// Authorization header or X-API-Key, and records the key in the request's
+// context. Requests without a key proceed anonymously.
+func authMiddleware(access Access, log *log.Entry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			token := apiToken(r)
+			if token == "" {
+				keyRequests.WithLabelValues(anonymous).Inc()
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			key, err := access.Keys.Authenticate(token)
+			if errors.Is(err, auth.ErrInvalidKey) {
+				authFailures.WithLabelValues(invalidKey).Inc()
+				rw.Header().Set("WWW-Authenticate", `Bearer realm="gographs"`)
+				writeAuthError(rw, r, &requestError{http.StatusUnauthorized, "Invalid API key", err})
+				return
+			}
+			if err != nil {
+				writeAuthError(rw, r, &requestError{http.StatusInternalServerError, "Failed to check API key", err})
+				return
+			}
+
+			keyRequests.WithLabelValues(key.ID).Inc()
+			log.Debugf("Authenticated %s as key %s (%s)", r.URL.Path, key.ID, key.Name)
+			next.ServeHTTP(rw, r.WithContext(auth.WithKey(r.Context(), key)))
+		})
+	}
+}
+
+// apiToken returns a request's API token, if any.
+func apiToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// writeAuthError writes an error as JSON for the API, or as text for the
+// legacy endpoints.
+func writeAuthError(rw http.ResponseWriter, r *http.Request, rerr *requestError) {
+	if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+		writeAPIError(rw, r, rerr.status, rerr.message, rerr.err)
+		return
+	}
+	writeError(rw, r, rerr.status, rerr.message, rerr.err)
+}
+
+// require returns an error unless r's key grants scope.
+func (a Access) require(r *http.Request, scope auth.Scope) *requestError {
+	if !a.enabled() {
+		return nil
+	}
+	key := auth.FromContext(r.Context())
+	if key.Has(scope) {
+		return nil
+	}
+
+	authFailures.WithLabelValues(missingScope).Inc()
+	message := fmt.Sprintf("An API key with the %s scope is required", scope)
+	if key == nil {
+		return &requestError{http.StatusUnauthorized, message, nil}
+	}
+	return &requestError{http.StatusForbidden, message, nil}
+}
+
+// graph returns an error unless r may read repo's graph: anyone may read
+// cached graphs of public repos, but building one requires the read scope,
+// refreshing one the refresh scope, and private repos the private-repos scope.
+func (a Access) graph(r *http.Request, c *cache.Cache, repo string, opts render.Options, refresh bool) *requestError {
+	if !a.enabled() {
+		return nil
+	}
+	if refresh {
+		return a.refresh(r, repo)
+	}
+	if a.private(repo) {
+		if rerr := a.require(r, auth.PrivateRepos); rerr != nil {
+			return rerr
+		}
+	}
+	if render.Cached(c, repo, opts) {
+		return nil
+	}
+	return a.require(r, auth.Read)
+}
+
+// repo returns an error unless r may look up repo upstream.
+func (a Access) repo(r *http.Request, repo string) *requestError {
+	if a.private(repo) {
+		if rerr := a.require(r, auth.PrivateRepos); rerr != nil {
+			return rerr
+		}
+	}
+	return a.require(r, auth.Read)
+}
+
+// refresh returns an error unless r may refresh repo's graphs.
+func (a Access) refresh(r *http.Request, repo string) *requestError {
+	if a.private(repo) {
+		if rerr := a.require(r, auth.PrivateRepos); rerr != nil {
+			return rerr
+		}
+	}
+	return a.require(r, auth.Refresh)
+}
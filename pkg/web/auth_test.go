@@ -0,0 +1,195 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/siggy/gographs/pkg/auth"
+	"github.com/siggy/gographs/pkg/cache"
+	"github.com/siggy/gographs/pkg/render"
+)
+
+// privateVariants spell one private repo every way a client might.
+var privateVariants = []string{
+	"git.example.com/team/app",
+	"GIT.example.com/team/app",
+	"Git.Example.Com/team/app",
+	"https://git.example.com/team/app",
+	"https:/git.example.com/team/app",
+	"HTTP://git.example.com/team/app",
+	"ssh://git.example.com/team/app.git",
+	"git.example.com/team/app/",
+	"git.example.com//team/./app",
+	" git.example.com/team/app",
+}
+
+func testAccess(t *testing.T) Access {
+	t.Helper()
+	store, err := auth.NewFile(filepath.Join(t.TempDir(), "keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Access{
+		Keys:         auth.New(store, ""),
+		PrivateRepos: []string{"Git.Example.com/team/"},
+	}
+}
+
+// keyRequest returns a request authenticated by a key with scopes, or an
+// anonymous one for no scopes.
+func keyRequest(scopes ...auth.Scope) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if len(scopes) == 0 {
+		return r
+	}
+	return r.WithContext(auth.WithKey(r.Context(), &auth.Key{ID: "k1", Scopes: scopes}))
+}
+
+func TestNormalizeRepo(t *testing.T) {
+	for _, repo := range privateVariants {
+		got, err := normalizeRepo(repo)
+		if err != nil {
+			t.Errorf("normalizeRepo(%q): %s", repo, err)
+			continue
+		}
+		if got != "git.example.com/team/app" {
+			t.Errorf("normalizeRepo(%q) = %q, want git.example.com/team/app", repo, got)
+		}
+	}
+
+	for repo, want := range map[string]string{
+		"github.com/siggy/gographs":              "github.com/siggy/gographs",
+		"github.com/Siggy/GoGraphs":              "github.com/Siggy/GoGraphs",
+		"golang.org/x/net/html":                  "golang.org/x/net/html",
+		"git.example.com:8443/team/app":          "git.example.com:8443/team/app",
+		"github.com/siggy/gographs/../../evil/x": "github.com/evil/x",
+	} {
+		if got, err := normalizeRepo(repo); err != nil || got != want {
+			t.Errorf("normalizeRepo(%q) = %q, %v, want %q", repo, got, err, want)
+		}
+	}
+
+	for _, repo := range []string{"", "github.com", "github.com/", "https://", "user@git.example.com/team/app", "github.com/a b", "/siggy/gographs"} {
+		if got, err := normalizeRepo(repo); err == nil {
+			t.Errorf("normalizeRepo(%q) = %q, want an error", repo, got)
+		}
+	}
+}
+
+func TestAccessPrivate(t *testing.T) {
+	access := testAccess(t)
+	for _, repo := range privateVariants {
+		if !access.private(repo) {
+			t.Errorf("private(%q) = false", repo)
+		}
+	}
+	for _, repo := range []string{"github.com/siggy/gographs", "git.example.com/other/app", "git.example.community/team/app"} {
+		if access.private(repo) {
+			t.Errorf("private(%q) = true", repo)
+		}
+	}
+	if !access.private("user@git.example.com/team/app") {
+		t.Error("invalid repos must be private")
+	}
+}
+
+func TestAccessRequire(t *testing.T) {
+	access := testAccess(t)
+	testCases := []struct {
+		name   string
+		r      *http.Request
+		scope  auth.Scope
+		status int
+	}{
+		{"anonymous", keyRequest(), auth.Read, http.StatusUnauthorized},
+		{"scoped", keyRequest(auth.Read), auth.Read, 0},
+		{"other scope", keyRequest(auth.Read), auth.Refresh, http.StatusForbidden},
+		{"admin implies read", keyRequest(auth.Admin), auth.Read, 0},
+		{"admin implies private repos", keyRequest(auth.Admin), auth.PrivateRepos, 0},
+		{"private repos does not imply admin", keyRequest(auth.PrivateRepos), auth.Admin, http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertStatus(t, access.require(tc.r, tc.scope), tc.status)
+		})
+	}
+
+	if rerr := (Access{}).require(keyRequest(), auth.Admin); rerr != nil {
+		t.Errorf("disabled access required a key: %+v", rerr)
+	}
+}
+
+func TestAccessGraph(t *testing.T) {
+	access := testAccess(t)
+	store, err := cache.NewMemory(cache.DefaultMemoryEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cache.New(store, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := render.Options{Format: render.SVG}
+	c.Set("svg", "github.com/siggy/cached", "false", "<svg/>")
+	c.Set("svg", "git.example.com/team/app", "false", "<svg/>")
+
+	type testCase struct {
+		name    string
+		r       *http.Request
+		repo    string
+		refresh bool
+		status  int
+	}
+	testCases := []testCase{
+		{"cached public", keyRequest(), "github.com/siggy/cached", false, 0},
+		{"uncached public", keyRequest(), "github.com/siggy/gographs", false, http.StatusUnauthorized},
+		{"uncached public with read", keyRequest(auth.Read), "github.com/siggy/gographs", false, 0},
+		{"refresh without scope", keyRequest(auth.Read), "github.com/siggy/cached", true, http.StatusForbidden},
+		{"refresh", keyRequest(auth.Refresh), "github.com/siggy/cached", true, 0},
+		{"cached private", keyRequest(auth.PrivateRepos), "git.example.com/team/app", false, 0},
+	}
+	for _, repo := range privateVariants {
+		testCases = append(testCases,
+			testCase{"cached private " + repo, keyRequest(), repo, false, http.StatusUnauthorized},
+			testCase{"private with read " + repo, keyRequest(auth.Read), repo, false, http.StatusForbidden},
+			testCase{"private " + repo, keyRequest(auth.Read, auth.PrivateRepos), repo, false, 0},
+			testCase{"refresh private without scope " + repo, keyRequest(auth.Refresh), repo, true, http.StatusForbidden},
+			testCase{"refresh private " + repo, keyRequest(auth.Refresh, auth.PrivateRepos), repo, true, 0},
+		)
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertStatus(t, access.graph(tc.r, c, tc.repo, opts, tc.refresh), tc.status)
+		})
+	}
+}
+
+func TestAccessRefresh(t *testing.T) {
+	access := testAccess(t)
+	for _, repo := range append(privateVariants, "github.com/siggy/gographs") {
+		assertStatus(t, access.refresh(keyRequest(), repo), http.StatusUnauthorized)
+		assertStatus(t, access.refresh(keyRequest(auth.Read), repo), http.StatusForbidden)
+	}
+	for _, repo := range privateVariants {
+		assertStatus(t, access.refresh(keyRequest(auth.Refresh), repo), http.StatusForbidden)
+		assertStatus(t, access.refresh(keyRequest(auth.Refresh, auth.PrivateRepos), repo), 0)
+		assertStatus(t, access.refresh(keyRequest(auth.Admin), repo), 0)
+	}
+	assertStatus(t, access.refresh(keyRequest(auth.Refresh), "github.com/siggy/gographs"), 0)
+}
+
+// assertStatus checks that rerr has status, or is nil for status 0.
+func assertStatus(t *testing.T, rerr *requestError, status int) {
+	t.Helper()
+	switch {
+	case status == 0 && rerr != nil:
+		t.Errorf("got %d %s, want no error", rerr.status, rerr.message)
+	case status != 0 && rerr == nil:
+		t.Errorf("got no error, want %d", status)
+	case status != 0 && rerr.status != status:
+		t.Errorf("got %d %s, want %d", rerr.status, rerr.message, status)
+	}
+}
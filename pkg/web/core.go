@@ -0,0 +1,120 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/siggy/gographs/pkg/cache"
+	"github.com/siggy/gographs/pkg/graph"
+	"github.com/siggy/gographs/pkg/render"
+	log "github.com/sirupsen/logrus"
+)
+
+// core serves graphs, refreshes and popularity for both the /api/v1 routes
+// and the legacy /graph and /top-repos ones. Their handlers are thin wrappers
+// over it, differing only in URL shape and error encoding, so they can't
+// drift apart in how they check access, limit, refresh and render.
+type core struct {
+	graph    *graph.Client
+	cache    *cache.Cache
+	renderer render.Renderer
+	limiter  *limiter
+	access   Access
+	log      *log.Entry
+}
+
+// renderedGraph is a repo's graph, rendered for a request.
+type renderedGraph struct {
+	// repo is normalized.
+	repo  string
+	opts  render.Options
+	entry cache.Entry
+}
+
+// renderGraph renders repo's graph in format, with options from vars. It
+// checks access, then rate limits, so unauthorized requests don't use up
+// limits, clears the repo's cache first for refreshes, and counts views of
+// public repos towards their popularity.
+func (c *core) renderGraph(rw http.ResponseWriter, r *http.Request, repo string, format render.Format, vars url.Values, refresh bool) (renderedGraph, *requestError) {
+	repo, err := normalizeRepo(repo)
+	if err != nil {
+		return renderedGraph{}, &requestError{http.StatusBadRequest, err.Error(), err}
+	}
+	opts, err := parseOptions(vars, format)
+	if err != nil {
+		return renderedGraph{}, &requestError{http.StatusBadRequest, err.Error(), err}
+	}
+
+	rerr := c.access.graph(r, c.cache, repo, opts, refresh)
+	if rerr == nil {
+		rerr = c.limiter.graph(rw, r, repo, opts, refresh)
+	}
+	if rerr != nil {
+		return renderedGraph{}, rerr
+	}
+
+	if refresh {
+		c.log.Debugf("Clearing cache for %s", repo)
+		if err := c.cache.Clear(repo); err != nil {
+			c.log.Errorf("Failed to clear cache for repo %s: %s", repo, err)
+		}
+	}
+
+	c.log.Debugf("Processing %s", repo)
+
+	entry, err := render.Render(c.graph, c.cache, c.renderer, repo, opts)
+	if errors.Is(err, render.ErrUnsupportedFormat) {
+		message := fmt.Sprintf("Rendering to %s is not supported by this server", opts.Format)
+		return renderedGraph{}, &requestError{http.StatusNotImplemented, message, err}
+	}
+	if errors.Is(err, render.ErrUnsupportedEngine) {
+		message := fmt.Sprintf("The %s engine is not supported by this server", opts.Engine)
+		return renderedGraph{}, &requestError{http.StatusNotImplemented, message, err}
+	}
+	if err != nil {
+		message := fmt.Sprintf("Failed to render %s to %s", repo, opts.Format)
+		return renderedGraph{}, &requestError{http.StatusInternalServerError, message, err}
+	}
+
+	if !c.access.private(repo) {
+		go c.cache.RepoScoreIncr(repo, clientAddr(r))
+	}
+
+	return renderedGraph{repo, opts, entry}, nil
+}
+
+// refresh checks that r may refresh repo, returning the normalized repo. As
+// for graphs, access is checked before rate limits.
+func (c *core) refresh(rw http.ResponseWriter, r *http.Request, repo string) (string, *requestError) {
+	if repo == "" {
+		err := errors.New("repo required")
+		return "", &requestError{http.StatusBadRequest, err.Error(), err}
+	}
+	repo, err := normalizeRepo(repo)
+	if err != nil {
+		return "", &requestError{http.StatusBadRequest, err.Error(), err}
+	}
+
+	rerr := c.access.refresh(r, repo)
+	if rerr == nil {
+		rerr = c.limiter.refresh(rw, r, repo)
+	}
+	return repo, rerr
+}
+
+// topRepos returns the name of the requested window, and the most popular
+// repos over it.
+func (c *core) topRepos(vars url.Values) (string, []string, *requestError) {
+	name, window, limit, err := parseTopRepos(vars)
+	if err != nil {
+		return "", nil, &requestError{http.StatusBadRequest, err.Error(), err}
+	}
+
+	scores, err := c.cache.RepoScores(window, limit)
+	if err != nil {
+		return "", nil, &requestError{http.StatusInternalServerError, "Failed to get top repos", err}
+	}
+	return name, scores, nil
+}
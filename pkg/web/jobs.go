@@ -0,0 +1,129 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/siggy/gographs/pkg/cache"
+	"github.com/siggy/gographs/pkg/graph"
+	"github.com/siggy/gographs/pkg/render"
+	"github.com/siggy/gographs/pkg/warm"
+	log "github.com/sirupsen/logrus"
+)
+
+// apiJob is a background refresh of a repo's graphs. Jobs are kept in the
+// cache, so any replica sharing it can report their status.
+type apiJob struct {
+	ID      string    `json:"id"`
+	Repo    string    `json:"repo"`
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// Job statuses.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// apiJobRequest is the body of POST /api/v1/jobs.
+type apiJobRequest struct {
+	Repo string `json:"repo"`
+}
+
+func mkAPICreateJobHandler(core *core) http.HandlerFunc {
+	// curl --data '{"repo":"github.com/siggy/gographs"}' -X POST /api/v1/jobs
+	return func(rw http.ResponseWriter, r *http.Request) {
+		var req apiJobRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(rw, r, http.StatusBadRequest, "Failed to decode job", err)
+			return
+		}
+		repo, rerr := core.refresh(rw, r, req.Repo)
+		if rerr != nil {
+			writeAPIError(rw, r, rerr.status, rerr.message, rerr.err)
+			return
+		}
+
+		b := make([]byte, 16)
+		rand.Read(b)
+		now := time.Now().UTC()
+		job := apiJob{
+			ID:      hex.EncodeToString(b),
+			Repo:    repo,
+			Status:  jobQueued,
+			Created: now,
+			Updated: now,
+		}
+		saveJob(core.cache, job)
+
+		go runJob(core.graph, core.cache, core.renderer, job, core.log)
+
+		rw.Header().Set("Location", apiPrefix+"/jobs/"+job.ID)
+		writeJSON(rw, http.StatusAccepted, job)
+	}
+}
+
+func mkAPIJobHandler(c *cache.Cache) http.HandlerFunc {
+	// GET /api/v1/jobs/[id]
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		value, err := c.Job(id)
+		if errors.Is(err, cache.ErrMiss) {
+			writeAPIError(rw, r, http.StatusNotFound, "No such job", err)
+			return
+		}
+		if err != nil {
+			writeAPIError(rw, r, http.StatusInternalServerError, "Failed to get job", err)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(value))
+	}
+}
+
+// runJob clears a repo's cached graphs and rebuilds them, recording progress
+// in the job.
+func runJob(graph *graph.Client, c *cache.Cache, renderer render.Renderer, job apiJob, log *log.Entry) {
+	job.Status = jobRunning
+	job.Updated = time.Now().UTC()
+	saveJob(c, job)
+
+	err := c.Clear(job.Repo)
+	if err == nil {
+		err = warm.Rebuild(c, graph, renderer, job.Repo)
+	}
+
+	job.Status = jobSucceeded
+	if err != nil {
+		log.Errorf("Job %s for %s failed: %s", job.ID, job.Repo, err)
+		job.Status = jobFailed
+		job.Error = fmt.Sprintf("Failed to rebuild %s", job.Repo)
+	}
+	job.Updated = time.Now().UTC()
+	saveJob(c, job)
+}
+
+func saveJob(c *cache.Cache, job apiJob) {
+	b, err := json.Marshal(job)
+	if err != nil {
+		log.Errorf("Failed to encode job %s: %s", job.ID, err)
+		return
+	}
+	if err := c.SetJob(job.ID, string(b)+"\n"); err != nil {
+		log.Errorf("Failed to save job %s: %s", job.ID, err)
+	}
+}
@@ -0,0 +1,115 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/siggy/gographs/pkg/auth"
+	log "github.com/sirupsen/logrus"
+)
+
+// apiKey is an API key, without its hash.
+type apiKey struct {
+	ID      string       `json:"id"`
+	Name    string       `json:"name"`
+	Scopes  []auth.Scope `json:"scopes"`
+	Created time.Time    `json:"created"`
+	// Token is only returned when the key is created.
+	Token string `json:"token,omitempty"`
+}
+
+// apiKeyRequest is the body of POST /api/v1/keys.
+type apiKeyRequest struct {
+	Name   string       `json:"name"`
+	Scopes []auth.Scope `json:"scopes"`
+}
+
+func toAPIKey(key *auth.Key) apiKey {
+	return apiKey{ID: key.ID, Name: key.Name, Scopes: key.Scopes, Created: key.Created}
+}
+
+func mkAPIKeysHandler(access Access) http.HandlerFunc {
+	// GET /api/v1/keys
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if rerr := access.require(r, auth.Admin); rerr != nil {
+			writeAPIError(rw, r, rerr.status, rerr.message, rerr.err)
+			return
+		}
+
+		keys, err := access.Keys.Store().List()
+		if err != nil {
+			writeAPIError(rw, r, http.StatusInternalServerError, "Failed to list API keys", err)
+			return
+		}
+
+		resp := make([]apiKey, len(keys))
+		for i, key := range keys {
+			resp[i] = toAPIKey(key)
+		}
+		writeJSON(rw, http.StatusOK, resp)
+	}
+}
+
+func mkAPICreateKeyHandler(access Access, log *log.Entry) http.HandlerFunc {
+	// curl --data '{"name":"ci","scopes":["read","refresh"]}' -X POST /api/v1/keys
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if rerr := access.require(r, auth.Admin); rerr != nil {
+			writeAPIError(rw, r, rerr.status, rerr.message, rerr.err)
+			return
+		}
+
+		var req apiKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(rw, r, http.StatusBadRequest, "Failed to decode API key", err)
+			return
+		}
+		if req.Name == "" {
+			err := errors.New("name required")
+			writeAPIError(rw, r, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+
+		key, token, err := auth.NewKey(req.Name, req.Scopes)
+		if err != nil {
+			writeAPIError(rw, r, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		if err := access.Keys.Store().Put(key); err != nil {
+			writeAPIError(rw, r, http.StatusInternalServerError, "Failed to save API key", err)
+			return
+		}
+		log.Infof("Created API key %s (%s) with scopes %v", key.ID, key.Name, key.Scopes)
+
+		resp := toAPIKey(key)
+		resp.Token = token
+		rw.Header().Set("Location", apiPrefix+"/keys/"+key.ID)
+		writeJSON(rw, http.StatusCreated, resp)
+	}
+}
+
+func mkAPIDeleteKeyHandler(access Access, log *log.Entry) http.HandlerFunc {
+	// DELETE /api/v1/keys/[id]
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if rerr := access.require(r, auth.Admin); rerr != nil {
+			writeAPIError(rw, r, rerr.status, rerr.message, rerr.err)
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+		err := access.Keys.Store().Delete(id)
+		if errors.Is(err, auth.ErrNotFound) {
+			writeAPIError(rw, r, http.StatusNotFound, "No such API key", err)
+			return
+		}
+		if err != nil {
+			writeAPIError(rw, r, http.StatusInternalServerError, "Failed to revoke API key", err)
+			return
+		}
+		log.Infof("Revoked API key %s", id)
+
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/siggy/gographs/pkg/auth"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestAPIKeyRoutes(t *testing.T) {
+	store, err := auth.NewFile(filepath.Join(t.TempDir(), "keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	access := Access{Keys: auth.New(store, "bootstrap-secret")}
+	tokens := map[auth.Scope]string{}
+	for _, s := range auth.Scopes {
+		key, token, err := auth.NewKey(string(s), []auth.Scope{s})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Put(key); err != nil {
+			t.Fatal(err)
+		}
+		tokens[s] = token
+	}
+	victim, _, err := auth.NewKey("victim", []auth.Scope{auth.Read})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(victim); err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.Use(authMiddleware(access, log.WithField("test", t.Name())))
+	registerAPI(router, &core{access: access, log: log.WithField("test", t.Name())})
+
+	routes := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodGet, "/api/v1/keys", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/keys", `{"name":"new","scopes":["read"]}`, http.StatusCreated},
+		{http.MethodDelete, "/api/v1/keys/" + victim.ID, "", http.StatusNoContent},
+	}
+	for _, route := range routes {
+		testCases := []struct {
+			name   string
+			token  string
+			status int
+		}{
+			{"anonymous", "", http.StatusUnauthorized},
+			{"invalid", "gg_0000_0000", http.StatusUnauthorized},
+			{"read", tokens[auth.Read], http.StatusForbidden},
+			{"refresh", tokens[auth.Refresh], http.StatusForbidden},
+			{"private repos", tokens[auth.PrivateRepos], http.StatusForbidden},
+			// last, as it revokes the victim
+			{"admin", tokens[auth.Admin], route.status},
+		}
+		for _, tc := range testCases {
+			t.Run(route.method+" "+tc.name, func(t *testing.T) {
+				r := httptest.NewRequest(route.method, route.path, strings.NewReader(route.body))
+				if tc.token != "" {
+					r.Header.Set("Authorization", "Bearer "+tc.token)
+				}
+				rw := httptest.NewRecorder()
+				router.ServeHTTP(rw, r)
+
+				if rw.Code != tc.status {
+					t.Fatalf("%s %s = %d %s, want %d", route.method, route.path, rw.Code, rw.Body, tc.status)
+				}
+				if rw.Code >= 400 {
+					var body apiError
+					if err := json.NewDecoder(rw.Body).Decode(&body); err != nil || body.Error.Message == "" {
+						t.Errorf("error body %q: %v", rw.Body, err)
+					}
+				}
+			})
+		}
+	}
+
+	if _, err := store.Get(victim.ID); err == nil {
+		t.Error("admin failed to revoke the key")
+	}
+	if keys, _ := store.List(); len(keys) != len(auth.Scopes)+1 {
+		t.Errorf("%d keys, want %d", len(keys), len(auth.Scopes)+1)
+	}
+}
@@ -0,0 +1,142 @@
+package web
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siggy/gographs/pkg/auth"
+	"github.com/siggy/gographs/pkg/cache"
+	"github.com/siggy/gographs/pkg/render"
+	log "github.com/sirupsen/logrus"
+)
+
+// Rate allows Limit requests per Window. A zero Limit allows any number.
+type Rate struct {
+	Limit  int
+	Window time.Duration
+}
+
+// ParseRate parses a rate such as "60/1m", or "0" for no limit.
+func ParseRate(s string) (Rate, error) {
+	if s == "0" {
+		return Rate{}, nil
+	}
+	limit, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("invalid rate %q, must be N/DURATION, e.g. 60/1m", s)
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q: bad limit", s)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d < time.Second {
+		return Rate{}, fmt.Errorf("invalid rate %q: window must be at least 1s", s)
+	}
+	return Rate{n, d}, nil
+}
+
+func (r Rate) String() string {
+	if r.Limit == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%d/%s", r.Limit, r.Window)
+}
+
+// Limits rate limit requests that may trigger graph builds. Refreshes, which
+// always rebuild, are limited separately from reads.
+type Limits struct {
+	// Reads limits graph requests that build, and repo requests, per client.
+	Reads Rate
+	// ClientRefreshes limits refreshes, per client.
+	ClientRefreshes Rate
+	// RepoRefreshes limits refreshes, per repo, across all clients.
+	RepoRefreshes Rate
+}
+
+// DefaultLimits are generous for people, and tight for scripts.
+var DefaultLimits = Limits{
+	Reads:           Rate{120, time.Minute},
+	ClientRefreshes: Rate{10, time.Hour},
+	RepoRefreshes:   Rate{6, time.Hour},
+}
+
+// Limit names, as counted in metrics.
+const (
+	readLimit          = "read"
+	clientRefreshLimit = "client_refresh"
+	repoRefreshLimit   = "repo_refresh"
+)
+
+// limiter checks requests against Limits, counting them in the cache so
+// limits hold across replicas sharing it.
+type limiter struct {
+	cache  *cache.Cache
+	limits Limits
+	log    *log.Entry
+}
+
+// limitedClient identifies the client of a request for rate limits: its API
+// key, so limits follow a key across addresses, or else its address.
+func limitedClient(r *http.Request) string {
+	if key := auth.FromContext(r.Context()); key != nil {
+		return "key:" + key.ID
+	}
+	return clientAddr(r)
+}
+
+// read checks a read by r's client, setting Retry-After and returning an error
+// if it is limited.
+func (l *limiter) read(rw http.ResponseWriter, r *http.Request) *requestError {
+	return l.check(rw, readLimit, limitedClient(r), l.limits.Reads)
+}
+
+// graph checks a request by r's client for a graph of repo. Only graphs that
+// will be built count as reads, so cached graphs are served however often
+// they are asked for; refreshes always build.
+func (l *limiter) graph(rw http.ResponseWriter, r *http.Request, repo string, opts render.Options, refresh bool) *requestError {
+	if !refresh && render.Cached(l.cache, repo, opts) {
+		return nil
+	}
+	if rerr := l.read(rw, r); rerr != nil {
+		return rerr
+	}
+	if refresh {
+		return l.refresh(rw, r, repo)
+	}
+	return nil
+}
+
+// refresh checks a refresh of repo by r's client, setting Retry-After and
+// returning an error if it is limited.
+func (l *limiter) refresh(rw http.ResponseWriter, r *http.Request, repo string) *requestError {
+	if rerr := l.check(rw, clientRefreshLimit, limitedClient(r), l.limits.ClientRefreshes); rerr != nil {
+		return rerr
+	}
+	return l.check(rw, repoRefreshLimit, repo, l.limits.RepoRefreshes)
+}
+
+func (l *limiter) check(rw http.ResponseWriter, name, key string, rate Rate) *requestError {
+	if rate.Limit == 0 {
+		return nil
+	}
+
+	count, reset, err := l.cache.Count(name+":"+key, rate.Window)
+	if err != nil {
+		// Fail open, rather than take the site down with the cache.
+		l.log.Errorf("Rate limit check failed: %s", err)
+		return nil
+	}
+	if count <= int64(rate.Limit) {
+		return nil
+	}
+
+	rateLimited.WithLabelValues(name).Inc()
+	rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+	message := fmt.Sprintf("Rate limit of %s exceeded", rate)
+	return &requestError{http.StatusTooManyRequests, message, nil}
+}
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/siggy/gographs/pkg/auth"
+	"github.com/siggy/gographs/pkg/cache"
+	log "github.com/sirupsen/logrus"
+)
+
+// TestRejectedRefreshes checks that refreshes rejected for access do not use
+// up a repo's refresh budget, so anonymous clients can't lock out key holders.
+func TestRejectedRefreshes(t *testing.T) {
+	store, err := cache.NewMemory(cache.DefaultMemoryEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cache.New(store, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.WithField(webServer, "test")
+	limiter := &limiter{cache: c, limits: Limits{RepoRefreshes: Rate{2, time.Hour}}, log: logger}
+	access := testAccess(t)
+
+	core := &core{cache: c, limiter: limiter, access: access, log: logger}
+	router := mux.NewRouter()
+	router.Methods(http.MethodPost).PathPrefix("/graph").HandlerFunc(mkGraphHandler(core))
+	router.Methods(http.MethodPost).Path(apiPrefix + "/jobs").HandlerFunc(mkAPICreateJobHandler(core))
+
+	const repo = "github.com/siggy/gographs"
+	requests := []struct {
+		name   string
+		path   string
+		body   string
+		scopes []auth.Scope
+		status int
+	}{
+		{"anonymous refresh", "/graph/" + repo + ".svg", "", nil, http.StatusUnauthorized},
+		{"refresh without scope", "/graph/" + repo + ".svg", "", []auth.Scope{auth.Read}, http.StatusForbidden},
+		{"anonymous job", apiPrefix + "/jobs", `{"repo":"` + repo + `"}`, nil, http.StatusUnauthorized},
+		{"job without scope", apiPrefix + "/jobs", `{"repo":"https://GitHub.com/siggy/gographs"}`, []auth.Scope{auth.Read}, http.StatusForbidden},
+	}
+	for _, req := range requests {
+		t.Run(req.name, func(t *testing.T) {
+			for range 3 {
+				r := httptest.NewRequest(http.MethodPost, req.path, strings.NewReader(req.body))
+				if len(req.scopes) > 0 {
+					r = r.WithContext(auth.WithKey(r.Context(), &auth.Key{ID: "k1", Scopes: req.scopes}))
+				}
+				rw := httptest.NewRecorder()
+				router.ServeHTTP(rw, r)
+				if rw.Code != req.status {
+					t.Errorf("POST %s = %d, want %d", req.path, rw.Code, req.status)
+				}
+			}
+		})
+	}
+
+	// the repo's budget is untouched
+	rw := httptest.NewRecorder()
+	for range 2 {
+		assertStatus(t, limiter.refresh(rw, keyRequest(auth.Refresh), repo), 0)
+	}
+	assertStatus(t, limiter.refresh(rw, keyRequest(auth.Refresh), repo), http.StatusTooManyRequests)
+}
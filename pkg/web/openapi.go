@@ -0,0 +1,241 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/siggy/gographs/pkg/auth"
+	"github.com/siggy/gographs/pkg/cache"
+	"github.com/siggy/gographs/pkg/render"
+)
+
+// openAPI is the OpenAPI 3 description of /api/v1, generated from the
+// formats, engines, themes and windows the server supports so it can't drift
+// from them.
+var openAPI = sync.OnceValue(func() []byte {
+	b, err := json.MarshalIndent(openAPISpec(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return b
+})
+
+func openAPIHandler(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(openAPI())
+}
+
+// object is a JSON object in the OpenAPI document.
+type object = map[string]any
+
+func openAPISpec() object {
+	formats := make([]string, len(render.Formats))
+	for i, f := range render.Formats {
+		formats[i] = string(f)
+	}
+	windows := make([]string, 0, len(cache.ScoreWindows))
+	for w := range cache.ScoreWindows {
+		windows = append(windows, w)
+	}
+	slices.Sort(windows)
+	scopes := make([]string, len(auth.Scopes))
+	for i, s := range auth.Scopes {
+		scopes[i] = string(s)
+	}
+
+	repoParam := object{
+		"name": "repo", "in": "path", "required": true,
+		"description": "Go repo import path, e.g. github.com/siggy/gographs.",
+		"schema":      object{"type": "string"},
+	}
+	graphParams := []object{
+		repoParam,
+		query("format", "Output format.", enum(formats, string(render.SVG))),
+		query("cluster", "Group packages by directory.", object{"type": "boolean", "default": false}),
+		query("engine", "Graphviz layout engine.", enum(render.Engines, "dot")),
+		query("rankdir", "Rank direction. Defaults to goda's.", enum(render.RankDirs, "")),
+		query("theme", "Color theme. auto SVGs follow prefers-color-scheme.", enum(render.Themes, "")),
+		query("exclude", "Hide packages matching globs, relative to the repo. Repeatable or comma-separated.", object{"type": "array", "items": object{"type": "string"}}),
+		query("collapse", "Collapse directory subtrees, e.g. internal/..., into single nodes. Repeatable or comma-separated.", object{"type": "array", "items": object{"type": "string"}}),
+		query("maxdepth", "Collapse packages deeper than N directories below the repo root.", object{"type": "integer", "minimum": 0}),
+		query("reduce", "Remove edges implied by longer paths.", object{"type": "boolean", "default": false}),
+		query("dpi", "Resolution of raster formats.", object{"type": "integer"}),
+		query("scale", "Multiple of the default dpi, for raster formats.", object{"type": "number"}),
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "gographs",
+			"version":     "v1",
+			"description": "Dependency graphs for Go repos.",
+		},
+		"servers": []object{{"url": apiPrefix}},
+		// Keys are optional: cached public graphs are open to all.
+		"security": []object{{}, {"apiKey": []string{}}, {"bearer": []string{}}},
+		"paths": object{
+			"/graphs/{repo}": object{
+				"get": operation("getGraph", "Render a repo's dependency graph.", graphParams, "Graph"),
+			},
+			"/repos/{repo}": object{
+				"get": operation("getRepo", "Get a repo's current commit and links to its graphs.", []object{repoParam}, "Repo"),
+			},
+			"/jobs": object{
+				"post": object{
+					"operationId": "createJob",
+					"summary":     "Refresh a repo's graphs in the background.",
+					"requestBody": object{
+						"required": true,
+						"content":  jsonContent("JobRequest"),
+					},
+					"responses": object{
+						"202":     object{"description": "Job queued.", "content": jsonContent("Job")},
+						"default": errorResponse(),
+					},
+				},
+			},
+			"/jobs/{id}": object{
+				"get": operation("getJob", "Get a job's status.", []object{{
+					"name": "id", "in": "path", "required": true,
+					"schema": object{"type": "string"},
+				}}, "Job"),
+			},
+			"/popularity": object{
+				"get": operation("getPopularity", "List the most viewed repos over a window.", []object{
+					query("window", "Window to rank views over.", enum(windows, cache.DefaultScoreWindow)),
+					query("limit", "Maximum number of repos.", object{"type": "integer", "minimum": 1, "maximum": cache.MaxScores, "default": cache.DefaultScoreLimit}),
+				}, "Popularity"),
+			},
+			"/keys": object{
+				"get": operation("listKeys", "List API keys. Requires the admin scope.", nil, "Keys"),
+				"post": object{
+					"operationId": "createKey",
+					"summary":     "Create an API key. Requires the admin scope. The token is only returned now.",
+					"requestBody": object{
+						"required": true,
+						"content":  jsonContent("KeyRequest"),
+					},
+					"responses": object{
+						"201":     object{"description": "Key created.", "content": jsonContent("Key")},
+						"default": errorResponse(),
+					},
+				},
+			},
+			"/keys/{id}": object{
+				"delete": object{
+					"operationId": "revokeKey",
+					"summary":     "Revoke an API key. Requires the admin scope.",
+					"parameters": []object{{
+						"name": "id", "in": "path", "required": true,
+						"schema": object{"type": "string"},
+					}},
+					"responses": object{
+						"204":     object{"description": "Key revoked."},
+						"default": errorResponse(),
+					},
+				},
+			},
+		},
+		"components": object{
+			"securitySchemes": object{
+				"apiKey": object{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer": object{"type": "http", "scheme": "bearer"},
+			},
+			"schemas": object{
+				"Error": schema(object{
+					"error": schema(object{
+						"code":      object{"type": "string", "example": "not_found"},
+						"message":   object{"type": "string"},
+						"requestId": object{"type": "string"},
+					}),
+				}),
+				"Graph": schema(object{
+					"repo":        object{"type": "string"},
+					"format":      enum(formats, ""),
+					"contentType": object{"type": "string"},
+					"url":         object{"type": "string", "description": "Direct link to the rendered graph."},
+					"age":         object{"type": "integer", "description": "Seconds since the graph was rendered."},
+					"maxAge":      object{"type": "integer", "description": "Seconds the graph stays fresh."},
+					"stale":       object{"type": "boolean"},
+					"content":     object{"type": "string", "description": "The graph, for text formats only."},
+				}),
+				"Repo": schema(object{
+					"repo":   object{"type": "string"},
+					"commit": object{"type": "string"},
+					"graphs": object{"type": "object", "additionalProperties": object{"type": "string"}},
+				}),
+				"JobRequest": schema(object{
+					"repo": object{"type": "string"},
+				}),
+				"Job": schema(object{
+					"id":      object{"type": "string"},
+					"repo":    object{"type": "string"},
+					"status":  enum([]string{jobQueued, jobRunning, jobSucceeded, jobFailed}, ""),
+					"error":   object{"type": "string"},
+					"created": object{"type": "string", "format": "date-time"},
+					"updated": object{"type": "string", "format": "date-time"},
+				}),
+				"KeyRequest": schema(object{
+					"name":   object{"type": "string"},
+					"scopes": object{"type": "array", "items": enum(scopes, "")},
+				}),
+				"Key": schema(object{
+					"id":      object{"type": "string"},
+					"name":    object{"type": "string"},
+					"scopes":  object{"type": "array", "items": enum(scopes, "")},
+					"created": object{"type": "string", "format": "date-time"},
+					"token":   object{"type": "string", "description": "The key's secret, only returned when it is created."},
+				}),
+				"Keys": object{"type": "array", "items": object{"$ref": "#/components/schemas/Key"}},
+				"Popularity": schema(object{
+					"window": enum(windows, ""),
+					"repos": object{"type": "array", "items": schema(object{
+						"repo": object{"type": "string"},
+						"url":  object{"type": "string"},
+					})},
+				}),
+			},
+		},
+	}
+}
+
+func operation(id, summary string, params []object, result string) object {
+	return object{
+		"operationId": id,
+		"summary":     summary,
+		"parameters":  params,
+		"responses": object{
+			"200":     object{"description": "OK", "content": jsonContent(result)},
+			"default": errorResponse(),
+		},
+	}
+}
+
+func query(name, description string, s object) object {
+	return object{"name": name, "in": "query", "description": description, "schema": s}
+}
+
+func enum(values []string, def string) object {
+	s := object{"type": "string", "enum": values}
+	if def != "" {
+		s["default"] = def
+	}
+	return s
+}
+
+func schema(properties object) object {
+	return object{"type": "object", "properties": properties}
+}
+
+func jsonContent(schema string) object {
+	return object{"application/json": object{
+		"schema": object{"$ref": "#/components/schemas/" + schema},
+	}}
+}
+
+func errorResponse() object {
+	return object{"description": "Error", "content": jsonContent("Error")}
+}
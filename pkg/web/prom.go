@@ -0,0 +1,27 @@
+package web
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gographs",
+	Subsystem: webServer,
+	Name:      "rate_limited_total",
+	Help:      "Count of requests rejected by rate limits, by limit: read, client_refresh or repo_refresh.",
+}, []string{"limit"})
+
+var keyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gographs",
+	Subsystem: webServer,
+	Name:      "api_key_requests_total",
+	Help:      "Count of requests by API key ID, or anonymous.",
+}, []string{"key"})
+
+var authFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gographs",
+	Subsystem: webServer,
+	Name:      "auth_failures_total",
+	Help:      "Count of requests refused for their API key, by reason: invalid_key or missing_scope.",
+}, []string{"reason"})
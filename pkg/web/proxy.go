@@ -0,0 +1,108 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies are the networks of reverse proxies whose X-Forwarded-For
+// headers identify clients. Requests from anywhere else are identified by
+// their remote address, so clients cannot pick their own address to dodge
+// rate limits or inflate popularity.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses comma-separated CIDRs or addresses, e.g.
+// "10.0.0.0/8,192.168.1.10". The empty string trusts no proxies.
+func ParseTrustedProxies(s string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	if s == "" {
+		return proxies, nil
+	}
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(p)
+			if aerr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q, must be a CIDR or address", p)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// trusted reports whether addr is one of the proxies.
+func (t TrustedProxies) trusted(addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range t {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// client returns the address of r's client: its remote address, or, when that
+// is a trusted proxy, the nearest X-Forwarded-For hop that is not.
+func (t TrustedProxies) client(r *http.Request) string {
+	addr := remoteHost(r)
+	if !t.trusted(addr) {
+		return addr
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		addr = hop
+		if !t.trusted(hop) {
+			break
+		}
+	}
+	return addr
+}
+
+// remoteHost returns the host of r's remote address.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type clientKey struct{}
+
+// clientMiddleware records each request's client address, for clientAddr.
+func clientMiddleware(proxies TrustedProxies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientKey{}, proxies.client(r))
+			next.ServeHTTP(rw, r.WithContext(ctx))
+		})
+	}
+}
+
+// clientAddr identifies the client of a request for popularity counts and
+// rate limits, as recorded by clientMiddleware.
+func clientAddr(r *http.Request) string {
+	if addr, ok := r.Context().Value(clientKey{}).(string); ok {
+		return addr
+	}
+	return remoteHost(r)
+}
@@ -0,0 +1,51 @@
+package web
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientAddr(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		remote  string
+		forward []string
+		want    string
+	}{
+		{"direct", "203.0.113.5:1234", nil, "203.0.113.5"},
+		{"spoofed from untrusted", "203.0.113.5:1234", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"trusted proxy", "10.1.2.3:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"trusted address", "192.168.1.10:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed through proxy", "10.1.2.3:1234", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.1.2.3:1234", []string{"198.51.100.1, 10.4.5.6"}, "198.51.100.1"},
+		{"split headers", "10.1.2.3:1234", []string{"198.51.100.1", "10.4.5.6"}, "198.51.100.1"},
+		{"only proxies", "10.1.2.3:1234", []string{"10.4.5.6"}, "10.4.5.6"},
+		{"proxy without header", "10.1.2.3:1234", nil, "10.1.2.3"},
+		{"mapped IPv4", "[::ffff:10.1.2.3]:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/graph/github.com/siggy/gographs.svg", nil)
+			r.RemoteAddr = tc.remote
+			for _, hop := range tc.forward {
+				r.Header.Add("X-Forwarded-For", hop)
+			}
+			if got := proxies.client(r); got != tc.want {
+				t.Errorf("client = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	for _, s := range []string{"10.0.0.0/33", "proxy.internal", "10.0.0.0/8,"} {
+		if _, err := ParseTrustedProxies(s); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded", s)
+		}
+	}
+}
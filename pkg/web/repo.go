@@ -0,0 +1,59 @@
+package web
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// normalizeRepo returns the canonical form of a repo path sent by a client or
+// a webhook: without a scheme or ".git" suffix, with a lowercase host, and a
+// clean path, e.g. "HTTPS://GitHub.com/siggy/gographs.git/" =>
+// "github.com/siggy/gographs". Access checks, cache keys and builds all use
+// it, so every spelling of a repo is treated alike.
+func normalizeRepo(repo string) (string, error) {
+	host, p, _ := strings.Cut(trimScheme(strings.TrimSpace(repo)), "/")
+	p = strings.TrimSuffix(path.Clean("/"+p), ".git")
+	if host == "" || strings.ContainsAny(host, "@?#\\ ") || p == "/" || p == "" {
+		return "", fmt.Errorf("invalid repo %q", repo)
+	}
+	for _, segment := range strings.Split(p[1:], "/") {
+		if segment == "" || strings.ContainsAny(segment, "?#\\ ") {
+			return "", fmt.Errorf("invalid repo %q", repo)
+		}
+	}
+	return strings.ToLower(host) + p, nil
+}
+
+// trimScheme strips a leading scheme, e.g. "https://", from a repo. Paths may
+// have had the scheme's "//" cleaned to "/".
+func trimScheme(repo string) string {
+	if i := strings.Index(repo, ":/"); i > 0 && validScheme(repo[:i]) {
+		return strings.TrimLeft(repo[i+1:], "/")
+	}
+	return repo
+}
+
+// validScheme reports whether s is a URL scheme, e.g. "https".
+func validScheme(s string) bool {
+	for i, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// normalizePrefix strips the scheme of a repo prefix and lowercases its host,
+// e.g. "https://Git.Example.com/Team/" => "git.example.com/Team/", to match
+// normalized repos.
+func normalizePrefix(prefix string) string {
+	host, rest, ok := strings.Cut(trimScheme(strings.TrimSpace(prefix)), "/")
+	if !ok {
+		return strings.ToLower(host)
+	}
+	return strings.ToLower(host) + "/" + rest
+}
@@ -3,8 +3,15 @@ package web
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/siggy/gographs/pkg/cache"
@@ -16,115 +23,279 @@ import (
 
 const webServer = "web"
 
-// Start initializes the web server and starts listening.
-func Start(c *cache.Cache, addr string, graph *graph.Client) error {
-	router := mux.NewRouter()
-	router.Use(prom.Middleware(webServer))
-
-	getRouter := router.Methods(http.MethodGet).Subrouter()
-	postRouter := router.Methods(http.MethodPost).Subrouter()
-
+// Start initializes the web server and starts listening. webhooks holds the
+// secrets for push webhooks, by git host, limits rate limits requests that
+// may build graphs, access restricts requests to holders of API keys, and
+// proxies are trusted to identify clients in X-Forwarded-For.
+func Start(c *cache.Cache, addr string, graph *graph.Client, renderer render.Renderer, webhooks WebhookSecrets, limits Limits, access Access, proxies TrustedProxies) error {
 	log := log.WithFields(
 		log.Fields{
 			webServer: addr,
 		},
 	)
 
+	core := &core{
+		graph:    graph,
+		cache:    c,
+		renderer: renderer,
+		limiter:  &limiter{cache: c, limits: limits, log: log},
+		access:   access,
+		log:      log,
+	}
+	router := newRouter(core, webhooks, proxies)
+
+	log.Infof("%s server listening on %s", webServer, addr)
+
+	return http.ListenAndServe(addr, router)
+}
+
+// newRouter routes the web views, the API, legacy APIs, webhooks and assets
+// to their handlers.
+func newRouter(core *core, webhooks WebhookSecrets, proxies TrustedProxies) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(clientMiddleware(proxies))
+	router.Use(prom.Middleware(webServer))
+	if core.access.enabled() {
+		router.Use(authMiddleware(core.access, core.log))
+	}
+
+	// versioned api, ahead of the catch-all asset route
+	registerAPI(router, core)
+
+	getRouter := router.Methods(http.MethodGet).Subrouter()
+	postRouter := router.Methods(http.MethodPost).Subrouter()
+
 	// web views
 	getRouter.PathPrefix("/repo").HandlerFunc(repoHandler)
 	getRouter.HandleFunc("/svg", repoHandler)
 	getRouter.HandleFunc("/", repoHandler)
 
-	// apis
-	graphHandler := mkGraphHandler(graph, c, log)
+	// legacy apis, wrapping the same core as the versioned api
+	graphHandler := mkGraphHandler(core)
 	getRouter.PathPrefix("/graph").HandlerFunc(graphHandler)
 	postRouter.PathPrefix("/graph").HandlerFunc(graphHandler)
-	getRouter.HandleFunc("/top-repos", mkTopReposHandler(c))
+	getRouter.HandleFunc("/top-repos", mkTopReposHandler(core))
 
-	// assets
-	getRouter.PathPrefix("/").Handler(http.FileServer(http.Dir("./public/")))
+	// webhooks
+	postRouter.HandleFunc("/webhooks/{host}", mkWebhookHandler(core.cache, webhooks, core.log))
 
-	log.Infof("%s server listening on %s", webServer, addr)
+	// assets
+	getRouter.PathPrefix("/").Handler(staticHandler(publicDir, http.FileServer(http.Dir(publicDir))))
 
-	return http.ListenAndServe(addr, router)
+	return router
 }
 
 func repoHandler(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "public/index.html")
+	setStaticHeaders(w, indexFile)
+	http.ServeFile(w, r, indexFile)
+}
+
+const (
+	publicDir = "./public/"
+	indexFile = publicDir + "index.html"
+
+	// staticMaxAge is short, as assets are not fingerprinted, but ETags let
+	// clients revalidate them cheaply.
+	staticMaxAge = 5 * time.Minute
+)
+
+// staticHandler sets caching headers on files served from dir by next.
+func staticHandler(dir string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		setStaticHeaders(rw, filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.URL.Path))))
+		next.ServeHTTP(rw, r)
+	})
 }
 
-func mkGraphHandler(graph *graph.Client, cache *cache.Cache, log *log.Entry) http.HandlerFunc {
+// setStaticHeaders sets Cache-Control and a weak ETag, from its size and
+// modification time, for a static file. http.ServeFile and http.FileServer
+// then answer conditional requests with 304s.
+func setStaticHeaders(rw http.ResponseWriter, file string) {
+	info, err := os.Stat(file)
+	if err != nil || info.IsDir() {
+		return
+	}
+	rw.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(staticMaxAge.Seconds())))
+	rw.Header().Set("ETag", fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+}
+
+func mkGraphHandler(core *core) http.HandlerFunc {
 	// GET  /graph/github.com/siggy/gographs.svg
+	// GET  /graph/github.com/siggy/gographs.png?scale=2
+	// GET  /graph/github.com/siggy/gographs.mmd?cluster=true
 	// POST /graph/github.com/siggy/gographs.svg (for refresh)
 	return func(rw http.ResponseWriter, r *http.Request) {
-		vars := r.URL.Query()
-		cluster := vars.Get("cluster") == "true"
-
-		refresh := r.Method == http.MethodPost
-
 		tpl, err := mux.CurrentRoute(r).GetPathTemplate()
 		if err != nil {
 			writeError(rw, r, http.StatusInternalServerError, err.Error(), err)
 			return
 		}
 
-		suffix := ""
-		contentType := ""
-		if strings.HasSuffix(r.URL.Path, ".svg") {
-			suffix = ".svg"
-			contentType = "image/svg+xml; charset=utf-8"
-		} else if strings.HasSuffix(r.URL.Path, ".dot") {
-			suffix = ".dot"
-			contentType = "text/plain; charset=utf-8"
-		} else {
-			writeError(rw, r, http.StatusBadRequest, "svg or dot suffix required", nil)
+		suffix := path.Ext(r.URL.Path)
+		format, err := render.ParseFormat(suffix)
+		if err != nil {
+			writeError(rw, r, http.StatusBadRequest, formatsMessage, err)
+			return
+		}
+		repo := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, tpl+"/"), suffix)
+
+		g, rerr := core.renderGraph(rw, r, repo, format, r.URL.Query(), r.Method == http.MethodPost)
+		if rerr != nil {
+			writeError(rw, r, rerr.status, rerr.message, rerr.err)
 			return
 		}
 
-		goRepo := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, tpl+"/"), suffix)
+		rw.Header().Set("Content-Type", format.ContentType())
+		rw.Header().Set("Vary", "Accept-Encoding")
+		setCacheHeaders(rw, g.entry, core.cache.StaleTTL(), core.access.privateResponse(r, g.repo))
 
-		if refresh {
-			log.Debugf("Clearing cache for %s", goRepo)
-			err = cache.Clear(goRepo)
+		// Each encoding is its own representation, so needs its own ETag.
+		etag := g.entry.Hash()
+		body, ok := g.entry.Gzip()
+		if ok && acceptsGzip(r) {
+			rw.Header().Set("Content-Encoding", "gzip")
+			etag += "-gzip"
+		} else {
+			body, err = g.entry.Value()
 			if err != nil {
-				log.Errorf("Failed to clear cache for repo %s: %s", goRepo, err)
+				message := fmt.Sprintf("Failed to read cached %s%s", g.repo, suffix)
+				writeError(rw, r, http.StatusInternalServerError, message, err)
+				return
 			}
 		}
+		rw.Header().Set("ETag", `"`+etag+`"`)
+
+		// ServeContent answers If-None-Match and If-Modified-Since with 304s.
+		http.ServeContent(rw, r, "", g.entry.Created, strings.NewReader(body))
+	}
+}
 
-		log.Debugf("Processing %s", goRepo)
+// requestError is an error with the HTTP status and message to report it
+// with.
+type requestError struct {
+	status  int
+	message string
+	err     error
+}
 
-		out := ""
-		if suffix == ".svg" {
-			out, err = render.ToSVG(graph, cache, goRepo, cluster)
-		} else if suffix == ".dot" {
-			out, err = render.ToDOT(graph, cache, goRepo, cluster)
+// acceptsGzip reports whether a request's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(coding, ";")
+			name = strings.TrimSpace(name)
+			if name != "gzip" && name != "*" {
+				continue
+			}
+			q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q=")
+			if !ok {
+				return true
+			}
+			weight, err := strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
 		}
+	}
+	return false
+}
+
+// setCacheHeaders tells clients and CDNs how old a graph is, how long it stays
+// fresh, and that a stale copy may be served while it is rebuilt, or if
+// rebuilding fails. Private graphs are not cached at all, lest a CDN serve
+// them to anyone.
+func setCacheHeaders(rw http.ResponseWriter, entry cache.Entry, staleTTL time.Duration, private bool) {
+	rw.Header().Set("Age", strconv.Itoa(int(entry.Age.Seconds())))
+	// responses to API keys may differ from anonymous ones
+	rw.Header().Add("Vary", "Authorization, X-API-Key")
+	if private {
+		rw.Header().Set("Cache-Control", "private, no-store")
+		return
+	}
+	rw.Header().Set("Cache-Control", fmt.Sprintf(
+		"public, max-age=%d, stale-while-revalidate=%d, stale-if-error=%d",
+		int(entry.MaxAge.Seconds()), int(staleTTL.Seconds()), int(staleTTL.Seconds()),
+	))
+}
+
+// formatsMessage lists the supported suffixes, e.g. "one of .dot, .svg
+// suffix required".
+var formatsMessage = func() string {
+	suffixes := make([]string, len(render.Formats))
+	for i, f := range render.Formats {
+		suffixes[i] = "." + string(f)
+	}
+	return fmt.Sprintf("one of %s suffix required", strings.Join(suffixes, ", "))
+}()
+
+// parseOptions reads render options from query parameters:
+// cluster=true|false, engine=dot|neato|..., rankdir=TB|LR|BT|RL,
+// theme=light|dark|..., exclude=GLOB, collapse=DIR/..., maxdepth=N,
+// reduce=true|false, and for
+// raster formats dpi=N or scale=X (a multiple of the default dpi). exclude and
+// collapse may be repeated or comma-separated.
+func parseOptions(vars url.Values, format render.Format) (render.Options, error) {
+	opts := render.Options{
+		Cluster: vars.Get("cluster") == "true",
+		Format:  format,
+		Engine:  vars.Get("engine"),
+		RankDir: vars.Get("rankdir"),
+		Theme:   vars.Get("theme"),
+		Reduce:  vars.Get("reduce") == "true",
+
+		Exclude:  patterns(vars["exclude"]),
+		Collapse: patterns(vars["collapse"]),
+	}
+
+	if maxDepth := vars.Get("maxdepth"); maxDepth != "" {
+		n, err := strconv.Atoi(maxDepth)
 		if err != nil {
-			message := fmt.Sprintf("Failed to render %s to %s", goRepo, suffix)
-			writeError(rw, r, http.StatusInternalServerError, message, err)
-			return
+			return opts, fmt.Errorf("invalid maxdepth: %q", maxDepth)
 		}
+		opts.MaxDepth = n
+	}
+
+	if dpi := vars.Get("dpi"); dpi != "" {
+		n, err := strconv.Atoi(dpi)
+		if err != nil {
+			return opts, fmt.Errorf("invalid dpi: %q", dpi)
+		}
+		opts.DPI = n
+	} else if scale := vars.Get("scale"); scale != "" {
+		f, err := strconv.ParseFloat(scale, 64)
+		if err != nil || f <= 0 {
+			return opts, fmt.Errorf("invalid scale: %q", scale)
+		}
+		opts.DPI = int(math.Round(f * render.DefaultDPI))
+	}
 
-		go cache.RepoScoreIncr(goRepo)
+	return opts, opts.Validate()
+}
 
-		rw.Header().Set("Content-Type", contentType)
-		rw.WriteHeader(http.StatusOK)
-		rw.Write([]byte(out))
+// patterns splits repeated, comma-separated query parameters into patterns.
+func patterns(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				out = append(out, p)
+			}
+		}
 	}
+	return out
 }
 
 // TODO: poll for this every interval, hold result in local mem
-func mkTopReposHandler(cache *cache.Cache) http.HandlerFunc {
+func mkTopReposHandler(core *core) http.HandlerFunc {
 	// /top-repos
+	// /top-repos?window=24h|7d|all&limit=N
 	return func(rw http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			writeError(rw, r, http.StatusMethodNotAllowed, "", nil)
 			return
 		}
 
-		scores, err := cache.RepoScores()
-		if err != nil {
-			writeError(rw, r, http.StatusInternalServerError, "", err)
+		_, scores, rerr := core.topRepos(r.URL.Query())
+		if rerr != nil {
+			writeError(rw, r, rerr.status, rerr.message, rerr.err)
 			return
 		}
 
@@ -140,6 +311,29 @@ func mkTopReposHandler(cache *cache.Cache) http.HandlerFunc {
 	}
 }
 
+// parseTopRepos reads the window, by name and duration, and limit for
+// /top-repos from query parameters, defaulting to the top 10 over 7 days.
+func parseTopRepos(vars url.Values) (string, time.Duration, int, error) {
+	name := vars.Get("window")
+	if name == "" {
+		name = cache.DefaultScoreWindow
+	}
+	window, ok := cache.ScoreWindows[name]
+	if !ok {
+		return "", 0, 0, fmt.Errorf("invalid window %q, must be one of: 24h, 7d, all", name)
+	}
+
+	limit := cache.DefaultScoreLimit
+	if l := vars.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > cache.MaxScores {
+			return "", 0, 0, fmt.Errorf("invalid limit %q, must be between 1 and %d", l, cache.MaxScores)
+		}
+	}
+	return name, window, limit, nil
+}
+
 // writeError handles all errors returned by the web server. It writes an error
 // header, an optional error message, counts the error in metrics, and logs it.
 func writeError(rw http.ResponseWriter, r *http.Request, status int, message string, err error) {
@@ -0,0 +1,123 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siggy/gographs/pkg/auth"
+	"github.com/siggy/gographs/pkg/cache"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSetCacheHeaders(t *testing.T) {
+	access := Access{PrivateRepos: []string{"git.example.com/"}}
+	entry := cache.Entry{Age: time.Minute, MaxAge: time.Hour}
+
+	testCases := []struct {
+		name  string
+		repo  string
+		key   *auth.Key
+		cache string
+	}{
+		{"public", "github.com/siggy/gographs", nil, "public, max-age=3600, stale-while-revalidate=60, stale-if-error=60"},
+		{"private repo", "git.example.com/team/app", nil, "private, no-store"},
+		{"authenticated", "github.com/siggy/gographs", &auth.Key{ID: "k1"}, "private, no-store"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/graph/"+tc.repo+".svg", nil)
+			if tc.key != nil {
+				r = r.WithContext(auth.WithKey(r.Context(), tc.key))
+			}
+			rw := httptest.NewRecorder()
+			rw.Header().Set("Vary", "Accept-Encoding")
+
+			setCacheHeaders(rw, entry, time.Minute, access.privateResponse(r, tc.repo))
+
+			if got := rw.Header().Get("Cache-Control"); got != tc.cache {
+				t.Errorf("Cache-Control = %q, want %q", got, tc.cache)
+			}
+			vary := strings.Join(rw.Header().Values("Vary"), ", ")
+			if !strings.Contains(vary, "Accept-Encoding") || !strings.Contains(vary, "Authorization") {
+				t.Errorf("Vary = %q, want Accept-Encoding and Authorization", vary)
+			}
+		})
+	}
+}
+
+// TestLegacyRoutes checks that /graph and /api/v1/graphs agree, differing only
+// in URL shape and error encoding.
+func TestLegacyRoutes(t *testing.T) {
+	store, err := cache.NewMemory(cache.DefaultMemoryEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cache.New(store, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("svg", "github.com/siggy/cached", "false", "<svg/>")
+	c.Set("svg", "git.example.com/team/app", "false", "<svg/>")
+
+	logger := log.WithField(webServer, "test")
+	router := newRouter(&core{
+		cache:   c,
+		limiter: &limiter{cache: c, log: logger},
+		access:  testAccess(t),
+		log:     logger,
+	}, nil, nil)
+
+	testCases := []struct {
+		name   string
+		legacy string
+		api    string
+		status int
+	}{
+		{"cached", "/graph/GitHub.com/siggy/cached.svg", "/api/v1/graphs/GitHub.com/siggy/cached", http.StatusOK},
+		{"uncached", "/graph/github.com/siggy/gographs.svg", "/api/v1/graphs/github.com/siggy/gographs?format=svg", http.StatusUnauthorized},
+		{"private", "/graph/git.example.com/team/app.svg", "/api/v1/graphs/git.example.com/team/app", http.StatusUnauthorized},
+		{"invalid repo", "/graph/github.com.svg", "/api/v1/graphs/github.com", http.StatusBadRequest},
+		{"invalid option", "/graph/github.com/siggy/cached.svg?maxdepth=x", "/api/v1/graphs/github.com/siggy/cached?maxdepth=x", http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			legacy := httptest.NewRecorder()
+			router.ServeHTTP(legacy, httptest.NewRequest(http.MethodGet, tc.legacy, nil))
+			api := httptest.NewRecorder()
+			router.ServeHTTP(api, httptest.NewRequest(http.MethodGet, tc.api, nil))
+
+			if legacy.Code != tc.status || api.Code != tc.status {
+				t.Fatalf("GET %s = %d, GET %s = %d, want %d", tc.legacy, legacy.Code, tc.api, api.Code, tc.status)
+			}
+
+			if tc.status != http.StatusOK {
+				var body apiError
+				if err := json.Unmarshal(api.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Error.Message != legacy.Body.String() {
+					t.Errorf("API error %q, legacy error %q", body.Error.Message, legacy.Body)
+				}
+				return
+			}
+
+			var graph apiGraph
+			if err := json.Unmarshal(api.Body.Bytes(), &graph); err != nil {
+				t.Fatal(err)
+			}
+			if graph.Repo != "github.com/siggy/cached" {
+				t.Errorf("API repo %q, want github.com/siggy/cached", graph.Repo)
+			}
+			if graph.Content != legacy.Body.String() {
+				t.Errorf("API graph %q, legacy graph %q", graph.Content, legacy.Body)
+			}
+			if got, want := api.Header().Get("Cache-Control"), legacy.Header().Get("Cache-Control"); got != want {
+				t.Errorf("API Cache-Control %q, legacy %q", got, want)
+			}
+		})
+	}
+}
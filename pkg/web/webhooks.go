@@ -0,0 +1,210 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/siggy/gographs/pkg/cache"
+	log "github.com/sirupsen/logrus"
+)
+
+// Git hosts that can send push webhooks.
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+	Gitea  = "gitea"
+)
+
+// WebhookSecrets maps git hosts, e.g. "github", to the secret their webhooks
+// are configured with. Webhooks from hosts without a secret are rejected.
+type WebhookSecrets map[string]string
+
+// maxWebhookBytes matches GitHub's maximum payload size.
+const maxWebhookBytes = 25 << 20
+
+// LoadWebhookSecrets reads webhook secrets from a JSON file, keyed by host. An
+// empty path disables webhooks.
+//
+//	{"github": "...", "gitlab": "...", "gitea": "..."}
+func LoadWebhookSecrets(file string) (WebhookSecrets, error) {
+	if file == "" {
+		return WebhookSecrets{}, nil
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var secrets WebhookSecrets
+	if err := json.Unmarshal(b, &secrets); err != nil {
+		return nil, fmt.Errorf("invalid webhook secrets %s: %w", file, err)
+	}
+	for host := range secrets {
+		if _, ok := webhookHosts[host]; !ok {
+			return nil, fmt.Errorf("invalid webhook secrets %s: unknown host %q, must be one of: %s, %s, %s", file, host, GitHub, GitLab, Gitea)
+		}
+	}
+	return secrets, nil
+}
+
+// webhookHost verifies and parses one git host's push webhooks.
+type webhookHost struct {
+	// verify checks a request's signature or token against the secret.
+	verify func(r *http.Request, body []byte, secret string) bool
+	// isPush reports whether a request is a push event.
+	isPush func(r *http.Request) bool
+	// parse returns the pushed repo's web URL, the pushed ref, and the repo's
+	// default branch.
+	parse func(body []byte) (repoURL, ref, defaultBranch string, err error)
+}
+
+var webhookHosts = map[string]webhookHost{
+	// https://docs.github.com/en/webhooks/webhook-events-and-payloads#push
+	GitHub: {
+		verify: func(r *http.Request, body []byte, secret string) bool {
+			sig, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+			return ok && validHMAC(body, secret, sig)
+		},
+		isPush: func(r *http.Request) bool {
+			return r.Header.Get("X-GitHub-Event") == "push"
+		},
+		parse: parseRepositoryPush,
+	},
+	// https://docs.gitlab.com/user/project/integrations/webhook_events/#push-events
+	// GitLab sends the secret token itself, rather than a signature.
+	GitLab: {
+		verify: func(r *http.Request, _ []byte, secret string) bool {
+			token := r.Header.Get("X-Gitlab-Token")
+			return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+		},
+		isPush: func(r *http.Request) bool {
+			return r.Header.Get("X-Gitlab-Event") == "Push Hook"
+		},
+		parse: func(body []byte) (string, string, string, error) {
+			var push struct {
+				Ref     string `json:"ref"`
+				Project struct {
+					WebURL        string `json:"web_url"`
+					DefaultBranch string `json:"default_branch"`
+				} `json:"project"`
+			}
+			err := json.Unmarshal(body, &push)
+			return push.Project.WebURL, push.Ref, push.Project.DefaultBranch, err
+		},
+	},
+	// https://docs.gitea.com/usage/webhooks
+	Gitea: {
+		verify: func(r *http.Request, body []byte, secret string) bool {
+			return validHMAC(body, secret, r.Header.Get("X-Gitea-Signature"))
+		},
+		isPush: func(r *http.Request) bool {
+			return r.Header.Get("X-Gitea-Event") == "push"
+		},
+		parse: parseRepositoryPush,
+	},
+}
+
+// parseRepositoryPush parses the push payload shared by GitHub and Gitea.
+func parseRepositoryPush(body []byte) (string, string, string, error) {
+	var push struct {
+		Ref        string `json:"ref"`
+		Repository struct {
+			HTMLURL       string `json:"html_url"`
+			DefaultBranch string `json:"default_branch"`
+		} `json:"repository"`
+	}
+	err := json.Unmarshal(body, &push)
+	return push.Repository.HTMLURL, push.Ref, push.Repository.DefaultBranch, err
+}
+
+// validHMAC reports whether sig is the hex HMAC-SHA256 of body keyed by secret.
+func validHMAC(body []byte, secret, sig string) bool {
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func mkWebhookHandler(cache *cache.Cache, secrets WebhookSecrets, log *log.Entry) http.HandlerFunc {
+	// POST /webhooks/github
+	// POST /webhooks/gitlab
+	// POST /webhooks/gitea
+	return func(rw http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["host"]
+		host, ok := webhookHosts[name]
+		secret := secrets[name]
+		if !ok || secret == "" {
+			writeError(rw, r, http.StatusNotFound, fmt.Sprintf("Webhooks from %s are not enabled", name), nil)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxWebhookBytes))
+		if err != nil {
+			writeError(rw, r, http.StatusRequestEntityTooLarge, "Failed to read webhook body", err)
+			return
+		}
+
+		if !host.verify(r, body, secret) {
+			err := errors.New("invalid webhook signature")
+			writeError(rw, r, http.StatusUnauthorized, "Invalid webhook signature", err)
+			return
+		}
+
+		// Acknowledge, and ignore, other events such as pings.
+		if !host.isPush(r) {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		repoURL, ref, defaultBranch, err := host.parse(body)
+		if err != nil {
+			writeError(rw, r, http.StatusBadRequest, "Failed to parse push event", err)
+			return
+		}
+		repo, err := webhookRepo(repoURL)
+		if err != nil {
+			writeError(rw, r, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+
+		// Graphs are built from the default branch, so pushes elsewhere leave
+		// them unchanged.
+		if defaultBranch != "" && ref != "refs/heads/"+defaultBranch {
+			log.Debugf("Ignoring %s push to %s %s", name, repo, ref)
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		log.Infof("Clearing cache for %s after %s push to %s", repo, name, ref)
+		if err := cache.Clear(repo); err != nil {
+			writeError(rw, r, http.StatusInternalServerError, fmt.Sprintf("Failed to clear cache for %s", repo), err)
+			return
+		}
+
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// webhookRepo returns the Go repo path for a pushed repo's web URL, normalized
+// as requests for its graphs are, e.g.
+// https://GitHub.com/siggy/gographs => github.com/siggy/gographs
+func webhookRepo(repoURL string) (string, error) {
+	repo, err := normalizeRepo(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid repo URL in push event: %q", repoURL)
+	}
+	return repo, nil
+}
@@ -0,0 +1,315 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/siggy/gographs/pkg/cache"
+	log "github.com/sirupsen/logrus"
+)
+
+const testWebhookSecret = "It's a Secret to Everybody"
+
+// sign returns the hex HMAC-SHA256 of body, as GitHub and Gitea sign it.
+func sign(body, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidHMAC(t *testing.T) {
+	// https://docs.github.com/en/webhooks/using-webhooks/validating-webhook-deliveries#testing-the-webhook-payload-validation
+	const body = "Hello, World!"
+	const sig = "757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+
+	testCases := []struct {
+		name   string
+		body   string
+		secret string
+		sig    string
+		valid  bool
+	}{
+		{"github example", body, testWebhookSecret, sig, true},
+		{"uppercase hex", body, testWebhookSecret, strings.ToUpper(sig), true},
+		{"prefixed", body, testWebhookSecret, "sha256=" + sig, false},
+		{"wrong secret", body, "secret", sig, false},
+		{"changed body", body + "\n", testWebhookSecret, sig, false},
+		{"truncated", body, testWebhookSecret, sig[:32], false},
+		{"not hex", body, testWebhookSecret, "zz" + sig[2:], false},
+		{"empty", body, testWebhookSecret, "", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := validHMAC([]byte(tc.body), tc.secret, tc.sig); got != tc.valid {
+				t.Errorf("validHMAC = %t, want %t", got, tc.valid)
+			}
+		})
+	}
+}
+
+func TestWebhookRepo(t *testing.T) {
+	testCases := []struct {
+		url  string
+		repo string
+	}{
+		{"https://github.com/siggy/gographs", "github.com/siggy/gographs"},
+		{"https://GitHub.com/siggy/gographs", "github.com/siggy/gographs"},
+		{"https://gitlab.com/group/subgroup/project", "gitlab.com/group/subgroup/project"},
+		{"https://gitea.example.com:3000/team/app.git", "gitea.example.com:3000/team/app"},
+		{"http://git.example.com/team/app/", "git.example.com/team/app"},
+		{"https://git.example.com//team/./app", "git.example.com/team/app"},
+		{"https://github.com", ""},
+		{"https://github.com/", ""},
+		{"https://user@github.com/siggy/gographs", ""},
+		{"", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			repo, err := webhookRepo(tc.url)
+			if tc.repo == "" {
+				if err == nil {
+					t.Errorf("webhookRepo = %q, want an error", repo)
+				}
+				return
+			}
+			if err != nil || repo != tc.repo {
+				t.Errorf("webhookRepo = %q, %v, want %q", repo, err, tc.repo)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	repositoryPush := func(url, ref string) string {
+		return `{"ref":"` + ref + `","repository":{"html_url":"` + url + `","default_branch":"main"}}`
+	}
+	gitlabPush := func(url, ref string) string {
+		return `{"ref":"` + ref + `","project":{"web_url":"` + url + `","default_branch":"main"}}`
+	}
+	// github returns the headers of a GitHub event, with the signature sig
+	github := func(event, sig string) map[string]string {
+		return map[string]string{"X-GitHub-Event": event, "X-Hub-Signature-256": sig}
+	}
+	// signed returns the headers of a GitHub event correctly signing body
+	signed := func(event, body string) map[string]string {
+		return github(event, "sha256="+sign(body, testWebhookSecret))
+	}
+
+	const repo = "github.com/siggy/gographs"
+	const repoURL = "https://github.com/siggy/gographs"
+	push := repositoryPush(repoURL, "refs/heads/main")
+	nonCanonical := repositoryPush("https://GitHub.com/siggy/gographs.git", "refs/heads/main")
+	branch := repositoryPush(repoURL, "refs/heads/feature")
+	tag := repositoryPush(repoURL, "refs/tags/main")
+	noRepo := repositoryPush("https://github.com", "refs/heads/main")
+	ping := `{"zen":"Keep it logically awesome."}`
+
+	testCases := []struct {
+		name    string
+		host    string
+		headers map[string]string
+		body    string
+		status  int
+		cleared string
+	}{
+		{
+			name:    "github push",
+			host:    GitHub,
+			headers: signed("push", push),
+			body:    push,
+			status:  http.StatusNoContent,
+			cleared: repo,
+		},
+		{
+			name:    "github push to a non-canonical URL",
+			host:    GitHub,
+			headers: signed("push", nonCanonical),
+			body:    nonCanonical,
+			status:  http.StatusNoContent,
+			cleared: repo,
+		},
+		{
+			name:    "github signature without prefix",
+			host:    GitHub,
+			headers: github("push", sign(push, testWebhookSecret)),
+			body:    push,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "github bad signature",
+			host:    GitHub,
+			headers: github("push", "sha256="+sign(push, "wrong")),
+			body:    push,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "github unsigned",
+			host:    GitHub,
+			headers: map[string]string{"X-GitHub-Event": "push"},
+			body:    push,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "github ping",
+			host:    GitHub,
+			headers: signed("ping", ping),
+			body:    ping,
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "github push to another branch",
+			host:    GitHub,
+			headers: signed("push", branch),
+			body:    branch,
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "github tag push",
+			host:    GitHub,
+			headers: signed("push", tag),
+			body:    tag,
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "github invalid payload",
+			host:    GitHub,
+			headers: signed("push", "{"),
+			body:    "{",
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "github invalid repo URL",
+			host:    GitHub,
+			headers: signed("push", noRepo),
+			body:    noRepo,
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "gitea push",
+			host:    Gitea,
+			headers: map[string]string{"X-Gitea-Event": "push", "X-Gitea-Signature": sign(push, testWebhookSecret)},
+			body:    push,
+			status:  http.StatusNoContent,
+			cleared: repo,
+		},
+		{
+			name:    "gitea signature with github's prefix",
+			host:    Gitea,
+			headers: map[string]string{"X-Gitea-Event": "push", "X-Gitea-Signature": "sha256=" + sign(push, testWebhookSecret)},
+			body:    push,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "gitea signed by github's header",
+			host:    Gitea,
+			headers: map[string]string{"X-Gitea-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(push, testWebhookSecret)},
+			body:    push,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "gitlab push",
+			host:    GitLab,
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": testWebhookSecret},
+			body:    gitlabPush(repoURL, "refs/heads/main"),
+			status:  http.StatusNoContent,
+			cleared: repo,
+		},
+		{
+			name:    "gitlab wrong token",
+			host:    GitLab,
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "wrong"},
+			body:    gitlabPush(repoURL, "refs/heads/main"),
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "gitlab signature instead of token",
+			host:    GitLab,
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Hub-Signature-256": "sha256=" + sign(gitlabPush(repoURL, "refs/heads/main"), testWebhookSecret)},
+			body:    gitlabPush(repoURL, "refs/heads/main"),
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "gitlab push to another branch",
+			host:    GitLab,
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": testWebhookSecret},
+			body:    gitlabPush(repoURL, "refs/heads/feature"),
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "gitlab tag push",
+			host:    GitLab,
+			headers: map[string]string{"X-Gitlab-Event": "Tag Push Hook", "X-Gitlab-Token": testWebhookSecret},
+			body:    gitlabPush(repoURL, "refs/tags/v1.0.0"),
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "unknown host",
+			host:    "bitbucket",
+			headers: signed("push", push),
+			body:    push,
+			status:  http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := cache.NewMemory(cache.DefaultMemoryEntries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := cache.New(store, time.Hour, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Set("svg", repo, "false", "<svg/>")
+
+			secrets := WebhookSecrets{GitHub: testWebhookSecret, GitLab: testWebhookSecret, Gitea: testWebhookSecret}
+			router := mux.NewRouter()
+			router.HandleFunc("/webhooks/{host}", mkWebhookHandler(c, secrets, log.WithField(webServer, "test")))
+
+			r := httptest.NewRequest(http.MethodPost, "/webhooks/"+tc.host, strings.NewReader(tc.body))
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			rw := httptest.NewRecorder()
+			router.ServeHTTP(rw, r)
+
+			if rw.Code != tc.status {
+				t.Errorf("status %d %q, want %d", rw.Code, rw.Body, tc.status)
+			}
+			_, err = c.Get("svg", repo, "false")
+			if cleared := err != nil; cleared != (tc.cleared != "") {
+				t.Errorf("cache cleared: %t, want %t", cleared, tc.cleared != "")
+			}
+		})
+	}
+}
+
+func TestWebhookDisabled(t *testing.T) {
+	store, err := cache.NewMemory(cache.DefaultMemoryEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cache.New(store, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/webhooks/{host}", mkWebhookHandler(c, WebhookSecrets{GitHub: testWebhookSecret}, log.WithField(webServer, "test")))
+
+	// gitlab sends its token, which an empty secret must not match
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/"+GitLab, strings.NewReader("{}"))
+	r.Header.Set("X-Gitlab-Event", "Push Hook")
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, r)
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("webhook without a secret = %d, want 404", rw.Code)
+	}
+}
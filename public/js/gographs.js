@@ -3,14 +3,19 @@
 // TODO: needed?
 const defaultRepo = 'github.com/siggy/gographs';
 const defaultCluster = true;
+const defaultEngine = 'dot';
+const defaultRankdir = '';
 
 const DOM = {
   // https://magnushoff.com/blog/dependency-free-javascript/
   checkCluster:      document.getElementById('check-cluster'),
   externalDot:       document.getElementById('external-dot'),
   externalGoDoc:     document.getElementById('external-godoc'),
+  externalPdf:       document.getElementById('external-pdf'),
+  externalPng:       document.getElementById('external-png'),
   externalRepo:      document.getElementById('external-repo'),
   externalSvg:       document.getElementById('external-svg'),
+  graphOptions:      document.getElementById('graph-options'),
   inputError:        document.getElementById('input-error'),
   mainInput:         document.getElementById('main-input'),
   mainSvg:           document.getElementById('main-svg'),
@@ -20,6 +25,8 @@ const DOM = {
   refreshButton:     document.getElementById('refresh'),
   scope:             document.getElementById('scope'),
   scopeContainer:    document.getElementById('scope-container'),
+  selectEngine:      document.getElementById('select-engine'),
+  selectRankdir:     document.getElementById('select-rankdir'),
   spinner:           document.getElementById('spinner'),
   thumbSvg:          document.getElementById('thumb-svg'),
   viewport:          null, // fill in on load with "".svg-pan-zoom_viewport"
@@ -42,6 +49,12 @@ window.addEventListener('load', (_) => {
   DOM.checkCluster.addEventListener('change', function(_) {
     handleInput(false);
   });
+  DOM.selectEngine.addEventListener('change', function(_) {
+    handleInput(false);
+  });
+  DOM.selectRankdir.addEventListener('change', function(_) {
+    handleInput(false);
+  });
 
   updateInputsFromUrl();
   handleInput(false);
@@ -63,9 +76,11 @@ function updateInputsFromUrl() {
   const searchParams = new URLSearchParams(window.location.search);
 
   if (window.location.pathname.startsWith("/repo/")) {
-    // /repo/github.com/siggy/gographs?cluster=false
+    // /repo/github.com/siggy/gographs?cluster=false&engine=fdp&rankdir=TB
     DOM.mainInput.value = window.location.pathname.slice("/repo/".length)
     DOM.checkCluster.checked = searchParams.get('cluster') === 'true';
+    DOM.selectEngine.value = searchParams.get('engine') || defaultEngine;
+    DOM.selectRankdir.value = searchParams.get('rankdir') || defaultRankdir;
   } else if (window.location.pathname.startsWith("/svg")) {
     // /svg?url=https://gographs.io/repo/github.com/siggy/gographs.svg?cluster=false
     DOM.mainInput.value = searchParams.get('url');
@@ -73,6 +88,8 @@ function updateInputsFromUrl() {
     // unrecognized URL, reset everything to default
     DOM.mainInput.value = "";
     DOM.checkCluster.checked = defaultCluster;
+    DOM.selectEngine.value = defaultEngine;
+    DOM.selectRankdir.value = defaultRankdir;
   }
 
   return;
@@ -296,7 +313,12 @@ function checkStatus(response) {
 }
 
 function handleInput(refresh) {
-  const isDefault = (DOM.mainInput.value === "" && DOM.checkCluster.checked === defaultCluster);
+  const isDefault = (
+    DOM.mainInput.value === "" &&
+    DOM.checkCluster.checked === defaultCluster &&
+    DOM.selectEngine.value === defaultEngine &&
+    DOM.selectRankdir.value === defaultRankdir
+  );
   const input = DOM.mainInput.value || defaultRepo;
 
   DOM.badgeMarkdown.classList.remove("visible");
@@ -325,9 +347,7 @@ function handleInput(refresh) {
     DOM.mainInput.value = isDefault ? "" : goRepo;
 
     url = new URL('/graph/' + goRepo + '.svg', window.location.origin);
-    if (DOM.checkCluster.checked) {
-      url.searchParams.append("cluster", "true");
-    }
+    appendGraphOptions(url);
   }
 
   hideError();
@@ -346,8 +366,8 @@ function handleInput(refresh) {
       }
 
       const urlState = new URL(path, window.location.origin);
-      if (!isDefault && DOM.checkCluster.checked && goRepo) {
-        urlState.searchParams.append("cluster", "true");
+      if (!isDefault && goRepo) {
+        appendGraphOptions(urlState);
       }
 
       document.title =  goRepo ?
@@ -376,6 +396,20 @@ function handleInput(refresh) {
     });
 }
 
+// appendGraphOptions adds the cluster, engine and rankdir controls to a URL's
+// query, omitting defaults.
+function appendGraphOptions(url) {
+  if (DOM.checkCluster.checked) {
+    url.searchParams.append("cluster", "true");
+  }
+  if (DOM.selectEngine.value !== defaultEngine) {
+    url.searchParams.append("engine", DOM.selectEngine.value);
+  }
+  if (DOM.selectRankdir.value !== defaultRankdir) {
+    url.searchParams.append("rankdir", DOM.selectRankdir.value);
+  }
+}
+
 function loadSvg(svgHref, goRepo, blob) {
   // createObjectURL() must be coupled with revokeObjectURL(). ownership
   // of svgUrl passes from here to main-svg to thumb-svg.
@@ -387,22 +421,28 @@ function loadSvg(svgHref, goRepo, blob) {
 
   if (goRepo) {
     DOM.externalDot.href = svgHref.replace('.svg', '.dot');
+    DOM.externalPng.href = svgHref.replace('.svg', '.png');
+    DOM.externalPdf.href = svgHref.replace('.svg', '.pdf');
     DOM.externalRepo.href = "https://" + goRepo;
     DOM.externalGoDoc.href = "https://pkg.go.dev/" + goRepo;
 
-    DOM.checkCluster.parentElement.classList.add("visible");
+    DOM.graphOptions.classList.add("visible");
     DOM.externalDot.classList.add("visible");
+    DOM.externalPng.classList.add("visible");
+    DOM.externalPdf.classList.add("visible");
     DOM.externalRepo.classList.add("visible");
     DOM.externalGoDoc.classList.add("visible");
     DOM.refreshButton.classList.add("visible");
     DOM.badge.classList.add("visible");
 
-    const clusterParam = svgHref.indexOf("?cluster=true") !== -1 ? "?cluster=true" : ""
+    const params = new URL(svgHref).search;
     DOM.badgeText.value =
-      "[![gographs](https://gographs.io/badge.svg)](https://gographs.io/repo/" + goRepo + clusterParam + ")";
+      "[![gographs](https://gographs.io/badge.svg)](https://gographs.io/repo/" + goRepo + params + ")";
   } else {
-    DOM.checkCluster.parentElement.remove("visible");
+    DOM.graphOptions.classList.remove("visible");
     DOM.externalDot.classList.remove("visible");
+    DOM.externalPng.classList.remove("visible");
+    DOM.externalPdf.classList.remove("visible");
     DOM.externalRepo.classList.remove("visible");
     DOM.externalGoDoc.classList.remove("visible");
     DOM.refreshButton.classList.remove("visible");
@@ -511,7 +551,7 @@ function captureMouseEvents(e) {
  */
 
 function initAutoComplete() {
-  fetch('/top-repos')
+  fetch('/top-repos?window=all&limit=1000')
   .then(checkStatus)
   .then(resp => resp.json())
   .then(json => {